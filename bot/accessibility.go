@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/struct"
+	dialogflow "google.golang.org/genproto/googleapis/cloud/dialogflow/v2"
+)
+
+const (
+	ACCESSIBILITY = "ACCESSIBILITY"
+
+	ACCESSIBILITY_CONTEXT = "rsvperaccessibility-followup"
+
+	// DEFAULT_ACCESSIBILITY_OPTIONS are offered when ACCESSIBILITY_OPTIONS isn't set
+	DEFAULT_ACCESSIBILITY_OPTIONS = "Wheelchair access,Seating near the mandap,Help with transport"
+)
+
+// Unlike the names & dietary needs, "and" isn't a separator since the notes are free text
+var accessibilitySeparators = regexp.MustCompile(`[,;\n]`)
+var accessibilityPicks = regexp.MustCompile(`(?i)^(\d+|\s|&|\band\b)+$`)
+
+// AccessibilityNeeds are a family's answers to the accessibility question:
+// the options they picked & anything else they told us, in their own words
+type AccessibilityNeeds struct {
+	Options []string `json:"options"`
+	Notes   string   `json:"notes"`
+}
+
+func (needs AccessibilityNeeds) isEmpty() bool {
+	return len(needs.Options) == 0 && needs.Notes == ""
+}
+
+// askAccessibilityNeeds turns on asking about accessibility needs once the
+// family has RSVP'd to every event
+func askAccessibilityNeeds() bool {
+	return os.Getenv("ASK_ACCESSIBILITY_NEEDS") == "true"
+}
+
+// accessibilityOptions are ACCESSIBILITY_OPTIONS, or the DEFAULT_ACCESSIBILITY_OPTIONS
+func accessibilityOptions() []string {
+	options := os.Getenv("ACCESSIBILITY_OPTIONS")
+	if options == "" {
+		options = DEFAULT_ACCESSIBILITY_OPTIONS
+	}
+	var accessibilityOptions []string
+	for _, option := range strings.Split(options, ",") {
+		if option = strings.TrimSpace(option); option != "" {
+			accessibilityOptions = append(accessibilityOptions, option)
+		}
+	}
+	return accessibilityOptions
+}
+
+// isAttending is true when the family RSVP'd anyone to any of the events, the
+// only families we ask about accessibility
+func isAttending(rsvps map[Event]int) bool {
+	for _, rsvpd := range rsvps {
+		if rsvpd > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAccessibilityNeeds reads the options picked by number (i.e. "1 & 3")
+// or by name (i.e. "wheelchair access"), with everything else kept as notes
+// (i.e. "1, grandma can't manage stairs")
+func parseAccessibilityNeeds(text string, options []string) (AccessibilityNeeds, error) {
+	var needs AccessibilityNeeds
+	picked := make(map[string]bool)
+	pick := func(option string) {
+		if !picked[option] {
+			picked[option] = true
+			needs.Options = append(needs.Options, option)
+		}
+	}
+	var notes []string
+	for _, part := range accessibilitySeparators.Split(text, -1) {
+		part = strings.TrimSpace(part)
+		switch {
+		case strings.Trim(part, ".!") == "":
+			continue
+		case accessibilityPicks.MatchString(part):
+			for _, digits := range smsDigits.FindAllString(part, -1) {
+				number, _ := strconv.Atoi(digits)
+				if number < 1 || number > len(options) {
+					return AccessibilityNeeds{}, fmt.Errorf("there's no %d on the list", number)
+				}
+				pick(options[number-1])
+			}
+		default:
+			if option, ok := findFold(options, strings.Trim(part, ".!")); ok {
+				pick(option)
+				continue
+			}
+			notes = append(notes, part)
+		}
+	}
+	needs.Notes = strings.Join(notes, ", ")
+	if needs.isEmpty() {
+		return needs, fmt.Errorf("no accessibility needs")
+	}
+	return needs, nil
+}
+
+func isNoAccessibilityNeeds(text string) bool {
+	return dietaryNoneWords[strings.ToLower(strings.Trim(strings.TrimSpace(text), ".!? "))]
+}
+
+// saveAccessibilityNeeds replaces the family's accessibility needs in
+// ACCESSIBILITY, removing them when there aren't any
+func saveAccessibilityNeeds(inviteCode int, needs AccessibilityNeeds) error {
+	var rows [][]interface{}
+	if !needs.isEmpty() {
+		rows = append(rows, []interface{}{inviteCode, strings.Join(needs.Options, ", "), needs.Notes, time.Now(), sessionID})
+	}
+	return replaceFamilyRows(ACCESSIBILITY, inviteCode, rows)
+}
+
+// readAccessibilityNeeds is the accessibility needs by invite code
+func readAccessibilityNeeds() (map[int]AccessibilityNeeds, error) {
+	rows, err := getGoogleSheetsData(ACCESSIBILITY, "A2:C")
+	if err != nil {
+		return nil, err
+	}
+	accessibilityNeeds := make(map[int]AccessibilityNeeds)
+	for i, row := range rows {
+		if len(row) < 2 {
+			continue
+		}
+		inviteCode, err := strconv.Atoi(fmt.Sprint(row[0]))
+		if err != nil {
+			log.Printf("Skipping accessibility entry (%d) as its invite code isn't a number: %v", i+2, row[0])
+			continue
+		}
+		var needs AccessibilityNeeds
+		for _, option := range strings.Split(fmt.Sprint(row[1]), ",") {
+			if option = strings.TrimSpace(option); option != "" {
+				needs.Options = append(needs.Options, option)
+			}
+		}
+		if len(row) > 2 {
+			needs.Notes = fmt.Sprint(row[2])
+		}
+		accessibilityNeeds[inviteCode] = needs
+	}
+	return accessibilityNeeds, nil
+}
+
+// recordAccessibilityNeeds saves the family's accessibility needs and lets
+// the hosts know when there are any
+func recordAccessibilityNeeds(invitedFamily InvitedFamily, needs AccessibilityNeeds) {
+	if err := saveAccessibilityNeeds(invitedFamily.InviteCode, needs); err != nil {
+		log.Fatalf("Unable to save the accessibility needs of invite code %d: %v", invitedFamily.InviteCode, err)
+	}
+	if needs.isEmpty() {
+		return
+	}
+	provider, err := smsProviderFromEnv()
+	if err != nil {
+		log.Printf("Unable to let the hosts know about the accessibility needs of invite code %d: %v", invitedFamily.InviteCode, err)
+		return
+	}
+	notifyHosts(provider, hostPhoneNumbers(), hostAccessibilityMsg(invitedFamily, needs))
+}
+
+// hostPhoneNumbers are the HOST_PHONE_NUMBERS (separated by commas) the hosts
+// want to be texted at
+func hostPhoneNumbers() []string {
+	var phoneNumbers []string
+	for _, phoneNumber := range strings.Split(os.Getenv("HOST_PHONE_NUMBERS"), ",") {
+		if phoneNumber = strings.TrimSpace(phoneNumber); phoneNumber != "" {
+			phoneNumbers = append(phoneNumbers, phoneNumber)
+		}
+	}
+	return phoneNumbers
+}
+
+// notifyHosts texts each of the hosts, logging the ones that couldn't be
+// texted since the guest's answer is already saved
+func notifyHosts(provider SmsProvider, phoneNumbers []string, message string) {
+	if len(phoneNumbers) == 0 {
+		log.Printf("No HOST_PHONE_NUMBERS to send the notification to: %s", message)
+		return
+	}
+	for _, phoneNumber := range phoneNumbers {
+		if _, err := provider.SendSms(phoneNumber, message); err != nil {
+			log.Printf("Unable to notify host %s: %v", phoneNumber, err)
+		}
+	}
+}
+
+// accessibilityResponse asks the Dialogflow guest about accessibility needs,
+// keeping the invite code in a context for AccessibilityFulfillment
+func accessibilityResponse(response *DialogflowResponse, inviteCode int) {
+	accessibilityContext := dialogflow.Context{
+		Name:          sessionID + "/contexts/" + ACCESSIBILITY_CONTEXT,
+		LifespanCount: 2,
+		Parameters: &structpb.Struct{Fields: map[string]*structpb.Value{
+			"invite_code": numberValue(inviteCode),
+		}},
+	}
+	response.Text(accessibilityPromptMsg(accessibilityOptions())).Contexts(&accessibilityContext)
+}
+
+// AccessibilityFulfillment saves the accessibility needs the guest replied
+// with and carries on with the closing questions, or sums up their RSVPs
+func AccessibilityFulfillment(response *DialogflowResponse, contexts []*dialogflow.Context, text string) {
+	inviteCode := getInviteCodeFromContext(contexts)
+	if inviteCode == -1 {
+		log.Fatalf("%s | %s | Couldn't find the invite code for the accessibility needs", sessionID, responseID)
+	}
+	log.Printf("\nIntent: %s - Starting fulfillment for invite code: %d", intent, inviteCode)
+
+	var needs AccessibilityNeeds
+	if !isNoAccessibilityNeeds(text) {
+		var err error
+		if needs, err = parseAccessibilityNeeds(text, accessibilityOptions()); err != nil {
+			accessibilityResponse(response.Text(DIDNT_UNDERSTAND_MSG), inviteCode)
+			return
+		}
+	}
+	invitedFamily := findInvitedFamily(inviteCode)
+	recordAccessibilityNeeds(invitedFamily, needs)
+	closingResponse(response, invitedFamily, invitedFamily.rsvps(), STEP_ACCESSIBILITY)
+}
+
+// AccessibilityRow is one attending family's accessibility needs, with how
+// many they RSVP'd to each of the events they're coming to
+type AccessibilityRow struct {
+	InviteCode int            `json:"inviteCode"`
+	InviteName string         `json:"inviteName"`
+	Rsvps      map[string]int `json:"rsvps"`
+	Options    []string       `json:"options"`
+	Notes      string         `json:"notes"`
+}
+
+// accessibilityReport lists the families with accessibility needs that are
+// coming to any of the events
+func accessibilityReport(invitedFamilies []InvitedFamily, accessibilityNeeds map[int]AccessibilityNeeds, events []Event) []AccessibilityRow {
+	sort.SliceStable(invitedFamilies, func(i, j int) bool { return invitedFamilies[i].InviteCode < invitedFamilies[j].InviteCode })
+	var rows []AccessibilityRow
+	for _, invitedFamily := range invitedFamilies {
+		needs, ok := accessibilityNeeds[invitedFamily.InviteCode]
+		if !ok || needs.isEmpty() {
+			continue
+		}
+		rsvps := make(map[string]int)
+		for _, event := range events {
+			if rsvpd := invitedFamily.rsvpdTo(event); rsvpd > 0 {
+				rsvps[event.Name] = rsvpd
+			}
+		}
+		if len(rsvps) == 0 {
+			continue
+		}
+		rows = append(rows, AccessibilityRow{InviteCode: invitedFamily.InviteCode, InviteName: invitedFamily.InviteName, Rsvps: rsvps, Options: needs.Options, Notes: needs.Notes})
+	}
+	return rows
+}
+
+// formatEventRsvps is the RSVPs in the events' order, i.e. "VIDHI: 4, WEDDING: 2"
+func formatEventRsvps(rsvps map[string]int) string {
+	var parts []string
+	for _, event := range AllEvents {
+		if rsvpd, ok := rsvps[event.Name]; ok {
+			parts = append(parts, fmt.Sprintf("%s: %d", event.Name, rsvpd))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func writeAccessibilityReport(writer io.Writer, report []AccessibilityRow, format string) error {
+	header := []string{"Invite Code", "Invite Name", "RSVP'd", "Needs", "Notes"}
+	record := func(row AccessibilityRow) []string {
+		return []string{strconv.Itoa(row.InviteCode), row.InviteName, formatEventRsvps(row.Rsvps), strings.Join(row.Options, ", "), row.Notes}
+	}
+	switch format {
+	case REPORT_TABLE:
+		table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, strings.Join(header, "\t"))
+		for _, row := range report {
+			fmt.Fprintln(table, strings.Join(record(row), "\t"))
+		}
+		return table.Flush()
+	case REPORT_CSV:
+		csvWriter := csv.NewWriter(writer)
+		csvWriter.Write(header)
+		for _, row := range report {
+			csvWriter.Write(record(row))
+		}
+		csvWriter.Flush()
+		return csvWriter.Error()
+	case REPORT_JSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return fmt.Errorf("unknown report format %q (table, csv or json)", format)
+}
+
+func accessibilityReportCommand(args []string) error {
+	flags := flag.NewFlagSet("accessibility-report", flag.ExitOnError)
+	eventName := flags.String("event", "", "only list the families coming to this event, i.e. WEDDING (default all events)")
+	format := flags.String("format", REPORT_TABLE, "table, csv or json")
+	outputFile := flags.String("out", "", "file to write the report to (default stdout)")
+	flags.Parse(args)
+
+	events := AllEvents
+	if *eventName != "" {
+		event, ok := eventByName(*eventName)
+		if !ok {
+			return fmt.Errorf("unknown event %q", *eventName)
+		}
+		events = []Event{event}
+	}
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		return err
+	}
+	accessibilityNeeds, err := readAccessibilityNeeds()
+	if err != nil {
+		return err
+	}
+
+	var writer io.Writer = os.Stdout
+	if *outputFile != "" {
+		file, err := os.Create(*outputFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+	return writeAccessibilityReport(writer, accessibilityReport(invitedFamilies, accessibilityNeeds, events), *format)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseAccessibilityNeeds(t *testing.T) {
+	options := []string{"Wheelchair access", "Seating near the mandap", "Help with transport"}
+	tests := map[string]string{
+		"1 & 3":                "{[Wheelchair access Help with transport] }",
+		"wheelchair access, 1": "{[Wheelchair access] }",
+		"2; Dadi can't manage stairs and uses a cane": "{[Seating near the mandap] Dadi can't manage stairs and uses a cane}",
+		"a ride from the airport, please.":            "{[] a ride from the airport, please.}",
+	}
+	for text, expected := range tests {
+		needs, err := parseAccessibilityNeeds(text, options)
+		if err != nil {
+			t.Errorf("Error parsing %q: +%v", text, err)
+			continue
+		}
+		if fmt.Sprint(needs) != expected {
+			t.Errorf("Expected %q to parse as %s, got: +%v", text, expected, needs)
+		}
+	}
+
+	for _, text := range []string{"4", "1 and 0", " ; . "} {
+		if needs, err := parseAccessibilityNeeds(text, options); err == nil {
+			t.Errorf("Expected %q not to parse, got: +%v", text, needs)
+		}
+	}
+}
+
+func TestAccessibilityReport(t *testing.T) {
+	invitedFamilies := []InvitedFamily{
+		{InviteCode: 3, InviteName: "The Modi Family", VidhiRsvpd: 0, WeddingRsvpd: 2, GarbaRsvpd: NULL_INVITEES},
+		{InviteCode: 1, InviteName: "The Shah Family", VidhiRsvpd: 4, WeddingRsvpd: 0, GarbaRsvpd: NULL_INVITEES},
+		{InviteCode: 2, InviteName: "The Patel Family", VidhiRsvpd: 0, WeddingRsvpd: 0, GarbaRsvpd: 0},
+	}
+	accessibilityNeeds := map[int]AccessibilityNeeds{
+		1: {Options: []string{"Wheelchair access"}},
+		2: {Notes: "needs a ride"},
+		3: {Options: []string{"Help with transport"}, Notes: "arriving late"},
+	}
+
+	report := accessibilityReport(invitedFamilies, accessibilityNeeds, AllEvents)
+	if len(report) != 2 || report[0].InviteCode != 1 || report[1].InviteCode != 3 {
+		t.Fatalf("Expected only the attending families 1 & 3, got: +%v", report)
+	}
+	if report := accessibilityReport(invitedFamilies, accessibilityNeeds, []Event{Wedding}); len(report) != 1 || report[0].InviteCode != 3 {
+		t.Errorf("Expected only family 3 at the wedding, got: +%v", report)
+	}
+
+	var buffer bytes.Buffer
+	if err := writeAccessibilityReport(&buffer, report[1:], REPORT_CSV); err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if expected := "Invite Code,Invite Name,RSVP'd,Needs,Notes\n3,The Modi Family,WEDDING: 2,Help with transport,arriving late\n"; buffer.String() != expected {
+		t.Errorf("Unexpected csv: %s", buffer.String())
+	}
+}
+
+func TestNotifyHosts(t *testing.T) {
+	invitedFamily := InvitedFamily{InviteCode: 5, InviteName: "The Shah Family", VidhiRsvpd: 2, GarbaRsvpd: 0, WeddingRsvpd: NULL_INVITEES}
+	message := hostAccessibilityMsg(invitedFamily, AccessibilityNeeds{Options: []string{"Wheelchair access"}, Notes: "Dadi uses a cane"})
+	if expected := `Accessibility needs from The Shah Family (invite code 5, coming to ` + Vidhi.DisplayName + `: 2): Wheelchair access. "Dadi uses a cane"`; message != expected {
+		t.Errorf("Expected %s, got: %s", expected, message)
+	}
+
+	var buffer bytes.Buffer
+	notifyHosts(&WriterSmsProvider{Writer: &buffer}, []string{"+15550001", "+15550002"}, message)
+	if sent := strings.Count(buffer.String(), message); sent != 2 {
+		t.Errorf("Expected both hosts to be texted, got: %s", buffer.String())
+	}
+}
+
+func TestSmsAsksAccessibilityAfterLastRsvp(t *testing.T) {
+	os.Setenv("ASK_ACCESSIBILITY_NEEDS", "true")
+	defer os.Unsetenv("ASK_ACCESSIBILITY_NEEDS")
+	defer useMemoryStore(InvitedFamily{InviteCode: 7, WeddingInvited: 2, VidhiInvited: NULL_INVITEES, GarbaInvited: NULL_INVITEES, WeddingRsvpd: NULL_INVITEES, VidhiRsvpd: NULL_INVITEES, GarbaRsvpd: NULL_INVITEES})()
+
+	conversation := Conversation{InviteCode: 7, Step: STEP_RSVP + Wedding.Name, Rsvps: make(map[Event]int)}
+	if message := smsFulfillment(&conversation, smsInput{kind: SMS_NUMBER, number: 2}, "2"); conversation.Step != STEP_ACCESSIBILITY || !strings.Contains(message, "1. Wheelchair access") {
+		t.Errorf("Expected to be asked about accessibility, got: %s", message)
+	}
+
+	conversation = Conversation{InviteCode: 7, Step: STEP_RSVP + Wedding.Name, Rsvps: make(map[Event]int)}
+	if message := smsFulfillment(&conversation, smsInput{kind: SMS_NUMBER, number: 0}, "0"); conversation.Step != STEP_START {
+		t.Errorf("Expected families that aren't coming not to be asked about accessibility, got: %s", message)
+	}
+}
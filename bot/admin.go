@@ -0,0 +1,359 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	// HOST_ENTERED is the phone number logged in UPDATE_EVENT for RSVPs the hosts made on a guest's behalf
+	HOST_ENTERED = "HOST"
+	ADMIN_PATH   = "/admin/"
+)
+
+// AdminFamily is how families are sent & received by the admin API. Invited
+// counts are a number or "ALL", and RSVP counts are a number or null (no RSVP yet),
+// both keyed by event name. The children's counts are only there for the
+// events that count children.
+type AdminFamily struct {
+	Origin          string                 `json:"origin"`
+	Name            string                 `json:"name"`
+	InviteName      string                 `json:"inviteName"`
+	InviteCode      int                    `json:"inviteCode"`
+	Invited         map[string]interface{} `json:"invited"`
+	Rsvpd           map[string]interface{} `json:"rsvpd"`
+	ChildrenInvited map[string]interface{} `json:"childrenInvited,omitempty"`
+	ChildrenRsvpd   map[string]interface{} `json:"childrenRsvpd,omitempty"`
+	History         []RsvpUpdate           `json:"history,omitempty"`
+}
+
+type adminError struct {
+	status  int
+	message string
+}
+
+func (err adminError) Error() string {
+	return err.message
+}
+
+// AdminHandler serves the admin API under /admin, for the hosts to manage the
+// guest list without editing the sheet. Requests need the ADMIN_API_TOKEN as a
+// bearer token.
+//
+//	GET    /admin/families?q=patel           list families, optionally matching a name, invite name or origin
+//	POST   /admin/families                   add a family
+//	GET    /admin/families/{code}            a family with its RSVP history
+//	PUT    /admin/families/{code}/invited    set invited counts, i.e. {"VIDHI": 4, "WEDDING": "ALL"}
+//	PUT    /admin/families/{code}/rsvps      RSVP on the family's behalf, i.e. {"WEDDING": 3}
+//	DELETE /admin/families/{code}            delete a family
+//	GET    /admin/seat-requests?status=PENDING  list the guests' requests for more seats, optionally with a status
+//	POST   /admin/seat-requests/{id}/approve    approve a request, raising the family's invited count
+//	POST   /admin/seat-requests/{id}/deny       deny a request
+func AdminHandler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if !isAuthorizedAdminRequest(request) {
+		return adminResponse(nil, adminError{401, "missing or invalid bearer token"}), nil
+	}
+
+	sessionID = "admin-" + request.RequestContext.RequestID
+	responseID = sessionID
+	requestStr = request.HTTPMethod + " " + request.Path + " " + request.Body
+	intent = "admin"
+	log.Printf("Admin request: %s %s", request.HTTPMethod, request.Path)
+
+	path := strings.Split(strings.Trim(request.Path[strings.Index(request.Path, ADMIN_PATH)+len(ADMIN_PATH):], "/"), "/")
+	if path[0] == "seat-requests" && len(path) <= 3 {
+		return adminResponse(adminSeatRequests(request.HTTPMethod, path, request.QueryStringParameters["status"])), nil
+	}
+	if path[0] != "families" || len(path) > 3 {
+		return adminResponse(nil, adminError{404, "not found"}), nil
+	}
+	if len(path) == 1 {
+		switch request.HTTPMethod {
+		case "GET":
+			return adminResponse(adminListFamilies(request.QueryStringParameters["q"])), nil
+		case "POST":
+			return adminResponse(adminAddFamily(request.Body)), nil
+		}
+		return adminResponse(nil, adminError{405, "method not allowed"}), nil
+	}
+
+	inviteCode, err := strconv.Atoi(path[1])
+	if err != nil {
+		return adminResponse(nil, adminError{404, "invite codes are numbers"}), nil
+	}
+	route := request.HTTPMethod
+	if len(path) == 3 {
+		route += " " + path[2]
+	}
+	switch route {
+	case "GET":
+		return adminResponse(adminGetFamily(inviteCode)), nil
+	case "DELETE":
+		return adminResponse(nil, adminDeleteFamily(inviteCode)), nil
+	case "PUT invited":
+		return adminResponse(adminSetInvited(inviteCode, request.Body)), nil
+	case "PUT rsvps":
+		return adminResponse(adminSetRsvps(inviteCode, request.Body)), nil
+	}
+	return adminResponse(nil, adminError{404, "not found"}), nil
+}
+
+func isAuthorizedAdminRequest(request events.APIGatewayProxyRequest) bool {
+	token := os.Getenv("ADMIN_API_TOKEN")
+	if token == "" {
+		log.Printf("ADMIN_API_TOKEN isn't set, so the admin API is disabled")
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(getHeader(request, "Authorization")), []byte("Bearer "+token)) == 1
+}
+
+func adminListFamilies(query string) ([]AdminFamily, error) {
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		return nil, err
+	}
+	families := []AdminFamily{}
+	for _, invitedFamily := range invitedFamilies {
+		if query == "" || CaseInsensitiveContains(invitedFamily.Name, query) || CaseInsensitiveContains(invitedFamily.InviteName, query) || CaseInsensitiveContains(invitedFamily.Origin, query) {
+			families = append(families, toAdminFamily(invitedFamily))
+		}
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].InviteCode < families[j].InviteCode })
+	return families, nil
+}
+
+func adminGetFamily(inviteCode int) (AdminFamily, error) {
+	invitedFamily, err := adminFindFamily(inviteCode)
+	if err != nil {
+		return AdminFamily{}, err
+	}
+	family := toAdminFamily(invitedFamily)
+	if family.History, err = guestStore.RsvpHistory(inviteCode); err != nil {
+		return family, err
+	}
+	return family, nil
+}
+
+func adminDeleteFamily(inviteCode int) error {
+	if _, err := adminFindFamily(inviteCode); err != nil {
+		return err
+	}
+	return guestStore.DeleteFamily(inviteCode)
+}
+
+// adminAddFamily adds the family with the next free invite code when it doesn't have one
+func adminAddFamily(body string) (AdminFamily, error) {
+	var family AdminFamily
+	if err := json.Unmarshal([]byte(body), &family); err != nil {
+		return family, adminError{400, "invalid family: " + err.Error()}
+	}
+	invitedFamily, err := fromAdminFamily(family)
+	if err != nil {
+		return family, err
+	}
+	if invitedFamily.InviteCode == 0 {
+		invitedFamilies, err := guestStore.AllFamilies()
+		if err != nil {
+			return family, err
+		}
+		for _, existing := range invitedFamilies {
+			if existing.InviteCode >= invitedFamily.InviteCode {
+				invitedFamily.InviteCode = existing.InviteCode + 1
+			}
+		}
+	}
+	if _, found, err := guestStore.FindFamily(invitedFamily.InviteCode); err != nil || found {
+		if found {
+			err = adminError{409, fmt.Sprintf("invite code %d is already used", invitedFamily.InviteCode)}
+		}
+		return family, err
+	}
+	return toAdminFamily(invitedFamily), guestStore.AddFamily(invitedFamily)
+}
+
+func adminSetInvited(inviteCode int, body string) (AdminFamily, error) {
+	counts, err := parseAdminCounts(body)
+	if err != nil {
+		return AdminFamily{}, err
+	}
+	invitedFamily, err := adminFindFamily(inviteCode)
+	if err != nil {
+		return AdminFamily{}, err
+	}
+	for event, count := range counts {
+		if count == nil {
+			count = 0
+		}
+		invited, err := convertSheetCellToNumber(fmt.Sprint(count))
+		if err != nil || invited < 0 {
+			return AdminFamily{}, adminError{400, fmt.Sprintf("%s has to be a number or ALL", event.Name)}
+		}
+		invitedFamily.setInvited(event, invited)
+	}
+	return toAdminFamily(invitedFamily), guestStore.UpdateFamily(invitedFamily)
+}
+
+// adminSetRsvps saves the RSVPs like the bot does, with HOST_ENTERED as the
+// phone number. The family's adults & children split is kept (see recountedChildren).
+func adminSetRsvps(inviteCode int, body string) (AdminFamily, error) {
+	counts, err := parseAdminCounts(body)
+	if err != nil {
+		return AdminFamily{}, err
+	}
+	invitedFamily, err := adminFindFamily(inviteCode)
+	if err != nil {
+		return AdminFamily{}, err
+	}
+	rsvps, children := make(map[Event]int), make(map[Event]int)
+	for event, count := range counts {
+		rsvpd, err := strconv.Atoi(fmt.Sprint(count))
+		if err != nil || rsvpd < 0 {
+			return AdminFamily{}, adminError{400, fmt.Sprintf("%s has to be a number", event.Name)}
+		}
+		if invited := invitedFamily.invitedTo(event); rsvpd > invited {
+			return AdminFamily{}, adminError{400, fmt.Sprintf("%s is more than the %d invited", event.Name, invited)}
+		}
+		if recounted, ok := invitedFamily.recountedChildren(event, rsvpd)[event]; ok {
+			children[event] = recounted
+			invitedFamily.setChildrenRsvpd(event, recounted)
+		}
+		rsvps[event] = rsvpd
+		invitedFamily.setRsvpd(event, rsvpd)
+	}
+	if err := guestStore.SaveRsvps(inviteCode, HOST_ENTERED, rsvps, children); err != nil {
+		return AdminFamily{}, err
+	}
+	// The hosts can go over an event's capacity, but seats they free up go to the waitlist
+	if hasCapacity(rsvps) {
+		var events []Event
+		for event := range rsvps {
+			events = append(events, event)
+		}
+		if err := promoteWaitlist(events); err != nil {
+			log.Printf("Unable to promote the waitlist after the hosts changed invite code %d's RSVPs: %v", inviteCode, err)
+		}
+	}
+	return toAdminFamily(invitedFamily), nil
+}
+
+func adminFindFamily(inviteCode int) (InvitedFamily, error) {
+	invitedFamily, found, err := guestStore.FindFamily(inviteCode)
+	if err == nil && !found {
+		err = adminError{404, fmt.Sprintf("no invited family with invite code %d", inviteCode)}
+	}
+	return invitedFamily, err
+}
+
+// parseAdminCounts reads counts keyed by event name, i.e. {"VIDHI": 4, "WEDDING": "ALL"}
+func parseAdminCounts(body string) (map[Event]interface{}, error) {
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &values); err != nil {
+		return nil, adminError{400, "expected counts by event, i.e. {\"VIDHI\": 4}"}
+	}
+	counts := make(map[Event]interface{})
+	for name, count := range values {
+		event, ok := eventByName(name)
+		if !ok {
+			return nil, adminError{400, "unknown event " + name}
+		}
+		counts[event] = count
+	}
+	return counts, nil
+}
+
+func toAdminFamily(invitedFamily InvitedFamily) AdminFamily {
+	family := AdminFamily{
+		Origin:     invitedFamily.Origin,
+		Name:       invitedFamily.Name,
+		InviteName: invitedFamily.InviteName,
+		InviteCode: invitedFamily.InviteCode,
+		Invited:    make(map[string]interface{}),
+		Rsvpd:      make(map[string]interface{}),
+	}
+	for _, event := range AllEvents {
+		family.Invited[event.Name] = invitedFamily.invitedTo(event)
+		if invitedFamily.invitedTo(event) == MAX_INVITEES {
+			family.Invited[event.Name] = "ALL"
+		}
+		family.Rsvpd[event.Name] = nil
+		if rsvpd := invitedFamily.rsvpdTo(event); rsvpd != NULL_INVITEES {
+			family.Rsvpd[event.Name] = rsvpd
+		}
+		if !event.CountsChildren {
+			continue
+		}
+		if family.ChildrenInvited == nil {
+			family.ChildrenInvited, family.ChildrenRsvpd = make(map[string]interface{}), make(map[string]interface{})
+		}
+		family.ChildrenInvited[event.Name] = invitedFamily.childrenInvitedTo(event)
+		if invitedFamily.childrenInvitedTo(event) == MAX_INVITEES {
+			family.ChildrenInvited[event.Name] = "ALL"
+		}
+		family.ChildrenRsvpd[event.Name] = nil
+		if children := invitedFamily.childrenRsvpdTo(event); children != NULL_INVITEES {
+			family.ChildrenRsvpd[event.Name] = children
+		}
+	}
+	return family
+}
+
+func fromAdminFamily(family AdminFamily) (InvitedFamily, error) {
+	invitedFamily := InvitedFamily{
+		Origin:     family.Origin,
+		Name:       family.Name,
+		InviteName: family.InviteName,
+		InviteCode: family.InviteCode,
+	}
+	if invitedFamily.InviteName == "" {
+		return invitedFamily, adminError{400, "inviteName is required"}
+	}
+	for _, event := range AllEvents {
+		invitedFamily.setRsvpd(event, NULL_INVITEES)
+		invitedFamily.setChildrenRsvpd(event, NULL_INVITEES)
+		if count, ok := family.Invited[event.Name]; ok && count != nil {
+			invited, err := convertSheetCellToNumber(fmt.Sprint(count))
+			if err != nil || invited < 0 {
+				return invitedFamily, adminError{400, fmt.Sprintf("invited %s has to be a number or ALL", event.Name)}
+			}
+			invitedFamily.setInvited(event, invited)
+		}
+		if count, ok := family.ChildrenInvited[event.Name]; ok && count != nil && event.CountsChildren {
+			children, err := convertSheetCellToNumber(fmt.Sprint(count))
+			if err != nil || children < 0 {
+				return invitedFamily, adminError{400, fmt.Sprintf("children invited %s has to be a number or ALL", event.Name)}
+			}
+			invitedFamily.setChildrenInvited(event, children)
+		}
+	}
+	return invitedFamily, nil
+}
+
+func adminResponse(body interface{}, err error) events.APIGatewayProxyResponse {
+	status := 200
+	if err != nil {
+		status = 500
+		if adminErr, ok := err.(adminError); ok {
+			status = adminErr.status
+		} else {
+			log.Printf("%s | Admin request failed: %v", sessionID, err)
+		}
+		body = map[string]string{"error": err.Error()}
+	}
+	if body == nil {
+		return events.APIGatewayProxyResponse{StatusCode: 204}
+	}
+	respBody, _ := json.Marshal(body)
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(respBody),
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// memoryStore is a GuestStore for tests
+type memoryStore struct {
+	families []InvitedFamily
+	history  []RsvpUpdate
+}
+
+func (store *memoryStore) AllFamilies() ([]InvitedFamily, error) {
+	return store.families, nil
+}
+
+func (store *memoryStore) FindFamily(inviteCode int) (InvitedFamily, bool, error) {
+	for _, invitedFamily := range store.families {
+		if invitedFamily.InviteCode == inviteCode {
+			return invitedFamily, true, nil
+		}
+	}
+	return InvitedFamily{}, false, nil
+}
+
+func (store *memoryStore) AddFamily(invitedFamily InvitedFamily) error {
+	store.families = append(store.families, invitedFamily)
+	return nil
+}
+
+func (store *memoryStore) UpdateFamily(invitedFamily InvitedFamily) error {
+	for i := range store.families {
+		if store.families[i].InviteCode == invitedFamily.InviteCode {
+			store.families[i] = invitedFamily
+			return nil
+		}
+	}
+	return fmt.Errorf("no invited family with invite code %d", invitedFamily.InviteCode)
+}
+
+func (store *memoryStore) DeleteFamily(inviteCode int) error {
+	for i := range store.families {
+		if store.families[i].InviteCode == inviteCode {
+			store.families = append(store.families[:i], store.families[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no invited family with invite code %d", inviteCode)
+}
+
+func (store *memoryStore) SaveRsvps(inviteCode int, phoneNumber string, rsvps map[Event]int, children map[Event]int) error {
+	for i := range store.families {
+		if store.families[i].InviteCode != inviteCode {
+			continue
+		}
+		for event, attendees := range rsvps {
+			childrenRsvpd, ok := children[event]
+			if !ok {
+				childrenRsvpd = NULL_INVITEES
+			}
+			store.families[i].setRsvpd(event, attendees)
+			store.families[i].setChildrenRsvpd(event, childrenRsvpd)
+			store.history = append(store.history, RsvpUpdate{InviteCode: inviteCode, PhoneNumber: phoneNumber, Event: event.Name, Attendees: attendees, Children: childrenRsvpd, SessionID: sessionID})
+		}
+	}
+	return nil
+}
+
+func (store *memoryStore) RsvpHistory(inviteCode int) ([]RsvpUpdate, error) {
+	var history []RsvpUpdate
+	for _, update := range store.history {
+		if update.InviteCode == inviteCode {
+			history = append(history, update)
+		}
+	}
+	return history, nil
+}
+
+func (store *memoryStore) AllRsvpUpdates() ([]RsvpUpdate, error) {
+	return store.history, nil
+}
+
+func (store *memoryStore) AppendRsvpUpdates(updates []RsvpUpdate) error {
+	store.history = append(store.history, updates...)
+	return nil
+}
+
+func useMemoryStore(families ...InvitedFamily) func() {
+	previous := guestStore
+	guestStore = &memoryStore{families: families}
+	return func() { guestStore = previous }
+}
+
+func adminRequest(method string, path string, body string) events.APIGatewayProxyResponse {
+	request := events.APIGatewayProxyRequest{
+		HTTPMethod: method,
+		Path:       path,
+		Body:       body,
+		Headers:    map[string]string{"authorization": "Bearer s3cret"},
+	}
+	response, _ := Handler(request)
+	return response
+}
+
+func TestAdminHandlerRequiresToken(t *testing.T) {
+	defer useMemoryStore()()
+	os.Setenv("ADMIN_API_TOKEN", "s3cret")
+	defer os.Unsetenv("ADMIN_API_TOKEN")
+
+	response, _ := Handler(events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/admin/families", Headers: map[string]string{"Authorization": "Bearer wrong"}})
+	if response.StatusCode != 401 {
+		t.Errorf("Expected 401 for the wrong token, got: %d", response.StatusCode)
+	}
+
+	os.Unsetenv("ADMIN_API_TOKEN")
+	if response := adminRequest("GET", "/admin/families", ""); response.StatusCode != 401 {
+		t.Errorf("Expected 401 when ADMIN_API_TOKEN isn't set, got: %d", response.StatusCode)
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	defer useMemoryStore(InvitedFamily{Origin: "Mumbai", Name: "Rakesh Patel", InviteName: "The Patel Family", InviteCode: 7, VidhiInvited: 4, VidhiRsvpd: NULL_INVITEES, GarbaRsvpd: NULL_INVITEES, WeddingRsvpd: NULL_INVITEES})()
+	os.Setenv("ADMIN_API_TOKEN", "s3cret")
+	defer os.Unsetenv("ADMIN_API_TOKEN")
+
+	response := adminRequest("POST", "/admin/families", `{"origin": "Chicago", "inviteName": "The Shah Family", "invited": {"WEDDING": "ALL"}}`)
+	if response.StatusCode != 200 {
+		t.Fatalf("Expected the family to be added, got: %d %s", response.StatusCode, response.Body)
+	}
+	var added AdminFamily
+	json.Unmarshal([]byte(response.Body), &added)
+	if added.InviteCode != 8 || added.Invited["WEDDING"] != "ALL" || added.Rsvpd["WEDDING"] != nil {
+		t.Errorf("Expected the next invite code & unlimited wedding invite, got: +%v", added)
+	}
+
+	if response := adminRequest("PUT", "/admin/families/7/invited", `{"WEDDING": 2}`); response.StatusCode != 200 {
+		t.Errorf("Expected the invited counts to be set, got: %d %s", response.StatusCode, response.Body)
+	}
+	if response := adminRequest("PUT", "/admin/families/7/rsvps", `{"WEDDING": 3}`); response.StatusCode != 400 {
+		t.Errorf("Expected an RSVP over the invited count to be rejected, got: %d %s", response.StatusCode, response.Body)
+	}
+	if response := adminRequest("PUT", "/admin/families/7/rsvps", `{"WEDDING": 2, "VIDHI": 0}`); response.StatusCode != 200 {
+		t.Errorf("Expected the RSVPs to be saved, got: %d %s", response.StatusCode, response.Body)
+	}
+
+	var family AdminFamily
+	json.Unmarshal([]byte(adminRequest("GET", "/admin/families/7", "").Body), &family)
+	if family.Invited["WEDDING"] != 2.0 || family.Rsvpd["WEDDING"] != 2.0 || family.Rsvpd["VIDHI"] != 0.0 {
+		t.Errorf("Unexpected family: +%v", family)
+	}
+	if len(family.History) != 2 || family.History[0].PhoneNumber != HOST_ENTERED {
+		t.Errorf("Expected the RSVPs to be logged as host-entered, got: +%v", family.History)
+	}
+
+	var families []AdminFamily
+	json.Unmarshal([]byte(adminRequest("GET", "/admin/families", "").Body), &families)
+	if len(families) != 2 {
+		t.Errorf("Expected 2 families, got: +%v", families)
+	}
+	if families, _ := adminListFamilies("patel"); len(families) != 1 || families[0].InviteCode != 7 {
+		t.Errorf("Expected to find the Patel family, got: +%v", families)
+	}
+
+	if response := adminRequest("DELETE", "/admin/families/8", ""); response.StatusCode != 204 {
+		t.Errorf("Expected the family to be deleted, got: %d %s", response.StatusCode, response.Body)
+	}
+	if response := adminRequest("GET", "/admin/families/8", ""); response.StatusCode != 404 {
+		t.Errorf("Expected 404 for a deleted family, got: %d", response.StatusCode)
+	}
+}
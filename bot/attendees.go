@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/struct"
+	dialogflow "google.golang.org/genproto/googleapis/cloud/dialogflow/v2"
+)
+
+const (
+	ATTENDEES     = "ATTENDEES"
+	FAMILY_MEMBER = "FAMILY_MEMBER"
+
+	ATTENDEES_CONTEXT = "rsvperattendees-followup"
+)
+
+var attendeeNameSeparators = regexp.MustCompile(`(?i)[,;&\n]|\band\b`)
+var attendeeSkipWords = map[string]bool{"skip": true, "no": true, "not now": true, "later": true}
+
+// collectAttendeeNames turns on asking for the attendees' names after each RSVP count
+func collectAttendeeNames() bool {
+	return os.Getenv("COLLECT_ATTENDEE_NAMES") == "true"
+}
+
+// familyMembers are the names the hosts pre-seeded for the family in FAMILY_MEMBER
+func familyMembers(inviteCode int) []string {
+	rows, err := getGoogleSheetsData(FAMILY_MEMBER, "A2:B")
+	if err != nil {
+		log.Printf("Unable to read the family members of invite code %d: %v", inviteCode, err)
+		return nil
+	}
+	var members []string
+	for _, row := range rows {
+		if len(row) < 2 || fmt.Sprint(row[0]) != strconv.Itoa(inviteCode) {
+			continue
+		}
+		if name := strings.TrimSpace(fmt.Sprint(row[1])); name != "" {
+			members = append(members, name)
+		}
+	}
+	return members
+}
+
+// parseAttendeeNames reads names separated by commas or "and", where a number
+// picks that family member from the list (i.e. "1, 3 & Anil" or "1 3")
+func parseAttendeeNames(text string, members []string) ([]string, error) {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if key := strings.ToLower(name); !seen[key] {
+			seen[key] = true
+			names = append(names, name)
+		}
+	}
+	for _, part := range attendeeNameSeparators.Split(text, -1) {
+		fields := strings.Fields(strings.Trim(strings.TrimSpace(part), ".!"))
+		if len(fields) == 0 {
+			continue
+		}
+		var picks []int
+		for _, field := range fields {
+			if pick, err := strconv.Atoi(strings.Trim(field, ".)")); err == nil {
+				picks = append(picks, pick)
+			}
+		}
+		if len(picks) != len(fields) {
+			add(strings.Join(fields, " "))
+			continue
+		}
+		for _, pick := range picks {
+			if pick < 1 || pick > len(members) {
+				return nil, fmt.Errorf("there's no %d on the list", pick)
+			}
+			add(members[pick-1])
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no names")
+	}
+	return names, nil
+}
+
+func isSkipAttendeeNames(text string) bool {
+	return attendeeSkipWords[strings.ToLower(strings.Trim(strings.TrimSpace(text), ".!? "))]
+}
+
+// saveAttendees replaces the family's attendees of the event in ATTENDEES
+func saveAttendees(inviteCode int, event Event, names []string) error {
+	var rows [][]interface{}
+	for _, name := range names {
+		rows = append(rows, []interface{}{inviteCode, event.Name, name, time.Now(), sessionID})
+	}
+	return replaceFamilyEventRows(ATTENDEES, inviteCode, event, rows)
+}
+
+// attendeesOf is the names saved for the family's attendees of the event
+func attendeesOf(inviteCode int, event Event) []string {
+	attendees, err := readAttendees()
+	if err != nil {
+		log.Printf("Unable to read the attendees of invite code %d: %v", inviteCode, err)
+		return nil
+	}
+	return attendees[inviteCode][event.Name]
+}
+
+// readAttendees is the attendees' names by invite code & event name
+func readAttendees() (map[int]map[string][]string, error) {
+	rows, err := getGoogleSheetsData(ATTENDEES, "A2:C")
+	if err != nil {
+		return nil, err
+	}
+	attendees := make(map[int]map[string][]string)
+	for i, row := range rows {
+		if len(row) < 3 {
+			continue
+		}
+		inviteCode, err := strconv.Atoi(fmt.Sprint(row[0]))
+		if err != nil {
+			log.Printf("Skipping attendee entry (%d) as its invite code isn't a number: %v", i+2, row[0])
+			continue
+		}
+		if attendees[inviteCode] == nil {
+			attendees[inviteCode] = make(map[string][]string)
+		}
+		eventName := strings.ToUpper(fmt.Sprint(row[1]))
+		attendees[inviteCode][eventName] = append(attendees[inviteCode][eventName], fmt.Sprint(row[2]))
+	}
+	return attendees, nil
+}
+
+// attendeeNamesResponse asks the Dialogflow guest who's coming, keeping the
+// event (and the override code the RSVP was saved with, if any) in a context
+// for AttendeeNamesFulfillment
+func attendeeNamesResponse(response *DialogflowResponse, inviteCode int, event Event, rsvpCnt int, code string) {
+	attendeesContext := dialogflow.Context{
+		Name:          sessionID + "/contexts/" + ATTENDEES_CONTEXT,
+		LifespanCount: 2,
+		Parameters: &structpb.Struct{Fields: map[string]*structpb.Value{
+			"invite_code":     numberValue(inviteCode),
+			"attendees_event": {Kind: &structpb.Value_StringValue{StringValue: event.Name}},
+		}},
+	}
+	if code != "" {
+		attendeesContext.Parameters.Fields["override_code"] = &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: code}}
+	}
+	response.Text(attendeeNamesPromptMsg(event, rsvpCnt, familyMembers(inviteCode))).Contexts(&attendeesContext)
+}
+
+// AttendeeNamesFulfillment saves the names the guest replied with, updating
+// the RSVP count to match, and carries on with the next event's RSVP
+func AttendeeNamesFulfillment(response *DialogflowResponse, contexts []*dialogflow.Context, text string) {
+	inviteCode := getInviteCodeFromContext(contexts)
+	event, ok := eventByName(getFromContext(contexts, "attendees_event").GetStringValue())
+	if inviteCode == -1 || !ok {
+		log.Fatalf("%s | %s | Couldn't find the invite code or event for the attendees", sessionID, responseID)
+	}
+	log.Printf("\nIntent: %s - Starting fulfillment for invite code: %d", intent, inviteCode)
+
+	invitedFamily := findInvitedFamily(inviteCode)
+	alreadyRsvpdEvents := rsvpdEvents(contexts)
+	code := getOverrideCodeFromContext(contexts)
+	if !isSkipAttendeeNames(text) {
+		members := familyMembers(inviteCode)
+		names, err := parseAttendeeNames(text, members)
+		switch {
+		case err != nil:
+			attendeeNamesResponse(response.Text(DIDNT_UNDERSTAND_MSG), inviteCode, event, alreadyRsvpdEvents[event], code)
+			return
+		case len(names) > invitedFamily.invitedTo(event):
+			attendeeNamesResponse(response.Text(rsvpCountTooHighMsg(event, invitedFamily.invitedTo(event))), inviteCode, event, alreadyRsvpdEvents[event], code)
+			return
+		}
+		var waitlisted []WaitlistEntry
+		if len(names) != alreadyRsvpdEvents[event] {
+			if message, ok := checkRsvpRecountDeadline(inviteCode, event, code); !ok {
+				response.Text(message)
+				return
+			}
+			var saved map[Event]int
+			saved, waitlisted = saveRsvp(inviteCode, getPhoneNumberFromContext(contexts), map[Event]int{event: len(names)}, invitedFamily.recountedChildren(event, len(names)))
+			names = names[:saved[event]] // the rest are on the waitlist
+		}
+		if err := saveAttendees(inviteCode, event, names); err != nil {
+			log.Fatalf("Unable to save the attendees of invite code %d: %v", inviteCode, err)
+		}
+		alreadyRsvpdEvents[event] = len(names)
+		if len(waitlisted) > 0 {
+			waitlistedResponse(response, event, len(names), waitlisted[0])
+			return
+		}
+	}
+	dietaryOrFollowupResponse(response, invitedFamily, event, alreadyRsvpdEvents)
+}
+
+type AttendeeListRow struct {
+	InviteCode int
+	InviteName string
+	Event      string
+	Rsvpd      int
+	Names      []string
+	Unnamed    int // RSVP'd guests without a name
+}
+
+// attendeeList is every family RSVP'd to the event(s) with their attendees' names
+func attendeeList(invitedFamilies []InvitedFamily, attendees map[int]map[string][]string, events []Event) []AttendeeListRow {
+	sort.SliceStable(invitedFamilies, func(i, j int) bool { return invitedFamilies[i].InviteCode < invitedFamilies[j].InviteCode })
+	var rows []AttendeeListRow
+	for _, event := range events {
+		for _, invitedFamily := range invitedFamilies {
+			rsvpd := invitedFamily.rsvpdTo(event)
+			if rsvpd <= 0 {
+				continue
+			}
+			names := attendees[invitedFamily.InviteCode][event.Name]
+			row := AttendeeListRow{InviteCode: invitedFamily.InviteCode, InviteName: invitedFamily.InviteName, Event: event.Name, Rsvpd: rsvpd, Names: names}
+			if unnamed := rsvpd - len(names); unnamed > 0 {
+				row.Unnamed = unnamed
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func writeAttendeeList(writer io.Writer, rows []AttendeeListRow, format string) error {
+	header := []string{"Event", "Invite Code", "Invite Name", "RSVP'd", "Names", "Unnamed"}
+	record := func(row AttendeeListRow) []string {
+		return []string{row.Event, strconv.Itoa(row.InviteCode), row.InviteName, strconv.Itoa(row.Rsvpd), strings.Join(row.Names, ", "), strconv.Itoa(row.Unnamed)}
+	}
+	switch format {
+	case "table":
+		tableWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tableWriter, strings.Join(header, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(tableWriter, strings.Join(record(row), "\t"))
+		}
+		return tableWriter.Flush()
+	case "csv":
+		csvWriter := csv.NewWriter(writer)
+		csvWriter.Write(header)
+		for _, row := range rows {
+			csvWriter.Write(record(row))
+		}
+		csvWriter.Flush()
+		return csvWriter.Error()
+	}
+	return fmt.Errorf("unknown format %q, use table or csv", format)
+}
+
+func attendeeListCommand(args []string) error {
+	flags := flag.NewFlagSet("attendee-list", flag.ExitOnError)
+	eventName := flags.String("event", "", "only list this event, i.e. WEDDING (default all events)")
+	format := flags.String("format", "table", "table or csv")
+	flags.Parse(args)
+
+	events := AllEvents
+	if *eventName != "" {
+		event, ok := eventByName(*eventName)
+		if !ok {
+			return fmt.Errorf("unknown event %q", *eventName)
+		}
+		events = []Event{event}
+	}
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		return err
+	}
+	attendees, err := readAttendees()
+	if err != nil {
+		return err
+	}
+	return writeAttendeeList(os.Stdout, attendeeList(invitedFamilies, attendees, events), *format)
+}
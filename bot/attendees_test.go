@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseAttendeeNames(t *testing.T) {
+	members := []string{"Rajesh", "Priya", "Anil"}
+	tests := map[string]string{
+		"Rajesh, Priya":         "[Rajesh Priya]",
+		"1, 3 & Meena":          "[Rajesh Anil Meena]",
+		"1 2":                   "[Rajesh Priya]",
+		"priya and Meena Patel": "[priya Meena Patel]",
+		"Rajesh, rajesh, 1":     "[Rajesh]",
+		"Meena.":                "[Meena]",
+	}
+	for text, expected := range tests {
+		names, err := parseAttendeeNames(text, members)
+		if err != nil {
+			t.Errorf("Error parsing %q: +%v", text, err)
+			continue
+		}
+		if fmt.Sprint(names) != expected {
+			t.Errorf("Expected %q to parse as %s, got: +%v", text, expected, names)
+		}
+	}
+
+	for _, text := range []string{"4", "1, 0", " , "} {
+		if names, err := parseAttendeeNames(text, members); err == nil {
+			t.Errorf("Expected %q not to parse, got: +%v", text, names)
+		}
+	}
+	if !isSkipAttendeeNames("Skip!") || isSkipAttendeeNames("Rajesh") {
+		t.Errorf("Expected only SKIP to skip")
+	}
+}
+
+func TestAttendeeNamesPromptMsg(t *testing.T) {
+	message := attendeeNamesPromptMsg(Wedding, 2, []string{"Rajesh", "Priya"})
+	if !strings.Contains(message, "1. Rajesh, 2. Priya") || !strings.HasSuffix(message, "Reply SKIP to skip.") {
+		t.Errorf("Unexpected prompt: %s", message)
+	}
+	if message := attendeeNamesPromptMsg(Wedding, 2, nil); strings.Contains(message, "numbers") {
+		t.Errorf("Expected no family member list, got: %s", message)
+	}
+}
+
+func TestConversationNamesEvent(t *testing.T) {
+	conversation := Conversation{Step: STEP_NAMES + Garba.Name}
+	if event, ok := conversation.namesEvent(); !ok || event != Garba {
+		t.Errorf("Expected the Garba names step, got: +%v", event)
+	}
+	if _, ok := conversation.currentEvent(); ok {
+		t.Errorf("Expected the names step not to be an RSVP count step")
+	}
+}
+
+func TestAttendeeList(t *testing.T) {
+	invitedFamilies := []InvitedFamily{
+		{InviteCode: 2, InviteName: "The Shah Family", WeddingInvited: 4, WeddingRsvpd: 3, VidhiRsvpd: NULL_INVITEES},
+		{InviteCode: 1, InviteName: "The Patel Family", WeddingInvited: 2, WeddingRsvpd: 0, VidhiRsvpd: 2},
+	}
+	attendees := map[int]map[string][]string{2: {Wedding.Name: {"Nikhil", "Meena"}}}
+	rows := attendeeList(invitedFamilies, attendees, []Event{Wedding})
+	if len(rows) != 1 || rows[0].InviteCode != 2 || rows[0].Unnamed != 1 {
+		t.Fatalf("Expected only the Shah family with 1 unnamed guest, got: +%v", rows)
+	}
+
+	var buffer bytes.Buffer
+	if err := writeAttendeeList(&buffer, rows, "csv"); err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if !strings.Contains(buffer.String(), `WEDDING,2,The Shah Family,3,"Nikhil, Meena",1`) {
+		t.Errorf("Unexpected csv: %s", buffer.String())
+	}
+}
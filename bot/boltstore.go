@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	FAMILIES_BUCKET   = "families"
+	UPDATE_LOG_BUCKET = "update_log"
+	SYNC_BUCKET       = "sync"
+
+	DEFAULT_BOLT_DB_PATH = "rsvper.db"
+)
+
+// boltStore keeps the families, their invitations & RSVPs and the RSVP update
+// log in an embedded BoltDB file, making each change in a transaction. The
+// spreadsheet is kept up to date by the sync command (see sync.go).
+type boltStore struct {
+	db *bolt.DB
+}
+
+// storedFamily is a family as it's kept in the BoltDB file
+type storedFamily struct {
+	Origin      string                      `json:"origin"`
+	Name        string                      `json:"name"`
+	InviteName  string                      `json:"inviteName"`
+	InviteCode  int                         `json:"inviteCode"`
+	Invitations map[string]storedInvitation `json:"invitations"` // by event name
+
+	// Version goes up with every change made here. SyncedVersion & SyncedRecord
+	// are the version & the INVITED_FAMILY cells as of the last sync, so the
+	// changes made on either side since then can be told apart.
+	Version       int      `json:"version"`
+	SyncedVersion int      `json:"syncedVersion"`
+	SyncedRecord  []string `json:"syncedRecord,omitempty"`
+	// Deleted families are kept until their row is deleted from the sheet
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// storedInvitation is a family's invitation to one event
+type storedInvitation struct {
+	Invited         int `json:"invited"`
+	Rsvpd           int `json:"rsvpd"`
+	ChildrenInvited int `json:"childrenInvited"`
+	ChildrenRsvpd   int `json:"childrenRsvpd"`
+}
+
+func openBoltStore(path string) (*boltStore, error) {
+	// Only one process can have the file open, so don't wait forever for it
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range []string{FAMILIES_BUCKET, UPDATE_LOG_BUCKET, SYNC_BUCKET} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (store *boltStore) Close() error {
+	return store.db.Close()
+}
+
+func (store *boltStore) AllFamilies() ([]InvitedFamily, error) {
+	var invitedFamilies []InvitedFamily
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return forEachStoredFamily(tx, func(family storedFamily) error {
+			if !family.Deleted {
+				invitedFamilies = append(invitedFamilies, family.invitedFamily())
+			}
+			return nil
+		})
+	})
+	return invitedFamilies, err
+}
+
+func (store *boltStore) FindFamily(inviteCode int) (InvitedFamily, bool, error) {
+	var invitedFamily InvitedFamily
+	var found bool
+	err := store.db.View(func(tx *bolt.Tx) error {
+		family, ok, err := getStoredFamily(tx, inviteCode)
+		if ok && !family.Deleted {
+			invitedFamily, found = family.invitedFamily(), true
+		}
+		return err
+	})
+	return invitedFamily, found, err
+}
+
+func (store *boltStore) AddFamily(invitedFamily InvitedFamily) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		family, ok, err := getStoredFamily(tx, invitedFamily.InviteCode)
+		if err != nil {
+			return err
+		}
+		if ok && !family.Deleted {
+			return fmt.Errorf("invite code %d is already used", invitedFamily.InviteCode)
+		}
+		// A deleted family's row may still be in the sheet, so its sync state is kept
+		family.setInvitedFamily(invitedFamily)
+		family.Deleted = false
+		return putStoredFamily(tx, family)
+	})
+}
+
+func (store *boltStore) UpdateFamily(invitedFamily InvitedFamily) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		family, ok, err := getStoredFamily(tx, invitedFamily.InviteCode)
+		if err != nil {
+			return err
+		}
+		if !ok || family.Deleted {
+			return fmt.Errorf("no invited family with invite code %d", invitedFamily.InviteCode)
+		}
+		family.setInvitedFamily(invitedFamily)
+		return putStoredFamily(tx, family)
+	})
+}
+
+func (store *boltStore) DeleteFamily(inviteCode int) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		family, ok, err := getStoredFamily(tx, inviteCode)
+		if err != nil {
+			return err
+		}
+		if !ok || family.Deleted {
+			return fmt.Errorf("no invited family with invite code %d", inviteCode)
+		}
+		if family.SyncedRecord == nil {
+			// It never made it to the sheet
+			return tx.Bucket([]byte(FAMILIES_BUCKET)).Delete(familyKey(inviteCode))
+		}
+		family.Deleted = true
+		family.Version++
+		return putStoredFamily(tx, family)
+	})
+}
+
+// SaveRsvps updates the RSVP counts & logs the RSVPs in one transaction
+func (store *boltStore) SaveRsvps(inviteCode int, phoneNumber string, rsvps map[Event]int, children map[Event]int) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		family, ok, err := getStoredFamily(tx, inviteCode)
+		if err != nil {
+			return err
+		}
+		if !ok || family.Deleted {
+			return fmt.Errorf("no invited family with invite code %d", inviteCode)
+		}
+		invitedFamily := family.invitedFamily()
+		timestamp := time.Now().Format(time.RFC3339Nano)
+		for _, event := range AllEvents {
+			attendees, ok := rsvps[event]
+			if !ok {
+				continue
+			}
+			childrenRsvpd, ok := children[event]
+			if !ok {
+				childrenRsvpd = NULL_INVITEES
+			}
+			invitedFamily.setRsvpd(event, attendees)
+			invitedFamily.setChildrenRsvpd(event, childrenRsvpd)
+			update := RsvpUpdate{
+				InviteCode:   inviteCode,
+				PhoneNumber:  phoneNumber,
+				Event:        event.Name,
+				Attendees:    attendees,
+				Children:     childrenRsvpd,
+				Timestamp:    timestamp,
+				SessionID:    sessionID,
+				OverrideCode: overrideCode,
+			}
+			if err := appendStoredUpdate(tx, update); err != nil {
+				return err
+			}
+		}
+		family.setInvitedFamily(invitedFamily)
+		return putStoredFamily(tx, family)
+	})
+}
+
+func (store *boltStore) RsvpHistory(inviteCode int) ([]RsvpUpdate, error) {
+	var history []RsvpUpdate
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(UPDATE_LOG_BUCKET)).ForEach(func(key []byte, value []byte) error {
+			var update RsvpUpdate
+			if err := json.Unmarshal(value, &update); err != nil {
+				return err
+			}
+			if update.InviteCode == inviteCode {
+				history = append(history, update)
+			}
+			return nil
+		})
+	})
+	return history, err
+}
+
+// setInvitedFamily copies the family's details & invitations, counting it as a change
+func (family *storedFamily) setInvitedFamily(invitedFamily InvitedFamily) {
+	family.Origin, family.Name, family.InviteName, family.InviteCode = invitedFamily.Origin, invitedFamily.Name, invitedFamily.InviteName, invitedFamily.InviteCode
+	family.Invitations = make(map[string]storedInvitation)
+	for _, event := range AllEvents {
+		family.Invitations[event.Name] = storedInvitation{
+			Invited:         invitedFamily.invitedTo(event),
+			Rsvpd:           invitedFamily.rsvpdTo(event),
+			ChildrenInvited: invitedFamily.childrenInvitedTo(event),
+			ChildrenRsvpd:   invitedFamily.childrenRsvpdTo(event),
+		}
+	}
+	family.Version++
+}
+
+func (family storedFamily) invitedFamily() InvitedFamily {
+	invitedFamily := InvitedFamily{Origin: family.Origin, Name: family.Name, InviteName: family.InviteName, InviteCode: family.InviteCode}
+	for _, event := range AllEvents {
+		invitation, ok := family.Invitations[event.Name]
+		if !ok {
+			invitation.Rsvpd, invitation.ChildrenRsvpd = NULL_INVITEES, NULL_INVITEES
+		}
+		invitedFamily.setInvited(event, invitation.Invited)
+		invitedFamily.setRsvpd(event, invitation.Rsvpd)
+		invitedFamily.setChildrenInvited(event, invitation.ChildrenInvited)
+		invitedFamily.setChildrenRsvpd(event, invitation.ChildrenRsvpd)
+	}
+	return invitedFamily
+}
+
+// familyKey is big endian so the families are kept in invite code order
+func familyKey(inviteCode int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(inviteCode))
+	return key
+}
+
+func getStoredFamily(tx *bolt.Tx, inviteCode int) (storedFamily, bool, error) {
+	var family storedFamily
+	value := tx.Bucket([]byte(FAMILIES_BUCKET)).Get(familyKey(inviteCode))
+	if value == nil {
+		return family, false, nil
+	}
+	err := json.Unmarshal(value, &family)
+	return family, err == nil, err
+}
+
+func putStoredFamily(tx *bolt.Tx, family storedFamily) error {
+	value, err := json.Marshal(family)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(FAMILIES_BUCKET)).Put(familyKey(family.InviteCode), value)
+}
+
+func forEachStoredFamily(tx *bolt.Tx, fn func(family storedFamily) error) error {
+	return tx.Bucket([]byte(FAMILIES_BUCKET)).ForEach(func(key []byte, value []byte) error {
+		var family storedFamily
+		if err := json.Unmarshal(value, &family); err != nil {
+			return fmt.Errorf("unable to read invite code %d: %v", binary.BigEndian.Uint64(key), err)
+		}
+		return fn(family)
+	})
+}
+
+// appendStoredUpdate adds the RSVP to the end of the update log
+func appendStoredUpdate(tx *bolt.Tx, update RsvpUpdate) error {
+	bucket := tx.Bucket([]byte(UPDATE_LOG_BUCKET))
+	sequence, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, sequence)
+	return bucket.Put(key, value)
+}
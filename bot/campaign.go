@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+const (
+	PHONE_DIRECTORY = "PHONE_DIRECTORY"
+
+	INVITATION_SENT   = "SENT"
+	INVITATION_FAILED = "FAILED"
+)
+
+// PhoneDirectoryEntry is a phone number to text for an invited family. A
+// family can have more than one.
+type PhoneDirectoryEntry struct {
+	InviteCode       int
+	PhoneNumber      string
+	InvitationStatus string
+	rowNumber        int
+}
+
+type invitationStatusWriter func(entry PhoneDirectoryEntry, status string, details string) error
+
+type campaignSummary struct {
+	Sent    int
+	Failed  int
+	Skipped int
+}
+
+func sendInvitationsCommand(args []string) error {
+	flags := flag.NewFlagSet("send-invitations", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "print the invitations instead of sending them (nothing is written to the sheet)")
+	providerName := flags.String("provider", "twilio", "sms provider: twilio, stdout or file")
+	outputFile := flags.String("out", "invitations.txt", "file the invitations are written to when -provider=file")
+	resend := flags.Bool("resend", false, "send again to phone numbers that were already sent their invitation")
+	inviteCode := flags.Int("invite-code", 0, "only send to the family with this invite code")
+	flags.Parse(args)
+
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		return err
+	}
+	directory, err := getPhoneDirectory()
+	if err != nil {
+		return err
+	}
+	if *inviteCode != 0 {
+		var filtered []PhoneDirectoryEntry
+		for _, entry := range directory {
+			if entry.InviteCode == *inviteCode {
+				filtered = append(filtered, entry)
+			}
+		}
+		directory = filtered
+	}
+
+	var provider SmsProvider = &WriterSmsProvider{Writer: os.Stdout}
+	writeStatus := writeInvitationStatus
+	if *dryRun {
+		writeStatus = func(entry PhoneDirectoryEntry, status string, details string) error { return nil }
+	} else if provider, err = newSmsProvider(*providerName, *outputFile); err != nil {
+		return err
+	}
+
+	summary := sendInvitations(provider, invitedFamilies, directory, *resend, writeStatus)
+	log.Printf("Invitations sent: %d, failed: %d, skipped: %d", summary.Sent, summary.Failed, summary.Skipped)
+	if summary.Failed > 0 {
+		return fmt.Errorf("%d invitations failed, run send-invitations again to retry them", summary.Failed)
+	}
+	return nil
+}
+
+// sendInvitations texts each phone number its family's invitation. Numbers
+// that were already sent their invitation are skipped (unless resend is set),
+// so a partially failed campaign can be resumed by running it again.
+func sendInvitations(provider SmsProvider, invitedFamilies []InvitedFamily, directory []PhoneDirectoryEntry, resend bool, writeStatus invitationStatusWriter) campaignSummary {
+	familiesByInviteCode := make(map[int]InvitedFamily)
+	for _, family := range invitedFamilies {
+		familiesByInviteCode[family.InviteCode] = family
+	}
+
+	var summary campaignSummary
+	for _, entry := range directory {
+		if entry.InvitationStatus == INVITATION_SENT && !resend {
+			summary.Skipped++
+			continue
+		}
+
+		family, ok := familiesByInviteCode[entry.InviteCode]
+		if !ok {
+			log.Printf("No invited family for invite code %d (phone number %s)", entry.InviteCode, entry.PhoneNumber)
+			summary.Failed++
+			logStatusError(writeStatus(entry, INVITATION_FAILED, "no invited family with this invite code"))
+			continue
+		}
+
+		messageID, err := provider.SendSms(entry.PhoneNumber, invitationSmsMsg(family))
+		if err != nil {
+			log.Printf("Unable to send the invitation for invite code %d to %s: %v", entry.InviteCode, entry.PhoneNumber, err)
+			summary.Failed++
+			logStatusError(writeStatus(entry, INVITATION_FAILED, err.Error()))
+			continue
+		}
+		summary.Sent++
+		logStatusError(writeStatus(entry, INVITATION_SENT, messageID))
+	}
+	return summary
+}
+
+func logStatusError(err error) {
+	if err != nil {
+		log.Printf("Unable to save the invitation status: %v", err)
+	}
+}
+
+func getPhoneDirectory() ([]PhoneDirectoryEntry, error) {
+	rows, err := getGoogleSheetsData(PHONE_DIRECTORY, "A2:C")
+	if err != nil {
+		return nil, err
+	}
+
+	var directory []PhoneDirectoryEntry
+	for i, row := range rows {
+		if len(row) < 2 {
+			continue
+		}
+		inviteCode, err := strconv.Atoi(fmt.Sprint(row[0]))
+		if err != nil {
+			log.Printf("Skipping phone directory entry (%d) as its invite code isn't a number: %v", i+2, row[0])
+			continue
+		}
+		entry := PhoneDirectoryEntry{InviteCode: inviteCode, PhoneNumber: strings.TrimSpace(fmt.Sprint(row[1])), rowNumber: i + 2}
+		if len(row) > 2 {
+			entry.InvitationStatus = fmt.Sprint(row[2])
+		}
+		directory = append(directory, entry)
+	}
+	return directory, nil
+}
+
+// writeInvitationStatus saves the status right away, so nothing is resent if the campaign stops part way through
+func writeInvitationStatus(entry PhoneDirectoryEntry, status string, details string) error {
+	row := strconv.Itoa(entry.rowNumber)
+	writeRange := PHONE_DIRECTORY + "!C" + row + ":E" + row
+	_, err := setGoogleSheetsData([]*sheets.ValueRange{{Values: [][]interface{}{{status, time.Now(), details}}, Range: writeRange}})
+	return err
+}
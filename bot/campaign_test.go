@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+type mockSmsProvider struct {
+	failFor map[string]bool
+	sent    map[string]string
+}
+
+func (provider *mockSmsProvider) SendSms(to string, body string) (string, error) {
+	if provider.failFor[to] {
+		return "", errors.New("undeliverable")
+	}
+	provider.sent[to] = body
+	return "SM" + to, nil
+}
+
+func TestSendInvitations(t *testing.T) {
+	families := []InvitedFamily{
+		{InviteName: "The Patel Family", InviteCode: 1, WeddingInvited: 4},
+		{InviteName: "The Shah Family", InviteCode: 2, GarbaInvited: MAX_INVITEES},
+	}
+	directory := []PhoneDirectoryEntry{
+		{InviteCode: 1, PhoneNumber: "+15555550101", InvitationStatus: INVITATION_SENT},
+		{InviteCode: 1, PhoneNumber: "+15555550102"},
+		{InviteCode: 2, PhoneNumber: "+15555550103", InvitationStatus: INVITATION_FAILED},
+		{InviteCode: 3, PhoneNumber: "+15555550104"},
+	}
+	provider := &mockSmsProvider{failFor: map[string]bool{"+15555550103": true}, sent: make(map[string]string)}
+	statuses := make(map[string]string)
+	writeStatus := func(entry PhoneDirectoryEntry, status string, details string) error {
+		statuses[entry.PhoneNumber] = status
+		return nil
+	}
+
+	summary := sendInvitations(provider, families, directory, false, writeStatus)
+	if summary != (campaignSummary{Sent: 1, Failed: 2, Skipped: 1}) {
+		t.Errorf("Unexpected summary: +%v", summary)
+	}
+	if statuses["+15555550102"] != INVITATION_SENT || statuses["+15555550103"] != INVITATION_FAILED || statuses["+15555550104"] != INVITATION_FAILED {
+		t.Errorf("Unexpected statuses: +%v", statuses)
+	}
+	if _, ok := statuses["+15555550101"]; ok {
+		t.Error("Expected the already sent invitation to be skipped")
+	}
+
+	expected := "Hi The Patel Family! You're invited to: \nWEDDING: 4\nYour invite code is 1. Reply with your invite code to RSVP."
+	if provider.sent["+15555550102"] != expected {
+		t.Errorf("Expected invitation: %q, got: %q", expected, provider.sent["+15555550102"])
+	}
+}
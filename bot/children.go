@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// childrenColumns are the INVITED_FAMILY columns of the events that count
+// children, i.e. Vidhi-Children-Invite & Vidhi-Children-RSVP'd
+func childrenColumns() []string {
+	var columns []string
+	for _, event := range AllEvents {
+		if event.CountsChildren {
+			columns = append(columns, eventColumnName(event, "Children-Invite"), eventColumnName(event, "Children-RSVP'd"))
+		}
+	}
+	return columns
+}
+
+// invitedSplit is how many adults & children of the family are invited to
+// the event. The children are part of the invited count, so 4 invited with 1
+// child invited is 3 adults & 1 child; ALL children lets any of the invited be
+// children.
+func (invitedFamily *InvitedFamily) invitedSplit(event Event) (int, int) {
+	invited, children := invitedFamily.invitedTo(event), invitedFamily.childrenInvitedTo(event)
+	switch {
+	case invited == MAX_INVITEES:
+		return MAX_INVITEES, children
+	case children == MAX_INVITEES || children > invited:
+		return invited, invited
+	}
+	return invited - children, children
+}
+
+// checkRsvpSplit returns false, along with the message to send back, when
+// there are more adults or children than are invited to the event
+func (invitedFamily *InvitedFamily) checkRsvpSplit(event Event, adults int, children int) (string, bool) {
+	invitedAdults, invitedChildren := invitedFamily.invitedSplit(event)
+	switch {
+	case adults > invitedAdults:
+		return fmt.Sprintf("Sorry, only %d adults from your family are invited to the %s.", invitedAdults, event.DisplayName), false
+	case children > invitedChildren:
+		return fmt.Sprintf("Sorry, only %d children from your family are invited to the %s.", invitedChildren, event.DisplayName), false
+	case adults+children > invitedFamily.invitedTo(event):
+		return rsvpCountTooHighMsg(event, invitedFamily.invitedTo(event)), false
+	}
+	return "", true
+}
+
+// recountedChildren is how many children are left when the event's RSVP
+// count changes without asking again (i.e. after the attendees' names), which
+// is unknown for events that don't count children
+func (invitedFamily *InvitedFamily) recountedChildren(event Event, rsvpd int) map[Event]int {
+	children := invitedFamily.childrenRsvpdTo(event)
+	if !event.CountsChildren || children == NULL_INVITEES {
+		return nil
+	}
+	if children > rsvpd {
+		children = rsvpd
+	}
+	return map[Event]int{event: children}
+}
+
+// formatChildrenCell is the UPDATE_EVENT children cell, empty when the RSVP
+// wasn't split
+func formatChildrenCell(children map[Event]int, event Event) interface{} {
+	if count, ok := children[event]; ok {
+		return count
+	}
+	return ""
+}
+
+// parseChildrenCell reads the UPDATE_EVENT children cell
+func parseChildrenCell(cell interface{}) int {
+	children, err := strconv.Atoi(fmt.Sprint(cell))
+	if err != nil {
+		return NULL_INVITEES
+	}
+	return children
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/struct"
+)
+
+// countWeddingChildren turns on counting children for the wedding, until the
+// returned func is called
+func countWeddingChildren() func() {
+	previousWedding, previousEvents := Wedding, AllEvents
+	Wedding.CountsChildren = true
+	AllEvents = []Event{Vidhi, Garba, Wedding}
+	return func() { Wedding, AllEvents = previousWedding, previousEvents }
+}
+
+func TestInvitedSplit(t *testing.T) {
+	defer countWeddingChildren()()
+	tests := []struct {
+		invited, childrenInvited int
+		adults, children         int
+	}{
+		{4, 1, 3, 1},
+		{4, 0, 4, 0},
+		{4, MAX_INVITEES, 4, 4},
+		{MAX_INVITEES, 2, MAX_INVITEES, 2},
+	}
+	for _, test := range tests {
+		invitedFamily := InvitedFamily{WeddingInvited: test.invited, WeddingChildrenInvited: test.childrenInvited}
+		if adults, children := invitedFamily.invitedSplit(Wedding); adults != test.adults || children != test.children {
+			t.Errorf("Expected %d invited with %d children to be %d adults & %d children, got: %d & %d", test.invited, test.childrenInvited, test.adults, test.children, adults, children)
+		}
+	}
+
+	invitedFamily := InvitedFamily{WeddingInvited: 4, WeddingChildrenInvited: MAX_INVITEES}
+	if _, ok := invitedFamily.checkRsvpSplit(Wedding, 2, 2); !ok {
+		t.Errorf("Expected 2 adults & 2 children to fit")
+	}
+	if message, ok := invitedFamily.checkRsvpSplit(Wedding, 3, 2); ok || !strings.Contains(message, "only 4 people") {
+		t.Errorf("Expected 5 guests not to fit, got: %s", message)
+	}
+	invitedFamily.WeddingChildrenInvited = 1
+	if message, ok := invitedFamily.checkRsvpSplit(Wedding, 2, 2); ok || !strings.Contains(message, "only 1 children") {
+		t.Errorf("Expected 2 children not to fit, got: %s", message)
+	}
+}
+
+func TestGetRsvpCountsWithChildren(t *testing.T) {
+	defer countWeddingChildren()()
+	values := map[string]*structpb.Value{
+		"wedding_rsvpd":             numberValue(2),
+		"wedding_children":          numberValue(1),
+		"wedding_children.original": {Kind: &structpb.Value_StringValue{StringValue: "one"}},
+		"vidhi_rsvpd":               numberValue(3),
+		"vidhi_children":            numberValue(1),
+	}
+	if adults, children := getRsvpCounts(Wedding, values); adults != 2 || children != 1 {
+		t.Errorf("Expected 2 adults & 1 child, got: %d & %d", adults, children)
+	}
+	if rsvpd, children := getRsvpCounts(Vidhi, values); rsvpd != 3 || children != -1 {
+		t.Errorf("Expected the Vidhi not to count children, got: %d & %d", rsvpd, children)
+	}
+}
+
+func TestSmsChildrenStep(t *testing.T) {
+	defer countWeddingChildren()()
+	defer useMemoryStore(InvitedFamily{InviteCode: 7, WeddingInvited: 4, WeddingChildrenInvited: 2, WeddingRsvpd: NULL_INVITEES, VidhiRsvpd: NULL_INVITEES, GarbaRsvpd: NULL_INVITEES})()
+
+	conversation := Conversation{InviteCode: 7, Step: STEP_RSVP + Wedding.Name, Rsvps: make(map[Event]int)}
+	if message := smsFulfillment(&conversation, smsInput{kind: SMS_NUMBER, number: 3}, "3"); !strings.Contains(message, "only 2 adults") {
+		t.Errorf("Expected 3 adults to be too many, got: %s", message)
+	}
+	if message := smsFulfillment(&conversation, smsInput{kind: SMS_NUMBER, number: 2}, "2"); conversation.Step != STEP_CHILDREN+Wedding.Name {
+		t.Errorf("Expected to be asked for the children, got: %s", message)
+	}
+	smsFulfillment(&conversation, smsInput{kind: SMS_NUMBER, number: 1}, "1")
+
+	invitedFamily, _, _ := guestStore.FindFamily(7)
+	if invitedFamily.WeddingRsvpd != 3 || invitedFamily.WeddingChildrenRsvpd != 1 || conversation.Rsvps[Wedding] != 3 {
+		t.Errorf("Expected 3 RSVP'd with 1 child, got: +%v", invitedFamily)
+	}
+	if history, _ := guestStore.RsvpHistory(7); len(history) != 1 || history[0].Children != 1 {
+		t.Errorf("Expected the children in the RSVP history, got: +%v", history)
+	}
+
+	recounted := invitedFamily.recountedChildren(Wedding, 0)
+	if recounted[Wedding] != 0 {
+		t.Errorf("Expected no children left of 0 guests, got: +%v", recounted)
+	}
+}
+
+func TestHeadcountReportChildren(t *testing.T) {
+	defer countWeddingChildren()()
+	families := []InvitedFamily{
+		{InviteCode: 1, WeddingInvited: 4, WeddingRsvpd: 4, WeddingChildrenRsvpd: 1},
+		{InviteCode: 2, WeddingInvited: 2, WeddingRsvpd: 2, WeddingChildrenRsvpd: NULL_INVITEES},
+	}
+	for _, row := range headcountReport(families) {
+		if row.Event == Wedding.Name && (row.Rsvpd != 6 || row.Adults != 5 || row.Children != 1) {
+			t.Errorf("Expected 5 adults & 1 child, got: +%v", row)
+		}
+	}
+}
+
+func TestVoiceChildrenStep(t *testing.T) {
+	defer countWeddingChildren()()
+	defer useMemoryStore(InvitedFamily{InviteCode: 7, WeddingInvited: 4, WeddingChildrenInvited: 2, WeddingRsvpd: NULL_INVITEES, VidhiRsvpd: NULL_INVITEES, GarbaRsvpd: NULL_INVITEES})()
+
+	query := voiceRsvpQuery(findInvitedFamily(7), Wedding, make(map[Event]int))
+	if response := voiceRsvpFulfillment(query, "+15555550100", "3"); !strings.Contains(response.Body, "only 2 adults") {
+		t.Errorf("Expected 3 adults to be too many, got: %s", response.Body)
+	}
+	response := voiceRsvpFulfillment(query, "+15555550100", "2")
+	if !strings.Contains(response.Body, "step=children") || !strings.Contains(response.Body, "how many children") {
+		t.Fatalf("Expected to be asked for the children, got: %s", response.Body)
+	}
+	childrenQuery := voiceChildrenQuery(findInvitedFamily(7), Wedding, make(map[Event]int), 2)
+	if response := voiceChildrenFulfillment(childrenQuery, "+15555550100", "3"); !strings.Contains(response.Body, "only 2 children") {
+		t.Errorf("Expected 3 children to be too many, got: %s", response.Body)
+	}
+	voiceChildrenFulfillment(childrenQuery, "+15555550100", "1")
+
+	invitedFamily, _, _ := guestStore.FindFamily(7)
+	if invitedFamily.WeddingRsvpd != 3 || invitedFamily.WeddingChildrenRsvpd != 1 {
+		t.Errorf("Expected 3 RSVP'd with 1 child, got: +%v", invitedFamily)
+	}
+}
+
+func TestAdminRsvpKeepsChildren(t *testing.T) {
+	defer countWeddingChildren()()
+	defer useMemoryStore(InvitedFamily{InviteCode: 7, WeddingInvited: 4, WeddingChildrenInvited: 2, WeddingRsvpd: 4, WeddingChildrenRsvpd: 2, VidhiRsvpd: NULL_INVITEES, GarbaRsvpd: NULL_INVITEES})()
+
+	if _, err := adminSetRsvps(7, `{"WEDDING": 3}`); err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	invitedFamily, _, _ := guestStore.FindFamily(7)
+	if invitedFamily.WeddingRsvpd != 3 || invitedFamily.WeddingChildrenRsvpd != 2 {
+		t.Errorf("Expected the host's RSVP to keep the 2 children, got: +%v", invitedFamily)
+	}
+}
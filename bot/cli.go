@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// Command is run from the command line instead of as the lambda function, i.e.
+// `bin/bot send-invitations -dry-run`
+type Command struct {
+	Name        string
+	Description string
+	Run         func(args []string) error
+}
+
+var commands = []Command{
+	{Name: "send-invitations", Description: "text each family in PHONE_DIRECTORY their invitation", Run: sendInvitationsCommand},
+	{Name: "send-reminders", Description: "text the families that haven't RSVP'd yet a reminder (on the REMINDER_DAYS)", Run: sendRemindersCommand},
+	{Name: "issue-override-code", Description: "create a one-time code that lets a family change their RSVP after the deadline", Run: issueOverrideCodeCommand},
+	{Name: "headcount-report", Description: "total the invited, RSVP'd, declined & outstanding guests of each event, by origin", Run: headcountReportCommand},
+	{Name: "attendee-list", Description: "list the attendees' names of each family RSVP'd to each event, for the door", Run: attendeeListCommand},
+	{Name: "caterer-report", Description: "total the dietary needs of each event's RSVP'd guests by meal option, for the caterers", Run: catererReportCommand},
+	{Name: "accessibility-report", Description: "list the accessibility needs of the families coming to each event", Run: accessibilityReportCommand},
+	{Name: "pickup-schedule", Description: "list the out-of-town families to pick up from the airport, by arrival date & time", Run: pickupScheduleCommand},
+	{Name: "allocate-rooms", Description: "propose hotel block rooms for the families that asked for them in TRAVEL, within the block's limits", Run: allocateRoomsCommand},
+	{Name: "assign-room", Description: "assign a family's hotel rooms by hand, replacing their assignment", Run: assignRoomCommand},
+	{Name: "notify-rooms", Description: "text each family with new room assignments their hotel booking details", Run: notifyRoomsCommand},
+	{Name: "shuttle-manifest", Description: "plan the shuttle runs from the hotels to each event & list who's on each", Run: shuttleManifestCommand},
+	{Name: "carpool-matches", Description: "pair the local families needing a ride to an event with the ones driving from the same origin", Run: carpoolMatchesCommand},
+	{Name: "assign-seats", Description: "propose tables for the families coming to each event that aren't seated yet, within SEATING_RULE", Run: assignSeatsCommand},
+	{Name: "seating-chart", Description: "list who's at each table from SEATING_ASSIGNMENT", Run: seatingChartCommand},
+	{Name: "place-cards", Description: "write a printable html page of place cards from SEATING_ASSIGNMENT", Run: placeCardsCommand},
+	{Name: "waitlist", Description: "list each event's RSVP'd total, capacity & waitlist", Run: waitlistCommand},
+	{Name: "promote-waitlist", Description: "give the free seats at each event to the waitlisted families & text them", Run: promoteWaitlistCommand},
+	{Name: "lint", Description: "check INVITED_FAMILY & UPDATE_EVENT for cells & rows the bot can't read", Run: lintCommand},
+	{Name: "import-families", Description: "validate a guest list csv, show the changes & add or update the families in INVITED_FAMILY", Run: importFamiliesCommand},
+	{Name: "export-families", Description: "write the guest list & latest RSVPs as a csv import-families can read", Run: exportFamiliesCommand},
+	{Name: "serve", Description: "run the bot as an http server instead of a lambda function, syncing the bolt store in the background (GUEST_STORE=bolt)", Run: serveCommand},
+	{Name: "sync", Description: "push the bolt store's changes to the spreadsheet & pull the hosts' edits back (GUEST_STORE=bolt)", Run: syncCommand},
+	{Name: "sync-status", Description: "show the last sync, the changes waiting to be pushed & the conflicts", Run: syncStatusCommand},
+	{Name: "index-invite-codes", Description: "rebuild the INVITED_FAMILY invite code index, i.e. after codes are edited by hand", Run: indexInviteCodesCommand},
+}
+
+func runCommand(args []string) {
+	for _, command := range commands {
+		if command.Name == args[0] {
+			if err := command.Run(args[1:]); err != nil {
+				log.Fatalf("%s failed: %v", command.Name, err)
+			}
+			return
+		}
+	}
+
+	if args[0] != "help" && args[0] != "-h" {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", args[0])
+	}
+	fmt.Fprintf(os.Stderr, "Usage: bot <command> [flags]\n\nCommands:\n")
+	for _, command := range commands {
+		fmt.Fprintf(os.Stderr, "  %-20s %s\n", command.Name, command.Description)
+	}
+	os.Exit(2)
+}
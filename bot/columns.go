@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// defaultColumnAliases are other names the INVITED_FAMILY headers go by. More
+// can be added with the COLUMN_ALIASES environment variable, i.e.
+// COLUMN_ALIASES="Invite Code=Code #|Invitation;Origin=From"
+var defaultColumnAliases = map[string][]string{
+	"Name":        {"Family Name"},
+	"Invite Name": {"Name On Invite", "Name On Invitation"},
+	"Invite Code": {"Code", "Invite #", "Invitation Code"},
+}
+
+// guestListColumns are the INVITED_FAMILY columns, in order, as named in the README
+func guestListColumns() []string {
+	columns := []string{"Origin", "Name", "Invite Name", "Invite Code"}
+	for _, event := range AllEvents {
+		columns = append(columns, eventColumnName(event, "Invite"), eventColumnName(event, "RSVP'd"))
+	}
+	return append(columns, childrenColumns()...)
+}
+
+// eventColumnName is i.e. Vidhi-Invite
+func eventColumnName(event Event, suffix string) string {
+	name := strings.ToLower(event.Name)
+	return strings.ToUpper(name[:1]) + name[1:] + "-" + suffix
+}
+
+// ColumnMap is the 0-based position of each INVITED_FAMILY column in the
+// sheet, keyed by the column's name in the README (i.e. Vidhi-RSVP'd)
+type ColumnMap map[string]int
+
+// newColumnMap finds the columns in the header row, by name or alias. Headers
+// are compared ignoring case, spaces & punctuation, so "vidhi rsvpd" is
+// Vidhi-RSVP'd. It returns the columns it couldn't find.
+func newColumnMap(header []interface{}, columns []string) (ColumnMap, []string) {
+	positions := make(map[string]int)
+	for i, cell := range header {
+		if _, ok := positions[normalizeHeader(fmt.Sprint(cell))]; !ok {
+			positions[normalizeHeader(fmt.Sprint(cell))] = i
+		}
+	}
+
+	aliases := columnAliases()
+	columnMap := make(ColumnMap)
+	var missing []string
+	for _, column := range columns {
+		for _, name := range append([]string{column}, aliases[column]...) {
+			if position, ok := positions[normalizeHeader(name)]; ok {
+				columnMap[column] = position
+				break
+			}
+		}
+		if _, ok := columnMap[column]; !ok {
+			missing = append(missing, column)
+		}
+	}
+	return columnMap, missing
+}
+
+func columnAliases() map[string][]string {
+	aliases := make(map[string][]string)
+	for column, names := range defaultColumnAliases {
+		aliases[column] = append(aliases[column], names...)
+	}
+	for _, entry := range strings.Split(os.Getenv("COLUMN_ALIASES"), ";") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		column := strings.TrimSpace(parts[0])
+		for _, name := range strings.Split(parts[1], "|") {
+			aliases[column] = append(aliases[column], strings.TrimSpace(name))
+		}
+	}
+	return aliases
+}
+
+func normalizeHeader(header string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '#' {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, header)
+}
+
+// cell is the row's value for the column, or "" when the row is too short to
+// have it (the sheets lib omits trailing empty cells)
+func (columns ColumnMap) cell(row []interface{}, column string) interface{} {
+	if position, ok := columns[column]; ok && position < len(row) {
+		return row[position]
+	}
+	return ""
+}
+
+// letter is the spreadsheet letter of the column, i.e. F
+func (columns ColumnMap) letter(column string) string {
+	return columnLetter(columns[column])
+}
+
+// width is the number of cells up to & including the last mapped column
+func (columns ColumnMap) width() int {
+	width := 0
+	for _, position := range columns {
+		if position >= width {
+			width = position + 1
+		}
+	}
+	return width
+}
+
+// columnLetter is the spreadsheet letter of the 0-based column, i.e. 4 is E
+func columnLetter(col int) string {
+	letter := string(rune('A' + col%26))
+	if col >= 26 {
+		return columnLetter(col/26-1) + letter
+	}
+	return letter
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestNewColumnMap(t *testing.T) {
+	os.Setenv("COLUMN_ALIASES", "Origin=From|Hometown")
+	defer os.Unsetenv("COLUMN_ALIASES")
+
+	header := []interface{}{"Notes", "Hometown", "Family Name", "Name on Invite", "Invite #", "Vidhi Invite", "vidhi rsvpd", "Garba-Invite", "Garba-RSVP'd", "Extra", "WEDDING-INVITE", "Wedding RSVP'd"}
+	columns, missing := newColumnMap(header, guestListColumns())
+	if len(missing) > 0 {
+		t.Fatalf("Expected all the columns to be found, missing: +%v", missing)
+	}
+	expected := map[string]string{"Origin": "B", "Name": "C", "Invite Code": "E", "Vidhi-RSVP'd": "G", "Wedding-RSVP'd": "L"}
+	for column, letter := range expected {
+		if columns.letter(column) != letter {
+			t.Errorf("Expected %s to be col %s, got: %s", column, letter, columns.letter(column))
+		}
+	}
+	if columns.width() != 12 {
+		t.Errorf("Expected the columns to span 12 cells, got: %d", columns.width())
+	}
+
+	row := []interface{}{"", "Mumbai", "Rakesh", "The Patel Family", "7", "4", "NULL", "NULL", "NULL", "", "2", "2"}
+	invitedFamily, err := toInvitedFamily(row, columns)
+	if err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if invitedFamily.Origin != "Mumbai" || invitedFamily.InviteCode != 7 || invitedFamily.VidhiInvited != 4 || invitedFamily.WeddingRsvpd != 2 {
+		t.Errorf("Unexpected invited family: +%v", invitedFamily)
+	}
+
+	if _, missing := newColumnMap([]interface{}{"Origin", "Name"}, guestListColumns()); len(missing) != 8 {
+		t.Errorf("Expected 8 missing columns, got: +%v", missing)
+	}
+}
+
+func TestColumnLetter(t *testing.T) {
+	for col, expected := range map[int]string{0: "A", 9: "J", 25: "Z", 26: "AA", 27: "AB", 52: "BA"} {
+		if letter := columnLetter(col); letter != expected {
+			t.Errorf("Expected column %d to be %s, got: %s", col, expected, letter)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+const (
+	CONVERSATION = "CONVERSATION"
+
+	// Steps of the SMS conversation
+	STEP_START    = ""
+	STEP_CONFIRM  = "CONFIRM"
+	STEP_RSVP     = "RSVP:"     // followed by the event name, i.e. RSVP:VIDHI
+	STEP_NAMES    = "NAMES:"    // the attendees' names for the event, i.e. NAMES:VIDHI
+	STEP_DIETARY  = "DIETARY:"  // the attendees' dietary needs for the event, i.e. DIETARY:VIDHI
+	STEP_CHILDREN = "CHILDREN:" // the children coming to the event, after the adults, i.e. CHILDREN:VIDHI
+
+	STEP_ACCESSIBILITY = "ACCESSIBILITY" // the family's accessibility needs, after the last event's RSVP
+	STEP_TRAVEL        = "TRAVEL:"       // followed by the travel question, i.e. TRAVEL:ARRIVAL
+)
+
+// Conversation is the state of an SMS conversation, saved in the CONVERSATION
+// sheet since we don't have Dialogflow's contexts to keep it for us
+type Conversation struct {
+	PhoneNumber  string
+	InviteCode   int
+	Step         string
+	Rsvps        map[Event]int
+	OverrideCode string
+	rowNumber    int
+}
+
+func (conversation *Conversation) currentEvent() (Event, bool) {
+	if !strings.HasPrefix(conversation.Step, STEP_RSVP) {
+		return Event{}, false
+	}
+	return eventByName(strings.TrimPrefix(conversation.Step, STEP_RSVP))
+}
+
+// namesEvent is the event we're asking for the attendees' names of
+func (conversation *Conversation) namesEvent() (Event, bool) {
+	if !strings.HasPrefix(conversation.Step, STEP_NAMES) {
+		return Event{}, false
+	}
+	return eventByName(strings.TrimPrefix(conversation.Step, STEP_NAMES))
+}
+
+// childrenEvent is the event we're asking how many children are coming to
+func (conversation *Conversation) childrenEvent() (Event, bool) {
+	if !strings.HasPrefix(conversation.Step, STEP_CHILDREN) {
+		return Event{}, false
+	}
+	return eventByName(strings.TrimPrefix(conversation.Step, STEP_CHILDREN))
+}
+
+// dietaryEvent is the event we're asking for the attendees' dietary needs of
+func (conversation *Conversation) dietaryEvent() (Event, bool) {
+	if !strings.HasPrefix(conversation.Step, STEP_DIETARY) {
+		return Event{}, false
+	}
+	return eventByName(strings.TrimPrefix(conversation.Step, STEP_DIETARY))
+}
+
+// travelQuestion is the travel question we're asking, i.e. TRAVEL_ARRIVAL
+func (conversation *Conversation) travelQuestion() (string, bool) {
+	if !strings.HasPrefix(conversation.Step, STEP_TRAVEL) {
+		return "", false
+	}
+	return strings.TrimPrefix(conversation.Step, STEP_TRAVEL), true
+}
+
+// findConversation returns the conversation for the given phone number, or a
+// new one if they haven't texted us before
+func findConversation(phoneNumber string) (Conversation, error) {
+	conversation := Conversation{PhoneNumber: phoneNumber, Rsvps: make(map[Event]int)}
+	rows, err := getGoogleSheetsData(CONVERSATION, "A2:F")
+	if err != nil {
+		return conversation, err
+	}
+
+	for i, row := range rows {
+		if len(row) == 0 || fmt.Sprint(row[0]) != phoneNumber {
+			continue
+		}
+		conversation.rowNumber = i + 2 // 1 for header & 1 to convert from 0-based to 1-based
+		if len(row) > 1 {
+			conversation.InviteCode, _ = strconv.Atoi(fmt.Sprint(row[1]))
+		}
+		if len(row) > 2 {
+			conversation.Step = fmt.Sprint(row[2])
+		}
+		if len(row) > 3 {
+			conversation.Rsvps = parseConversationRsvps(fmt.Sprint(row[3]))
+		}
+		if len(row) > 5 {
+			conversation.OverrideCode = fmt.Sprint(row[5])
+		}
+		break
+	}
+	return conversation, nil
+}
+
+func saveConversation(conversation Conversation) error {
+	row := []interface{}{conversation.PhoneNumber, conversation.InviteCode, conversation.Step, formatConversationRsvps(conversation.Rsvps), time.Now(), conversation.OverrideCode}
+	if conversation.rowNumber == 0 {
+		resp, err := appendGoogleSheetsData(CONVERSATION, [][]interface{}{row})
+		if err == nil {
+			log.Printf("Http status code for appending a conversation: +%v", resp.HTTPStatusCode)
+		}
+		return err
+	}
+
+	writeRange := CONVERSATION + "!A" + strconv.Itoa(conversation.rowNumber) + ":F" + strconv.Itoa(conversation.rowNumber)
+	resp, err := setGoogleSheetsData([]*sheets.ValueRange{{Values: [][]interface{}{row}, Range: writeRange}})
+	if err == nil {
+		log.Printf("Http status code for updating a conversation: +%v", resp.HTTPStatusCode)
+	}
+	return err
+}
+
+// formatConversationRsvps writes the rsvps as i.e. VIDHI=4,GARBA=2
+func formatConversationRsvps(rsvps map[Event]int) string {
+	var pairs []string
+	for _, event := range AllEvents {
+		if rsvpd, ok := rsvps[event]; ok {
+			pairs = append(pairs, event.Name+"="+strconv.Itoa(rsvpd))
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+func parseConversationRsvps(cell string) map[Event]int {
+	rsvps := make(map[Event]int)
+	for _, pair := range strings.Split(cell, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		event, ok := eventByName(parts[0])
+		rsvpd, err := strconv.Atoi(parts[1])
+		if ok && err == nil {
+			rsvps[event] = rsvpd
+		}
+	}
+	return rsvps
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+const (
+	OVERRIDE_CODE = "OVERRIDE_CODE"
+
+	// Override codes look like LATE-K7Q2, so they can't be mistaken for an invite code or head count
+	OVERRIDE_CODE_PREFIX   = "LATE-"
+	OVERRIDE_CODE_LENGTH   = 4
+	OVERRIDE_CODE_ALPHABET = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // no 0/O or 1/I
+)
+
+// overrideCode is the override code used for the current request, which is
+// recorded with the RSVP in UPDATE_EVENT
+var overrideCode string
+
+// OverrideCode lets a family change their RSVP after the event's RSVP deadline.
+// It's used up for each event once an RSVP to it is saved with the code.
+type OverrideCode struct {
+	Code       string
+	InviteCode int
+	EventName  string   // empty for all events
+	UsedBy     string   // session that last used it
+	UsedFor    []string // events it has changed RSVPs for
+	rowNumber  int
+}
+
+// rsvpDeadline is the last day RSVPs for the event can be changed. It's the
+// event's RsvpDeadline, or RSVP_DEADLINE when the event doesn't have its own.
+func (event Event) rsvpDeadline() (time.Time, bool) {
+	deadline := event.RsvpDeadline
+	if deadline == "" {
+		deadline = os.Getenv("RSVP_DEADLINE")
+	}
+	if deadline == "" {
+		return time.Time{}, false
+	}
+	date, err := time.ParseInLocation(DATE_FORMAT, deadline, time.Local)
+	if err != nil {
+		log.Printf("Ignoring the RSVP deadline for %s as it isn't a date like 2019-03-01: %s", event.Name, deadline)
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// isPastRsvpDeadline is true from the day after the deadline
+func isPastRsvpDeadline(event Event, now time.Time) bool {
+	deadline, ok := event.rsvpDeadline()
+	return ok && daysBetween(now, deadline) < 0
+}
+
+// checkRsvpDeadline returns false, along with the message to send back, when
+// the event's RSVP deadline has passed and the given override code (if any)
+// can't be used. A valid override code is recorded with the RSVP, and used up
+// for the event once the RSVP is saved (see useOverrideCode).
+func checkRsvpDeadline(inviteCode int, event Event, code string) (string, bool) {
+	if !isPastRsvpDeadline(event, time.Now()) {
+		return "", true
+	}
+	deadline, _ := event.rsvpDeadline()
+	message := rsvpDeadlinePassedMsg(event, deadline)
+	if code == "" {
+		return message, false
+	}
+
+	override, found, err := findOverrideCode(code)
+	if err != nil {
+		log.Fatalf("Unable to retrieve the override code: %v", err)
+	}
+	if !found || !override.canBeUsedFor(inviteCode, event) {
+		log.Printf("%s | %s | Override code %s can't be used for invite code %d and event %s", sessionID, responseID, code, inviteCode, event.Name)
+		return INVALID_OVERRIDE_CODE_MSG + " " + message, false
+	}
+	overrideCode = override.Code
+	return "", true
+}
+
+// checkRsvpRecountDeadline is checkRsvpDeadline for the attendees' names
+// changing the count of the RSVP that was just saved. The override code the
+// RSVP was saved with still covers the new count, though it's used up for the event.
+func checkRsvpRecountDeadline(inviteCode int, event Event, code string) (string, bool) {
+	if code != "" && isPastRsvpDeadline(event, time.Now()) {
+		override, found, err := findOverrideCode(code)
+		if err != nil {
+			log.Fatalf("Unable to retrieve the override code: %v", err)
+		}
+		if found && override.justUsedFor(inviteCode, event) {
+			overrideCode = override.Code
+			return "", true
+		}
+	}
+	return checkRsvpDeadline(inviteCode, event, code)
+}
+
+// isValidOverrideCode checks the override code can be used by the family for
+// at least one event, without using it up
+func isValidOverrideCode(inviteCode int, code string) bool {
+	override, found, err := findOverrideCode(code)
+	if err != nil {
+		log.Fatalf("Unable to retrieve the override code: %v", err)
+	}
+	if !found {
+		return false
+	}
+	for _, event := range AllEvents {
+		if override.canBeUsedFor(inviteCode, event) {
+			return true
+		}
+	}
+	return false
+}
+
+func (override OverrideCode) canBeUsedFor(inviteCode int, event Event) bool {
+	return override.InviteCode == inviteCode &&
+		(override.EventName == "" || strings.EqualFold(override.EventName, event.Name)) &&
+		!override.usedFor(event)
+}
+
+// justUsedFor is true when the current session used the code up for the event
+func (override OverrideCode) justUsedFor(inviteCode int, event Event) bool {
+	return override.InviteCode == inviteCode && override.UsedBy == sessionID && override.usedFor(event)
+}
+
+func (override OverrideCode) usedFor(event Event) bool {
+	for _, eventName := range override.UsedFor {
+		if strings.EqualFold(eventName, event.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeOverrideCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func findOverrideCode(code string) (OverrideCode, bool, error) {
+	code = normalizeOverrideCode(code)
+	rows, err := getGoogleSheetsData(OVERRIDE_CODE, "A2:G")
+	if err != nil {
+		return OverrideCode{}, false, err
+	}
+	for i, row := range rows {
+		if len(row) < 2 || normalizeOverrideCode(fmt.Sprint(row[0])) != code {
+			continue
+		}
+		inviteCode, _ := strconv.Atoi(fmt.Sprint(row[1]))
+		override := OverrideCode{Code: code, InviteCode: inviteCode, rowNumber: i + 2}
+		if len(row) > 2 {
+			override.EventName = fmt.Sprint(row[2])
+		}
+		if len(row) > 5 {
+			override.UsedBy = fmt.Sprint(row[5])
+		}
+		if len(row) > 6 && fmt.Sprint(row[6]) != "" {
+			override.UsedFor = strings.Split(fmt.Sprint(row[6]), ",")
+		}
+		return override, true, nil
+	}
+	return OverrideCode{}, false, nil
+}
+
+// useOverrideCode uses up the current request's override code (if any) for the
+// events whose RSVPs were just saved with it
+func useOverrideCode(rsvps map[Event]int) error {
+	if overrideCode == "" {
+		return nil
+	}
+	override, found, err := findOverrideCode(overrideCode)
+	if err != nil || !found {
+		return err
+	}
+	for event := range rsvps {
+		if !override.usedFor(event) {
+			override.UsedFor = append(override.UsedFor, event.Name)
+		}
+	}
+	sort.Strings(override.UsedFor)
+
+	row := strconv.Itoa(override.rowNumber)
+	writeRange := OVERRIDE_CODE + "!E" + row + ":G" + row
+	_, err = setGoogleSheetsData([]*sheets.ValueRange{{Values: [][]interface{}{{time.Now(), sessionID, strings.Join(override.UsedFor, ",")}}, Range: writeRange}})
+	return err
+}
+
+func issueOverrideCodeCommand(args []string) error {
+	flags := flag.NewFlagSet("issue-override-code", flag.ExitOnError)
+	inviteCode := flags.Int("invite-code", 0, "invite code of the family the override code is for")
+	eventName := flags.String("event", "", "only allow changes to this event, i.e. WEDDING (default all events)")
+	flags.Parse(args)
+
+	if *inviteCode == 0 {
+		return fmt.Errorf("-invite-code is required")
+	}
+	if *eventName != "" {
+		event, ok := eventByName(*eventName)
+		if !ok {
+			return fmt.Errorf("unknown event %q", *eventName)
+		}
+		*eventName = event.Name
+	}
+	if _, found := lookupInvitedFamily(*inviteCode); !found {
+		return fmt.Errorf("no invited family with invite code %d", *inviteCode)
+	}
+
+	code, err := newOverrideCode()
+	if err != nil {
+		return err
+	}
+	row := []interface{}{code, *inviteCode, *eventName, time.Now()}
+	if _, err := appendGoogleSheetsData(OVERRIDE_CODE, [][]interface{}{row}); err != nil {
+		return err
+	}
+	fmt.Printf("Override code for invite code %d: %s\n", *inviteCode, code)
+	return nil
+}
+
+func newOverrideCode() (string, error) {
+	code := OVERRIDE_CODE_PREFIX
+	for i := 0; i < OVERRIDE_CODE_LENGTH; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(OVERRIDE_CODE_ALPHABET))))
+		if err != nil {
+			return "", err
+		}
+		code += string(OVERRIDE_CODE_ALPHABET[n.Int64()])
+	}
+	return code, nil
+}
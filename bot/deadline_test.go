@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsPastRsvpDeadline(t *testing.T) {
+	os.Setenv("RSVP_DEADLINE", "2019-03-01")
+	defer os.Unsetenv("RSVP_DEADLINE")
+	deadline := time.Date(2019, 3, 1, 0, 0, 0, 0, time.Local)
+
+	if isPastRsvpDeadline(Vidhi, deadline.Add(23*time.Hour)) {
+		t.Error("Expected RSVPs to be open on the day of the deadline")
+	}
+	if !isPastRsvpDeadline(Vidhi, deadline.AddDate(0, 0, 1)) {
+		t.Error("Expected RSVPs to be closed the day after the deadline")
+	}
+
+	event := Wedding
+	event.RsvpDeadline = "2019-03-10"
+	if isPastRsvpDeadline(event, deadline.AddDate(0, 0, 5)) {
+		t.Error("Expected the event's own deadline to take precedence over RSVP_DEADLINE")
+	}
+
+	os.Unsetenv("RSVP_DEADLINE")
+	if isPastRsvpDeadline(Vidhi, deadline.AddDate(1, 0, 0)) {
+		t.Error("Expected no deadline when RSVP_DEADLINE isn't set")
+	}
+}
+
+func TestOverrideCodeCanBeUsedFor(t *testing.T) {
+	override := OverrideCode{Code: "LATE-K7Q2", InviteCode: 300, EventName: Wedding.Name}
+	if !override.canBeUsedFor(300, Wedding) {
+		t.Error("Expected the override code to be usable for the wedding")
+	}
+	if override.canBeUsedFor(300, Garba) {
+		t.Error("Expected the override code to only be usable for the wedding")
+	}
+	if override.canBeUsedFor(301, Wedding) {
+		t.Error("Expected the override code to only be usable by invite code 300")
+	}
+
+	override.UsedBy = "+15555550100"
+	override.UsedFor = []string{Wedding.Name}
+	if override.canBeUsedFor(300, Wedding) {
+		t.Error("Expected the override code to be used up once the wedding RSVP was saved, even for the same session")
+	}
+
+	override = OverrideCode{Code: "LATE-K7Q2", InviteCode: 300, UsedFor: []string{Vidhi.Name}}
+	if override.canBeUsedFor(300, Vidhi) || !override.canBeUsedFor(300, Wedding) {
+		t.Error("Expected a code for all events to only be used up for the events it changed")
+	}
+}
+
+func TestOverrideCodeJustUsedFor(t *testing.T) {
+	previousSessionID := sessionID
+	defer func() { sessionID = previousSessionID }()
+	sessionID = "+15555550100"
+
+	override := OverrideCode{Code: "LATE-K7Q2", InviteCode: 300, UsedBy: "+15555550100", UsedFor: []string{Wedding.Name}}
+	if !override.justUsedFor(300, Wedding) {
+		t.Error("Expected the attendees' names to be able to change the wedding RSVP the code was just used for")
+	}
+	if override.justUsedFor(300, Vidhi) || override.justUsedFor(301, Wedding) {
+		t.Error("Expected the code to only cover the family's RSVP it was used for")
+	}
+	sessionID = "+15555550199"
+	if override.justUsedFor(300, Wedding) {
+		t.Error("Expected the code not to cover another session's RSVP")
+	}
+}
+
+func TestCheckRsvpRecountDeadline(t *testing.T) {
+	if _, ok := checkRsvpRecountDeadline(300, Wedding, ""); !ok {
+		t.Error("Expected the count to change before the deadline")
+	}
+	os.Setenv("RSVP_DEADLINE", "2019-03-01")
+	defer os.Unsetenv("RSVP_DEADLINE")
+	if message, ok := checkRsvpRecountDeadline(300, Wedding, ""); ok || !strings.Contains(message, "closed") {
+		t.Errorf("Expected the count not to change after the deadline without an override code, got: %s", message)
+	}
+}
+
+func TestNewOverrideCode(t *testing.T) {
+	code, err := newOverrideCode()
+	if err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if !regexp.MustCompile(`^LATE-[A-Z2-9]{4}$`).MatchString(code) {
+		t.Errorf("Unexpected override code: %s", code)
+	}
+	if input := parseSmsMessage("my code is " + code); input.kind != SMS_OVERRIDE_CODE || input.code != code {
+		t.Errorf("Expected the override code to be parsed from an SMS, got +%v", input)
+	}
+}
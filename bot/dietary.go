@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+
+	"github.com/golang/protobuf/ptypes/struct"
+	dialogflow "google.golang.org/genproto/googleapis/cloud/dialogflow/v2"
+)
+
+const (
+	DIETARY = "DIETARY"
+
+	DIETARY_CONTEXT = "rsvperdietary-followup"
+
+	// Rows of the caterer report besides the meal options
+	MEAL_REGULAR = "Regular"
+	MEAL_TOTAL   = "Total"
+)
+
+var dietaryNoneWords = map[string]bool{"none": true, "no": true, "nope": true, "nothing": true, "n/a": true, "na": true, "skip": true}
+
+// DietaryNeed is a meal option for one attendee, or for Count of the family's
+// attendees when they didn't say who (Name is empty then)
+type DietaryNeed struct {
+	Name  string
+	Meal  string
+	Count int
+}
+
+// mealOptions are the dietary options to ask about for the event. It's the
+// event's MealOptions, or MEAL_OPTIONS when the event doesn't have its own;
+// there's no dietary step when neither is set.
+func (event Event) mealOptions() []string {
+	options := event.MealOptions
+	if options == "" {
+		options = os.Getenv("MEAL_OPTIONS")
+	}
+	var mealOptions []string
+	for _, option := range strings.Split(options, ",") {
+		if option = strings.TrimSpace(option); option != "" {
+			mealOptions = append(mealOptions, option)
+		}
+	}
+	return mealOptions
+}
+
+// mealKey drops everything but the letters, so "nut free" matches Nut-free
+func mealKey(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, text)
+}
+
+// matchMealOption finds the (longest) meal option mentioned in the text
+func matchMealOption(text string, options []string) (string, bool) {
+	key := mealKey(text)
+	var match string
+	for _, option := range options {
+		if optionKey := mealKey(option); optionKey != "" && strings.Contains(key, optionKey) && len(option) > len(match) {
+			match = option
+		}
+	}
+	return match, match != ""
+}
+
+// parseDietaryNeeds reads meal options separated by commas or "and", each
+// with how many attendees need it (i.e. "2 Jain, 1 vegan"), or by name (i.e.
+// "Priya: vegan", where a number picks that attendee from the list)
+func parseDietaryNeeds(text string, options []string, names []string) ([]DietaryNeed, error) {
+	var needs []DietaryNeed
+	familyNeeds := make(map[string]int) // index in needs by meal
+	for _, part := range attendeeNameSeparators.Split(text, -1) {
+		part = strings.Trim(strings.TrimSpace(part), ".!")
+		if part == "" {
+			continue
+		}
+
+		var name string
+		if colon := strings.Index(part, ":"); colon != -1 {
+			name = strings.TrimSpace(part[:colon])
+			part = part[colon+1:]
+			if pick, err := strconv.Atoi(name); err == nil {
+				if pick < 1 || pick > len(names) {
+					return nil, fmt.Errorf("there's no %d on the list", pick)
+				}
+				name = names[pick-1]
+			}
+		}
+		meal, ok := matchMealOption(part, options)
+		if !ok {
+			return nil, fmt.Errorf("%q isn't one of the meal options", part)
+		}
+		if name != "" {
+			needs = append(needs, DietaryNeed{Name: name, Meal: meal, Count: 1})
+			continue
+		}
+
+		count := 1
+		if digits := smsDigits.FindString(part); digits != "" {
+			count, _ = strconv.Atoi(digits)
+		}
+		for _, word := range strings.Fields(strings.ToLower(part)) {
+			if number, ok := smsNumberWords[word]; ok {
+				count = number
+			}
+		}
+		if count < 1 {
+			return nil, fmt.Errorf("%q needs at least 1 guest", part)
+		}
+		if i, ok := familyNeeds[meal]; ok {
+			needs[i].Count += count
+			continue
+		}
+		familyNeeds[meal] = len(needs)
+		needs = append(needs, DietaryNeed{Meal: meal, Count: count})
+	}
+	if len(needs) == 0 {
+		return nil, fmt.Errorf("no meal options")
+	}
+	return needs, nil
+}
+
+func isNoDietaryNeeds(text string) bool {
+	return dietaryNoneWords[strings.ToLower(strings.Trim(strings.TrimSpace(text), ".!? "))]
+}
+
+func dietaryNeedsTotal(needs []DietaryNeed) int {
+	var total int
+	for _, need := range needs {
+		total += need.Count
+	}
+	return total
+}
+
+// dietaryAttendees are the attendees' names to offer in the dietary prompt,
+// when they're being collected
+func dietaryAttendees(inviteCode int, event Event) []string {
+	if !collectAttendeeNames() {
+		return nil
+	}
+	return attendeesOf(inviteCode, event)
+}
+
+// saveDietaryNeeds replaces the family's dietary needs for the event in DIETARY
+func saveDietaryNeeds(inviteCode int, event Event, needs []DietaryNeed) error {
+	var rows [][]interface{}
+	for _, need := range needs {
+		rows = append(rows, []interface{}{inviteCode, event.Name, need.Name, need.Meal, need.Count, time.Now(), sessionID})
+	}
+	return replaceFamilyEventRows(DIETARY, inviteCode, event, rows)
+}
+
+// readDietaryNeeds is the dietary needs by invite code & event name
+func readDietaryNeeds() (map[int]map[string][]DietaryNeed, error) {
+	rows, err := getGoogleSheetsData(DIETARY, "A2:E")
+	if err != nil {
+		return nil, err
+	}
+	dietaryNeeds := make(map[int]map[string][]DietaryNeed)
+	for i, row := range rows {
+		if len(row) < 5 {
+			continue
+		}
+		inviteCode, err := strconv.Atoi(fmt.Sprint(row[0]))
+		if err != nil {
+			log.Printf("Skipping dietary entry (%d) as its invite code isn't a number: %v", i+2, row[0])
+			continue
+		}
+		count, err := strconv.Atoi(fmt.Sprint(row[4]))
+		if err != nil {
+			log.Printf("Skipping dietary entry (%d) as its count isn't a number: %v", i+2, row[4])
+			continue
+		}
+		if dietaryNeeds[inviteCode] == nil {
+			dietaryNeeds[inviteCode] = make(map[string][]DietaryNeed)
+		}
+		eventName := strings.ToUpper(fmt.Sprint(row[1]))
+		need := DietaryNeed{Name: fmt.Sprint(row[2]), Meal: fmt.Sprint(row[3]), Count: count}
+		dietaryNeeds[inviteCode][eventName] = append(dietaryNeeds[inviteCode][eventName], need)
+	}
+	return dietaryNeeds, nil
+}
+
+// dietaryOrFollowupResponse asks for the dietary needs of the event's
+// attendees when the event has meal options, and moves on to the next event's
+// RSVP otherwise
+func dietaryOrFollowupResponse(response *DialogflowResponse, invitedFamily InvitedFamily, event Event, alreadyRsvpdEvents map[Event]int) {
+	if alreadyRsvpdEvents[event] > 0 && len(event.mealOptions()) > 0 {
+		dietaryResponse(response, invitedFamily.InviteCode, event)
+		return
+	}
+	followupRsvpResponse(response, invitedFamily, event, alreadyRsvpdEvents)
+}
+
+// dietaryResponse asks the Dialogflow guest about dietary needs, keeping the
+// event in a context for DietaryFulfillment
+func dietaryResponse(response *DialogflowResponse, inviteCode int, event Event) {
+	dietaryContext := dialogflow.Context{
+		Name:          sessionID + "/contexts/" + DIETARY_CONTEXT,
+		LifespanCount: 2,
+		Parameters: &structpb.Struct{Fields: map[string]*structpb.Value{
+			"invite_code":   numberValue(inviteCode),
+			"dietary_event": {Kind: &structpb.Value_StringValue{StringValue: event.Name}},
+		}},
+	}
+	response.Text(dietaryPromptMsg(event, event.mealOptions(), dietaryAttendees(inviteCode, event))).Contexts(&dietaryContext)
+}
+
+// DietaryFulfillment saves the dietary needs the guest replied with and
+// carries on with the next event's RSVP
+func DietaryFulfillment(response *DialogflowResponse, contexts []*dialogflow.Context, text string) {
+	inviteCode := getInviteCodeFromContext(contexts)
+	event, ok := eventByName(getFromContext(contexts, "dietary_event").GetStringValue())
+	if inviteCode == -1 || !ok {
+		log.Fatalf("%s | %s | Couldn't find the invite code or event for the dietary needs", sessionID, responseID)
+	}
+	log.Printf("\nIntent: %s - Starting fulfillment for invite code: %d", intent, inviteCode)
+
+	invitedFamily := findInvitedFamily(inviteCode)
+	rsvpd := invitedFamily.rsvpdTo(event)
+	var needs []DietaryNeed
+	if !isNoDietaryNeeds(text) {
+		var err error
+		needs, err = parseDietaryNeeds(text, event.mealOptions(), dietaryAttendees(inviteCode, event))
+		switch {
+		case err != nil:
+			dietaryResponse(response.Text(DIDNT_UNDERSTAND_MSG), inviteCode, event)
+			return
+		case dietaryNeedsTotal(needs) > rsvpd:
+			dietaryResponse(response.Text(dietaryTooManyMsg(event, rsvpd)), inviteCode, event)
+			return
+		}
+	}
+	if err := saveDietaryNeeds(inviteCode, event, needs); err != nil {
+		log.Fatalf("Unable to save the dietary needs of invite code %d: %v", inviteCode, err)
+	}
+	alreadyRsvpdEvents := rsvpdEvents(contexts)
+	alreadyRsvpdEvents[event] = rsvpd
+	followupRsvpResponse(response, invitedFamily, event, alreadyRsvpdEvents)
+}
+
+// CatererRow is how many of an event's RSVP'd guests need a meal option.
+// MEAL_REGULAR is everyone else & MEAL_TOTAL is all the RSVP'd guests.
+type CatererRow struct {
+	Event string `json:"event"`
+	Meal  string `json:"meal"`
+	Count int    `json:"count"`
+}
+
+var catererColumns = []string{"Event", "Meal", "Count"}
+
+// catererReport totals the dietary needs of each event by meal option. Only
+// the families that are RSVP'd to the event are counted, and a family's needs
+// never count for more than the guests they RSVP'd.
+func catererReport(invitedFamilies []InvitedFamily, dietaryNeeds map[int]map[string][]DietaryNeed) []CatererRow {
+	var report []CatererRow
+	for _, event := range AllEvents {
+		meals := event.mealOptions()
+		counts := make(map[string]int)
+		var rsvpd, special int
+		for _, invitedFamily := range invitedFamilies {
+			familyRsvpd := invitedFamily.rsvpdTo(event)
+			if familyRsvpd <= 0 {
+				continue
+			}
+			rsvpd += familyRsvpd
+			for _, need := range dietaryNeeds[invitedFamily.InviteCode][event.Name] {
+				count := need.Count
+				if count > familyRsvpd {
+					count = familyRsvpd
+				}
+				familyRsvpd -= count
+				meal, ok := findFold(meals, need.Meal)
+				if !ok {
+					meals = append(meals, meal) // an option that's since been taken out of the config
+				}
+				counts[meal] += count
+				special += count
+			}
+		}
+
+		for _, meal := range meals {
+			report = append(report, CatererRow{Event: event.Name, Meal: meal, Count: counts[meal]})
+		}
+		report = append(report, CatererRow{Event: event.Name, Meal: MEAL_REGULAR, Count: rsvpd - special})
+		report = append(report, CatererRow{Event: event.Name, Meal: MEAL_TOTAL, Count: rsvpd})
+	}
+	return report
+}
+
+// findFold is the value as it's spelled in values, ignoring case
+func findFold(values []string, value string) (string, bool) {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return v, true
+		}
+	}
+	return value, false
+}
+
+func writeCatererReport(writer io.Writer, report []CatererRow, format string) error {
+	record := func(row CatererRow) []string {
+		return []string{row.Event, row.Meal, strconv.Itoa(row.Count)}
+	}
+	switch format {
+	case REPORT_TABLE:
+		table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, strings.Join(catererColumns, "\t"))
+		for _, row := range report {
+			fmt.Fprintln(table, strings.Join(record(row), "\t"))
+		}
+		return table.Flush()
+	case REPORT_CSV:
+		csvWriter := csv.NewWriter(writer)
+		csvWriter.Write(catererColumns)
+		for _, row := range report {
+			csvWriter.Write(record(row))
+		}
+		csvWriter.Flush()
+		return csvWriter.Error()
+	case REPORT_JSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return fmt.Errorf("unknown report format %q (table, csv or json)", format)
+}
+
+func catererReportCommand(args []string) error {
+	flags := flag.NewFlagSet("caterer-report", flag.ExitOnError)
+	format := flags.String("format", REPORT_TABLE, "table, csv or json")
+	outputFile := flags.String("out", "", "file to write the report to (default stdout)")
+	flags.Parse(args)
+
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		return err
+	}
+	dietaryNeeds, err := readDietaryNeeds()
+	if err != nil {
+		return err
+	}
+
+	var writer io.Writer = os.Stdout
+	if *outputFile != "" {
+		file, err := os.Create(*outputFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+	return writeCatererReport(writer, catererReport(invitedFamilies, dietaryNeeds), *format)
+}
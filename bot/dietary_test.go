@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMealOptions(t *testing.T) {
+	os.Setenv("MEAL_OPTIONS", "Jain, Vegan,,Nut-free")
+	defer os.Unsetenv("MEAL_OPTIONS")
+	if options := Vidhi.mealOptions(); fmt.Sprint(options) != "[Jain Vegan Nut-free]" {
+		t.Errorf("Expected the MEAL_OPTIONS, got: +%v", options)
+	}
+	event := Wedding
+	event.MealOptions = "Gluten-free"
+	if options := event.mealOptions(); fmt.Sprint(options) != "[Gluten-free]" {
+		t.Errorf("Expected the event's own meal options, got: +%v", options)
+	}
+}
+
+func TestParseDietaryNeeds(t *testing.T) {
+	options := []string{"Jain", "Vegan", "Nut-free", "Gluten-free"}
+	attendees := []string{"Rajesh", "Priya"}
+	tests := map[string]string{
+		"2 Jain, 1 vegan":              "[{ Jain 2} { Vegan 1}]",
+		"nut free and 2 jain & 1 Jain": "[{ Nut-free 1} { Jain 3}]",
+		"Priya: vegan; 1: gluten free": "[{Priya Vegan 1} {Rajesh Gluten-free 1}]",
+		"two vegan.":                   "[{ Vegan 2}]",
+	}
+	for text, expected := range tests {
+		needs, err := parseDietaryNeeds(text, options, attendees)
+		if err != nil {
+			t.Errorf("Error parsing %q: +%v", text, err)
+			continue
+		}
+		if fmt.Sprint(needs) != expected {
+			t.Errorf("Expected %q to parse as %s, got: +%v", text, expected, needs)
+		}
+	}
+
+	for _, text := range []string{"halal", "3: vegan", "0 Jain", " , "} {
+		if needs, err := parseDietaryNeeds(text, options, attendees); err == nil {
+			t.Errorf("Expected %q not to parse, got: +%v", text, needs)
+		}
+	}
+	if !isNoDietaryNeeds("None.") || isNoDietaryNeeds("vegan") {
+		t.Errorf("Expected only NONE to mean no dietary needs")
+	}
+}
+
+func TestCatererReport(t *testing.T) {
+	os.Setenv("MEAL_OPTIONS", "Jain,Vegan")
+	defer os.Unsetenv("MEAL_OPTIONS")
+	invitedFamilies := []InvitedFamily{
+		{InviteCode: 1, WeddingRsvpd: 4, VidhiRsvpd: NULL_INVITEES, GarbaRsvpd: NULL_INVITEES},
+		{InviteCode: 2, WeddingRsvpd: 1, VidhiRsvpd: NULL_INVITEES, GarbaRsvpd: NULL_INVITEES},
+		{InviteCode: 3, WeddingRsvpd: 0, VidhiRsvpd: NULL_INVITEES, GarbaRsvpd: NULL_INVITEES},
+	}
+	dietaryNeeds := map[int]map[string][]DietaryNeed{
+		1: {Wedding.Name: {{Meal: "jain", Count: 2}, {Name: "Anil", Meal: "Halal", Count: 1}}},
+		2: {Wedding.Name: {{Meal: "Vegan", Count: 3}}},
+		3: {Wedding.Name: {{Meal: "Vegan", Count: 1}}},
+	}
+	var wedding []string
+	for _, row := range catererReport(invitedFamilies, dietaryNeeds) {
+		if row.Event == Wedding.Name {
+			wedding = append(wedding, fmt.Sprintf("%s=%d", row.Meal, row.Count))
+		}
+	}
+	if expected := "Jain=2 Vegan=1 Halal=1 Regular=1 Total=5"; strings.Join(wedding, " ") != expected {
+		t.Errorf("Expected %s, got: %s", expected, strings.Join(wedding, " "))
+	}
+
+	var buffer bytes.Buffer
+	if err := writeCatererReport(&buffer, []CatererRow{{Event: Wedding.Name, Meal: "Jain", Count: 2}}, REPORT_CSV); err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if buffer.String() != "Event,Meal,Count\nWEDDING,Jain,2\n" {
+		t.Errorf("Unexpected csv: %s", buffer.String())
+	}
+}
+
+func TestConversationDietaryEvent(t *testing.T) {
+	conversation := Conversation{Step: STEP_DIETARY + Vidhi.Name}
+	if event, ok := conversation.dietaryEvent(); !ok || event != Vidhi {
+		t.Errorf("Expected the Vidhi dietary step, got: +%v", event)
+	}
+	if _, ok := conversation.namesEvent(); ok {
+		t.Errorf("Expected the dietary step not to be a names step")
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	DEFAULT_DYNAMODB_FAMILIES_TABLE     = "rsvper-families"
+	DEFAULT_DYNAMODB_UPDATE_EVENT_TABLE = "rsvper-update-event"
+)
+
+// dynamoStore keeps the families in one DynamoDB table, keyed by invite code,
+// and their RSVP history in another, keyed by invite code & update ID
+type dynamoStore struct {
+	client           *dynamodb.DynamoDB
+	familiesTable    string
+	updateEventTable string
+}
+
+// newDynamoStore uses the lambda's credentials & region, or DynamoDB Local
+// when DYNAMODB_ENDPOINT is set (i.e. http://localhost:8000)
+func newDynamoStore() (*dynamoStore, error) {
+	config := &aws.Config{}
+	if endpoint := os.Getenv("DYNAMODB_ENDPOINT"); endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+	}
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamoStore{
+		client:           dynamodb.New(sess),
+		familiesTable:    envOrDefault("DYNAMODB_FAMILIES_TABLE", DEFAULT_DYNAMODB_FAMILIES_TABLE),
+		updateEventTable: envOrDefault("DYNAMODB_UPDATE_EVENT_TABLE", DEFAULT_DYNAMODB_UPDATE_EVENT_TABLE),
+	}, nil
+}
+
+func (store *dynamoStore) AllFamilies() ([]InvitedFamily, error) {
+	var invitedFamilies []InvitedFamily
+	var itemErr error
+	err := store.client.ScanPages(&dynamodb.ScanInput{TableName: aws.String(store.familiesTable), ConsistentRead: aws.Bool(true)}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			invitedFamily, err := familyFromItem(item)
+			if err != nil {
+				itemErr = err
+				return false
+			}
+			invitedFamilies = append(invitedFamilies, invitedFamily)
+		}
+		return true
+	})
+	if err == nil {
+		err = itemErr
+	}
+	return invitedFamilies, err
+}
+
+func (store *dynamoStore) FindFamily(inviteCode int) (InvitedFamily, bool, error) {
+	resp, err := store.client.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(store.familiesTable),
+		Key:            familyKeyItem(inviteCode),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || resp.Item == nil {
+		return InvitedFamily{}, false, err
+	}
+	invitedFamily, err := familyFromItem(resp.Item)
+	return invitedFamily, err == nil, err
+}
+
+func (store *dynamoStore) AddFamily(invitedFamily InvitedFamily) error {
+	_, err := store.client.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String(store.familiesTable),
+		Item:                familyItem(invitedFamily),
+		ConditionExpression: aws.String("attribute_not_exists(inviteCode)"),
+	})
+	if isConditionFailed(err) {
+		return fmt.Errorf("invite code %d is already used", invitedFamily.InviteCode)
+	}
+	return err
+}
+
+func (store *dynamoStore) UpdateFamily(invitedFamily InvitedFamily) error {
+	_, err := store.client.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String(store.familiesTable),
+		Item:                familyItem(invitedFamily),
+		ConditionExpression: aws.String("attribute_exists(inviteCode)"),
+	})
+	if isConditionFailed(err) {
+		return fmt.Errorf("no invited family with invite code %d", invitedFamily.InviteCode)
+	}
+	return err
+}
+
+func (store *dynamoStore) DeleteFamily(inviteCode int) error {
+	_, err := store.client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:           aws.String(store.familiesTable),
+		Key:                 familyKeyItem(inviteCode),
+		ConditionExpression: aws.String("attribute_exists(inviteCode)"),
+	})
+	if isConditionFailed(err) {
+		return fmt.Errorf("no invited family with invite code %d", inviteCode)
+	}
+	return err
+}
+
+// SaveRsvps updates the RSVP counts & logs the RSVPs in one transaction. The
+// update is conditional on the family being invited to that many guests, so
+// two conversations can't RSVP past the invited count between them.
+func (store *dynamoStore) SaveRsvps(inviteCode int, phoneNumber string, rsvps map[Event]int, children map[Event]int) error {
+	if len(rsvps) == 0 {
+		return nil
+	}
+	update := rsvpUpdateExpression(inviteCode, rsvps, children)
+	update.TableName = aws.String(store.familiesTable)
+	items := []*dynamodb.TransactWriteItem{{Update: update}}
+
+	timestamp := time.Now().UTC().Format(time.RFC3339Nano)
+	for _, event := range AllEvents {
+		attendees, ok := rsvps[event]
+		if !ok {
+			continue
+		}
+		childrenRsvpd, ok := children[event]
+		if !ok {
+			childrenRsvpd = NULL_INVITEES
+		}
+		rsvpUpdate := RsvpUpdate{
+			InviteCode:   inviteCode,
+			PhoneNumber:  phoneNumber,
+			Event:        event.Name,
+			Attendees:    attendees,
+			Children:     childrenRsvpd,
+			Timestamp:    timestamp,
+			SessionID:    sessionID,
+			OverrideCode: overrideCode,
+		}
+		items = append(items, &dynamodb.TransactWriteItem{Put: &dynamodb.Put{
+			TableName:           aws.String(store.updateEventTable),
+			Item:                rsvpUpdateItem(rsvpUpdate),
+			ConditionExpression: aws.String("attribute_not_exists(updateId)"),
+		}})
+	}
+
+	_, err := store.client.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeTransactionCanceledException {
+		return fmt.Errorf("no invited family with invite code %d, or it isn't invited to that many guests: %v", inviteCode, awsErr.Message())
+	}
+	return err
+}
+
+func (store *dynamoStore) RsvpHistory(inviteCode int) ([]RsvpUpdate, error) {
+	query := &dynamodb.QueryInput{
+		TableName:                 aws.String(store.updateEventTable),
+		KeyConditionExpression:    aws.String("inviteCode = :inviteCode"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":inviteCode": numberAttribute(inviteCode)},
+		ConsistentRead:            aws.Bool(true),
+	}
+	var history []RsvpUpdate
+	err := store.client.QueryPages(query, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			history = append(history, rsvpUpdateFromItem(item))
+		}
+		return true
+	})
+	return history, err
+}
+
+// rsvpUpdateExpression sets each event's RSVP, on the condition that the
+// family exists & is invited to at least that many guests. Declining (0) an
+// event the family isn't invited to, i.e. with no invited count, is let
+// through too. The children's count is set along with it, or removed when the
+// RSVP wasn't split.
+func rsvpUpdateExpression(inviteCode int, rsvps map[Event]int, children map[Event]int) *dynamodb.Update {
+	update := &dynamodb.Update{
+		Key:                       familyKeyItem(inviteCode),
+		ExpressionAttributeNames:  make(map[string]*string),
+		ExpressionAttributeValues: make(map[string]*dynamodb.AttributeValue),
+	}
+	var sets, removes []string
+	conditionExpression := "attribute_exists(inviteCode)"
+	for i, event := range AllEvents {
+		attendees, ok := rsvps[event]
+		if !ok {
+			continue
+		}
+		name, value := "#e"+strconv.Itoa(i), ":a"+strconv.Itoa(i)
+		update.ExpressionAttributeNames[name] = aws.String(event.Name)
+		update.ExpressionAttributeValues[value] = numberAttribute(attendees)
+		sets = append(sets, "rsvpd."+name+" = "+value)
+		if attendees == 0 {
+			conditionExpression += " AND (invited." + name + " >= " + value + " OR attribute_not_exists(invited." + name + "))"
+		} else {
+			conditionExpression += " AND invited." + name + " >= " + value
+		}
+
+		if childrenRsvpd, ok := children[event]; ok {
+			childrenValue := ":c" + strconv.Itoa(i)
+			update.ExpressionAttributeValues[childrenValue] = numberAttribute(childrenRsvpd)
+			sets = append(sets, "childrenRsvpd."+name+" = "+childrenValue)
+		} else {
+			removes = append(removes, "childrenRsvpd."+name)
+		}
+	}
+	updateExpression := "SET " + strings.Join(sets, ", ")
+	if len(removes) > 0 {
+		updateExpression += " REMOVE " + strings.Join(removes, ", ")
+	}
+	update.UpdateExpression = aws.String(updateExpression)
+	update.ConditionExpression = aws.String(conditionExpression)
+	return update
+}
+
+// familyItem is the family as a DynamoDB item. The invited & RSVP'd counts are
+// maps keyed by event name, leaving out the events the family isn't invited
+// to or hasn't RSVP'd to yet, and the same goes for the children's counts.
+// The maps are always there, so SaveRsvps can set an event's count in them.
+// Empty strings are left out too, as DynamoDB doesn't take them.
+func familyItem(invitedFamily InvitedFamily) map[string]*dynamodb.AttributeValue {
+	item := familyKeyItem(invitedFamily.InviteCode)
+	setStringAttribute(item, "origin", invitedFamily.Origin)
+	setStringAttribute(item, "name", invitedFamily.Name)
+	setStringAttribute(item, "inviteName", invitedFamily.InviteName)
+	invited, rsvpd := make(map[string]*dynamodb.AttributeValue), make(map[string]*dynamodb.AttributeValue)
+	childrenInvited, childrenRsvpd := make(map[string]*dynamodb.AttributeValue), make(map[string]*dynamodb.AttributeValue)
+	for _, event := range AllEvents {
+		if invitedFamily.invitedTo(event) > 0 {
+			invited[event.Name] = numberAttribute(invitedFamily.invitedTo(event))
+		}
+		if invitedFamily.rsvpdTo(event) != NULL_INVITEES {
+			rsvpd[event.Name] = numberAttribute(invitedFamily.rsvpdTo(event))
+		}
+		if invitedFamily.childrenInvitedTo(event) > 0 {
+			childrenInvited[event.Name] = numberAttribute(invitedFamily.childrenInvitedTo(event))
+		}
+		if invitedFamily.childrenRsvpdTo(event) != NULL_INVITEES {
+			childrenRsvpd[event.Name] = numberAttribute(invitedFamily.childrenRsvpdTo(event))
+		}
+	}
+	item["invited"] = &dynamodb.AttributeValue{M: invited}
+	item["rsvpd"] = &dynamodb.AttributeValue{M: rsvpd}
+	item["childrenInvited"] = &dynamodb.AttributeValue{M: childrenInvited}
+	item["childrenRsvpd"] = &dynamodb.AttributeValue{M: childrenRsvpd}
+	return item
+}
+
+func familyFromItem(item map[string]*dynamodb.AttributeValue) (InvitedFamily, error) {
+	inviteCode, err := numberFromAttribute(item["inviteCode"])
+	if err != nil {
+		return InvitedFamily{}, fmt.Errorf("family item without an invite code: %v", err)
+	}
+	invitedFamily := InvitedFamily{
+		InviteCode: inviteCode,
+		Origin:     stringFromAttribute(item["origin"]),
+		Name:       stringFromAttribute(item["name"]),
+		InviteName: stringFromAttribute(item["inviteName"]),
+	}
+	for _, event := range AllEvents {
+		counts := []struct {
+			attribute    string
+			defaultCount int
+			set          func(Event, int)
+		}{
+			{"invited", 0, invitedFamily.setInvited},
+			{"rsvpd", NULL_INVITEES, invitedFamily.setRsvpd},
+			{"childrenInvited", 0, invitedFamily.setChildrenInvited},
+			{"childrenRsvpd", NULL_INVITEES, invitedFamily.setChildrenRsvpd},
+		}
+		for _, count := range counts {
+			count.set(event, count.defaultCount)
+			if attribute := mapAttribute(item[count.attribute], event.Name); attribute != nil {
+				number, err := numberFromAttribute(attribute)
+				if err != nil {
+					return InvitedFamily{}, fmt.Errorf("invite code %d: %s %s %v", inviteCode, event.Name, count.attribute, err)
+				}
+				count.set(event, number)
+			}
+		}
+	}
+	return invitedFamily, nil
+}
+
+// rsvpUpdateItem is keyed by invite code & an update ID of the timestamp &
+// event, so a family's history is read in order with one query
+func rsvpUpdateItem(update RsvpUpdate) map[string]*dynamodb.AttributeValue {
+	item := map[string]*dynamodb.AttributeValue{
+		"inviteCode": numberAttribute(update.InviteCode),
+		"updateId":   {S: aws.String(update.Timestamp + "#" + update.Event)},
+		"attendees":  numberAttribute(update.Attendees),
+	}
+	if update.Children != NULL_INVITEES {
+		item["children"] = numberAttribute(update.Children)
+	}
+	setStringAttribute(item, "phoneNumber", update.PhoneNumber)
+	setStringAttribute(item, "event", update.Event)
+	setStringAttribute(item, "timestamp", update.Timestamp)
+	setStringAttribute(item, "sessionId", update.SessionID)
+	setStringAttribute(item, "overrideCode", update.OverrideCode)
+	return item
+}
+
+func rsvpUpdateFromItem(item map[string]*dynamodb.AttributeValue) RsvpUpdate {
+	inviteCode, _ := numberFromAttribute(item["inviteCode"])
+	attendees, _ := numberFromAttribute(item["attendees"])
+	children, err := numberFromAttribute(item["children"])
+	if err != nil {
+		children = NULL_INVITEES
+	}
+	return RsvpUpdate{
+		InviteCode:   inviteCode,
+		PhoneNumber:  stringFromAttribute(item["phoneNumber"]),
+		Event:        stringFromAttribute(item["event"]),
+		Attendees:    attendees,
+		Children:     children,
+		Timestamp:    stringFromAttribute(item["timestamp"]),
+		SessionID:    stringFromAttribute(item["sessionId"]),
+		OverrideCode: stringFromAttribute(item["overrideCode"]),
+	}
+}
+
+func familyKeyItem(inviteCode int) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{"inviteCode": numberAttribute(inviteCode)}
+}
+
+func numberAttribute(number int) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(number))}
+}
+
+func numberFromAttribute(attribute *dynamodb.AttributeValue) (int, error) {
+	if attribute == nil || attribute.N == nil {
+		return 0, fmt.Errorf("isn't a number")
+	}
+	return strconv.Atoi(*attribute.N)
+}
+
+func setStringAttribute(item map[string]*dynamodb.AttributeValue, name string, value string) {
+	if value != "" {
+		item[name] = &dynamodb.AttributeValue{S: aws.String(value)}
+	}
+}
+
+func stringFromAttribute(attribute *dynamodb.AttributeValue) string {
+	if attribute == nil {
+		return ""
+	}
+	return aws.StringValue(attribute.S)
+}
+
+func mapAttribute(attribute *dynamodb.AttributeValue, key string) *dynamodb.AttributeValue {
+	if attribute == nil {
+		return nil
+	}
+	return attribute.M[key]
+}
+
+func isConditionFailed(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestFamilyItem(t *testing.T) {
+	invitedFamily := InvitedFamily{
+		Origin: "Nairobi", InviteName: "The Patel Family", InviteCode: 7,
+		VidhiInvited: MAX_INVITEES, VidhiRsvpd: 3, GarbaInvited: 0, GarbaRsvpd: NULL_INVITEES, WeddingInvited: 2, WeddingRsvpd: NULL_INVITEES,
+	}
+	item := familyItem(invitedFamily)
+	if _, ok := item["name"]; ok {
+		t.Errorf("Expected the empty name to be left out, got: +%v", item["name"])
+	}
+	if _, ok := item["invited"].M[Garba.Name]; ok {
+		t.Errorf("Expected the Garba invitation to be left out")
+	}
+	if _, ok := item["rsvpd"].M[Wedding.Name]; ok {
+		t.Errorf("Expected the Wedding RSVP to be left out")
+	}
+
+	roundTrip, err := familyFromItem(item)
+	if err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if roundTrip != invitedFamily {
+		t.Errorf("Expected +%v, got: +%v", invitedFamily, roundTrip)
+	}
+}
+
+func TestRsvpUpdateExpression(t *testing.T) {
+	update := rsvpUpdateExpression(7, map[Event]int{Vidhi: 3, Wedding: 0}, map[Event]int{Vidhi: 1})
+	if aws.StringValue(update.UpdateExpression) != "SET rsvpd.#e0 = :a0, childrenRsvpd.#e0 = :c0, rsvpd.#e2 = :a2 REMOVE childrenRsvpd.#e2" {
+		t.Errorf("Unexpected update expression: %s", aws.StringValue(update.UpdateExpression))
+	}
+	if aws.StringValue(update.ConditionExpression) != "attribute_exists(inviteCode) AND invited.#e0 >= :a0 AND (invited.#e2 >= :a2 OR attribute_not_exists(invited.#e2))" {
+		t.Errorf("Unexpected condition expression: %s", aws.StringValue(update.ConditionExpression))
+	}
+	if aws.StringValue(update.ExpressionAttributeNames["#e2"]) != Wedding.Name || aws.StringValue(update.ExpressionAttributeValues[":a0"].N) != "3" {
+		t.Errorf("Unexpected names & values: +%v +%v", update.ExpressionAttributeNames, update.ExpressionAttributeValues)
+	}
+}
+
+// TestDynamoStoreIntegration runs against DynamoDB Local, i.e.
+// `docker run -p 8000:8000 amazon/dynamodb-local` and
+// DYNAMODB_ENDPOINT=http://localhost:8000 AWS_REGION=us-east-1 AWS_ACCESS_KEY_ID=local AWS_SECRET_ACCESS_KEY=local go test -run Integration ./bot
+func TestDynamoStoreIntegration(t *testing.T) {
+	if os.Getenv("DYNAMODB_ENDPOINT") == "" {
+		t.Skip("DYNAMODB_ENDPOINT isn't set")
+	}
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	os.Setenv("DYNAMODB_FAMILIES_TABLE", "rsvper-test-families-"+suffix)
+	defer os.Unsetenv("DYNAMODB_FAMILIES_TABLE")
+	os.Setenv("DYNAMODB_UPDATE_EVENT_TABLE", "rsvper-test-update-event-"+suffix)
+	defer os.Unsetenv("DYNAMODB_UPDATE_EVENT_TABLE")
+	store, err := newDynamoStore()
+	if err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	createTestTable(t, store.client, store.familiesTable, "inviteCode", "")
+	defer store.client.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String(store.familiesTable)})
+	createTestTable(t, store.client, store.updateEventTable, "inviteCode", "updateId")
+	defer store.client.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String(store.updateEventTable)})
+
+	invitedFamily := syncedFamily(7, 4)
+	if err := store.AddFamily(invitedFamily); err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if err := store.AddFamily(invitedFamily); err == nil {
+		t.Errorf("Expected adding invite code 7 twice to fail")
+	}
+	if err := store.UpdateFamily(syncedFamily(8, 4)); err == nil {
+		t.Errorf("Expected updating a missing family to fail")
+	}
+
+	if err := store.SaveRsvps(7, "+15555550100", map[Event]int{Vidhi: 3}, nil); err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if err := store.SaveRsvps(7, "+15555550100", map[Event]int{Vidhi: 5}, nil); err == nil {
+		t.Errorf("Expected an RSVP over the invited count to fail")
+	}
+	if err := store.SaveRsvps(7, "+15555550100", map[Event]int{Wedding: 1}, nil); err == nil {
+		t.Errorf("Expected an RSVP to an event the family isn't invited to to fail")
+	}
+
+	found, ok, err := store.FindFamily(7)
+	if err != nil || !ok || found.VidhiRsvpd != 3 {
+		t.Errorf("Expected the Vidhi RSVP to be saved, got: +%v +%v", found, err)
+	}
+	history, err := store.RsvpHistory(7)
+	if err != nil || len(history) != 1 || history[0].Attendees != 3 {
+		t.Errorf("Expected only the saved RSVP in the history, got: +%v +%v", history, err)
+	}
+	if err := store.SaveRsvps(7, "+15555550100", map[Event]int{Wedding: 0}, nil); err != nil {
+		t.Errorf("Expected declining an event the family isn't invited to to be saved, got: +%v", err)
+	}
+	if families, err := store.AllFamilies(); err != nil || len(families) != 1 {
+		t.Errorf("Expected 1 family, got: +%v +%v", families, err)
+	}
+
+	if err := store.DeleteFamily(7); err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if _, ok, _ := store.FindFamily(7); ok {
+		t.Errorf("Expected invite code 7 to be deleted")
+	}
+}
+
+func createTestTable(t *testing.T, client *dynamodb.DynamoDB, tableName string, hashKey string, rangeKey string) {
+	input := &dynamodb.CreateTableInput{
+		TableName:            aws.String(tableName),
+		BillingMode:          aws.String(dynamodb.BillingModePayPerRequest),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{{AttributeName: aws.String(hashKey), AttributeType: aws.String(dynamodb.ScalarAttributeTypeN)}},
+		KeySchema:            []*dynamodb.KeySchemaElement{{AttributeName: aws.String(hashKey), KeyType: aws.String(dynamodb.KeyTypeHash)}},
+	}
+	if rangeKey != "" {
+		input.AttributeDefinitions = append(input.AttributeDefinitions, &dynamodb.AttributeDefinition{AttributeName: aws.String(rangeKey), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)})
+		input.KeySchema = append(input.KeySchema, &dynamodb.KeySchemaElement{AttributeName: aws.String(rangeKey), KeyType: aws.String(dynamodb.KeyTypeRange)})
+	}
+	if _, err := client.CreateTable(input); err != nil {
+		t.Fatalf("Unable to create %s: %v", tableName, err)
+	}
+	if err := client.WaitUntilTableExists(&dynamodb.DescribeTableInput{TableName: aws.String(tableName)}); err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+}
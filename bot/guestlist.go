@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ImportedFamily is a family read from a guest list CSV. RSVP cells left
+// blank keep the family's current RSVP when it's already in the guest list.
+type ImportedFamily struct {
+	InvitedFamily
+	Line     int
+	RsvpsSet map[Event]bool
+}
+
+// FamilyChange is a family the import adds or changes
+type FamilyChange struct {
+	InvitedFamily
+	IsNew   bool
+	Changes []string // i.e. Vidhi-Invite: 4 -> 5
+}
+
+// readGuestList reads and validates a guest list CSV, returning every problem
+// found so they can all be fixed at once
+func readGuestList(reader io.Reader) ([]ImportedFamily, []string) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+	if len(records) == 0 {
+		return nil, []string{"the file is empty"}
+	}
+
+	var header []interface{}
+	for _, cell := range records[0] {
+		header = append(header, cell)
+	}
+	columns, missing := newColumnMap(header, guestListColumns())
+	var problems []string
+	for _, column := range missing {
+		problems = append(problems, fmt.Sprintf("missing the %q column", column))
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+
+	var families []ImportedFamily
+	lines := make(map[int]int)
+	for i, record := range records[1:] {
+		line := i + 2
+		cell := func(column string) string {
+			if position := columns[column]; position < len(record) {
+				return strings.TrimSpace(record[position])
+			}
+			return ""
+		}
+		if strings.Join(record, "") == "" {
+			continue
+		}
+
+		family := ImportedFamily{Line: line, RsvpsSet: make(map[Event]bool)}
+		family.Origin, family.Name, family.InviteName = cell("Origin"), cell("Name"), cell("Invite Name")
+		if family.InviteName == "" {
+			problems = append(problems, fmt.Sprintf("line %d: Invite Name is empty", line))
+		}
+		inviteCode, err := strconv.Atoi(cell("Invite Code"))
+		switch {
+		case err != nil || inviteCode <= 0:
+			problems = append(problems, fmt.Sprintf("line %d: Invite Code has to be a positive number, got %q", line, cell("Invite Code")))
+		case lines[inviteCode] != 0:
+			problems = append(problems, fmt.Sprintf("line %d: Invite Code %d is already used on line %d", line, inviteCode, lines[inviteCode]))
+		default:
+			lines[inviteCode] = line
+		}
+		family.InviteCode = inviteCode
+
+		for _, event := range AllEvents {
+			invitedColumn, rsvpdColumn := eventColumnName(event, "Invite"), eventColumnName(event, "RSVP'd")
+			invited, err := parseInvitedCell(cell(invitedColumn))
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("line %d: %s %v", line, invitedColumn, err))
+			}
+			family.setInvited(event, invited)
+
+			rsvpd, set, err := parseRsvpCell(cell(rsvpdColumn))
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("line %d: %s %v", line, rsvpdColumn, err))
+			}
+			if rsvpd > invited {
+				problems = append(problems, fmt.Sprintf("line %d: %s (%d) is more than %s (%d)", line, rsvpdColumn, rsvpd, invitedColumn, invited))
+			}
+			family.setRsvpd(event, rsvpd)
+			family.RsvpsSet[event] = set
+			family.setChildrenRsvpd(event, NULL_INVITEES)
+			if event.CountsChildren {
+				problems = append(problems, readGuestListChildren(&family, event, cell, line)...)
+			}
+		}
+		families = append(families, family)
+	}
+	return families, problems
+}
+
+// readGuestListChildren reads the children columns of an event that counts
+// children. A blank Children-RSVP'd keeps the current one along with the RSVP.
+func readGuestListChildren(family *ImportedFamily, event Event, cell func(column string) string, line int) []string {
+	var problems []string
+	invitedColumn, rsvpdColumn := eventColumnName(event, "Children-Invite"), eventColumnName(event, "Children-RSVP'd")
+	invited, err := parseInvitedCell(cell(invitedColumn))
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("line %d: %s %v", line, invitedColumn, err))
+	}
+	if invited != MAX_INVITEES && family.invitedTo(event) != MAX_INVITEES && invited > family.invitedTo(event) {
+		problems = append(problems, fmt.Sprintf("line %d: %s (%d) is more than %s (%d)", line, invitedColumn, invited, eventColumnName(event, "Invite"), family.invitedTo(event)))
+	}
+	family.setChildrenInvited(event, invited)
+
+	rsvpd, _, err := parseRsvpCell(cell(rsvpdColumn))
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("line %d: %s %v", line, rsvpdColumn, err))
+	}
+	if rsvpd > family.rsvpdTo(event) {
+		problems = append(problems, fmt.Sprintf("line %d: %s (%d) is more than %s (%d)", line, rsvpdColumn, rsvpd, eventColumnName(event, "RSVP'd"), family.rsvpdTo(event)))
+	}
+	family.setChildrenRsvpd(event, rsvpd)
+	return problems
+}
+
+// parseInvitedCell reads an invited count: a number, ALL (unlimited), or NULL
+// or blank (not invited)
+func parseInvitedCell(cell string) (int, error) {
+	switch strings.ToUpper(cell) {
+	case "", "NULL":
+		return 0, nil
+	case "ALL":
+		return MAX_INVITEES, nil
+	}
+	invited, err := strconv.Atoi(cell)
+	if err != nil || invited < 0 {
+		return 0, fmt.Errorf("has to be a number, ALL or NULL, got %q", cell)
+	}
+	return invited, nil
+}
+
+// parseRsvpCell reads an RSVP count: a number, or NULL (no RSVP yet). It's
+// not set when the cell is blank.
+func parseRsvpCell(cell string) (int, bool, error) {
+	switch strings.ToUpper(cell) {
+	case "":
+		return NULL_INVITEES, false, nil
+	case "NULL":
+		return NULL_INVITEES, true, nil
+	}
+	rsvpd, err := strconv.Atoi(cell)
+	if err != nil || rsvpd < 0 {
+		return NULL_INVITEES, false, fmt.Errorf("has to be a number or NULL, got %q", cell)
+	}
+	return rsvpd, true, nil
+}
+
+// diffGuestList compares the imported families with the guest list. Families
+// that are only in the guest list are left alone.
+func diffGuestList(imported []ImportedFamily, existing []InvitedFamily) []FamilyChange {
+	byInviteCode := make(map[int]InvitedFamily)
+	for _, invitedFamily := range existing {
+		byInviteCode[invitedFamily.InviteCode] = invitedFamily
+	}
+
+	var changes []FamilyChange
+	for _, importedFamily := range imported {
+		current, found := byInviteCode[importedFamily.InviteCode]
+		if !found {
+			changes = append(changes, FamilyChange{InvitedFamily: importedFamily.InvitedFamily, IsNew: true})
+			continue
+		}
+
+		change := FamilyChange{InvitedFamily: importedFamily.InvitedFamily}
+		for _, event := range AllEvents {
+			if !importedFamily.RsvpsSet[event] {
+				change.setRsvpd(event, current.rsvpdTo(event))
+				change.setChildrenRsvpd(event, current.childrenRsvpdTo(event))
+			}
+		}
+		before, after := guestListRecord(current), guestListRecord(change.InvitedFamily)
+		for i, column := range guestListColumns() {
+			if before[i] != after[i] {
+				change.Changes = append(change.Changes, fmt.Sprintf("%s: %s -> %s", column, before[i], after[i]))
+			}
+		}
+		if len(change.Changes) > 0 {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+func guestListRecord(invitedFamily InvitedFamily) []string {
+	var record []string
+	for _, cell := range invitedFamilyRow(invitedFamily) {
+		record = append(record, fmt.Sprint(cell))
+	}
+	return record
+}
+
+func printGuestListDiff(writer io.Writer, changes []FamilyChange) {
+	for _, change := range changes {
+		if change.IsNew {
+			fmt.Fprintf(writer, "+ %d %s (new)\n", change.InviteCode, change.InviteName)
+			continue
+		}
+		fmt.Fprintf(writer, "~ %d %s\n", change.InviteCode, change.InviteName)
+		for _, line := range change.Changes {
+			fmt.Fprintf(writer, "    %s\n", line)
+		}
+	}
+}
+
+func importFamiliesCommand(args []string) error {
+	flags := flag.NewFlagSet("import-families", flag.ExitOnError)
+	fileName := flags.String("file", "", "guest list csv, with the INVITED_FAMILY columns as headers (required)")
+	dryRun := flags.Bool("dry-run", false, "only validate the file and show the changes")
+	yes := flags.Bool("yes", false, "apply the changes without asking")
+	flags.Parse(args)
+
+	if *fileName == "" {
+		return fmt.Errorf("-file is required")
+	}
+	file, err := os.Open(*fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	imported, problems := readGuestList(file)
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+		return fmt.Errorf("%d problems in %s, nothing was imported", len(problems), *fileName)
+	}
+	existing, err := guestStore.AllFamilies()
+	if err != nil {
+		return err
+	}
+
+	changes := diffGuestList(imported, existing)
+	printGuestListDiff(os.Stdout, changes)
+	fmt.Printf("%d families in the file, %d to add or update\n", len(imported), len(changes))
+	if len(changes) == 0 || *dryRun {
+		return nil
+	}
+	if !*yes {
+		fmt.Print("Apply these changes? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			fmt.Println("Nothing was imported")
+			return nil
+		}
+	}
+
+	var added []InvitedFamily
+	for _, change := range changes {
+		if change.IsNew {
+			added = append(added, change.InvitedFamily)
+			continue
+		}
+		if err := guestStore.UpdateFamily(change.InvitedFamily); err != nil {
+			return fmt.Errorf("unable to save invite code %d: %v", change.InviteCode, err)
+		}
+	}
+	return addFamilies(added)
+}
+
+// addFamilies adds the families in one go when the store can (the sheet is
+// only read & appended to once), and one at a time otherwise
+func addFamilies(invitedFamilies []InvitedFamily) error {
+	if store, ok := guestStore.(*sheetsStore); ok {
+		return store.AddFamilies(invitedFamilies)
+	}
+	for _, invitedFamily := range invitedFamilies {
+		if err := guestStore.AddFamily(invitedFamily); err != nil {
+			return fmt.Errorf("unable to save invite code %d: %v", invitedFamily.InviteCode, err)
+		}
+	}
+	return nil
+}
+
+func exportFamiliesCommand(args []string) error {
+	flags := flag.NewFlagSet("export-families", flag.ExitOnError)
+	outputFile := flags.String("out", "", "file to write the guest list to (default stdout)")
+	flags.Parse(args)
+
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		return err
+	}
+
+	var writer io.Writer = os.Stdout
+	if *outputFile != "" {
+		file, err := os.Create(*outputFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+	return writeGuestList(writer, invitedFamilies)
+}
+
+// writeGuestList writes the families & their latest RSVPs in the same format import-families reads
+func writeGuestList(writer io.Writer, invitedFamilies []InvitedFamily) error {
+	sort.SliceStable(invitedFamilies, func(i, j int) bool { return invitedFamilies[i].InviteCode < invitedFamilies[j].InviteCode })
+	csvWriter := csv.NewWriter(writer)
+	csvWriter.Write(guestListColumns())
+	for _, invitedFamily := range invitedFamilies {
+		csvWriter.Write(guestListRecord(invitedFamily))
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const mockGuestList = `Origin,Name,Invite Name,Invite Code,Vidhi-Invite,Vidhi-RSVP'd,Garba-Invite,Garba-RSVP'd,Wedding-Invite,Wedding-RSVP'd
+Mumbai,Rakesh,The Patel Family,7,5,,NULL,,4,NULL
+Chicago,Nikhil,The Shah Family,8,,,ALL,6,ALL,
+`
+
+func TestReadGuestList(t *testing.T) {
+	families, problems := readGuestList(strings.NewReader(mockGuestList))
+	if len(problems) > 0 {
+		t.Fatalf("Error: +%v", problems)
+	}
+	if len(families) != 2 {
+		t.Fatalf("Expected 2 families, got: +%v", families)
+	}
+	shah := families[1]
+	if shah.GarbaInvited != MAX_INVITEES || shah.GarbaRsvpd != 6 || shah.VidhiInvited != 0 || shah.WeddingRsvpd != NULL_INVITEES {
+		t.Errorf("Unexpected family: +%v", shah)
+	}
+	if !shah.RsvpsSet[Garba] || shah.RsvpsSet[Wedding] {
+		t.Errorf("Expected only the garba RSVP to be set, got: +%v", shah.RsvpsSet)
+	}
+}
+
+func TestReadGuestListProblems(t *testing.T) {
+	guestList := `Origin,Name,Invite Name,Invite Code,Vidhi-Invite,Vidhi-RSVP'd,Garba-Invite,Garba-RSVP'd,Wedding-Invite,Wedding-RSVP'd
+Mumbai,Rakesh,The Patel Family,7,4 ppl,,,,2,3
+Chicago,Nikhil,The Shah Family,7,,,,,,
+`
+	_, problems := readGuestList(strings.NewReader(guestList))
+	expected := []string{
+		`line 2: Vidhi-Invite has to be a number, ALL or NULL, got "4 ppl"`,
+		`line 2: Wedding-RSVP'd (3) is more than Wedding-Invite (2)`,
+		`line 3: Invite Code 7 is already used on line 2`,
+	}
+	if strings.Join(problems, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected problems:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(problems, "\n"))
+	}
+
+	if _, problems := readGuestList(strings.NewReader("Origin,Name,Invite Code\n")); len(problems) != 7 {
+		t.Errorf("Expected the 7 missing columns to be reported, got: +%v", problems)
+	}
+}
+
+func TestDiffGuestList(t *testing.T) {
+	imported, _ := readGuestList(strings.NewReader(mockGuestList))
+	existing := []InvitedFamily{
+		{Origin: "Mumbai", Name: "Rakesh", InviteName: "The Patel Family", InviteCode: 7, VidhiInvited: 4, VidhiRsvpd: 3, GarbaRsvpd: NULL_INVITEES, WeddingInvited: 4, WeddingRsvpd: 2},
+	}
+
+	changes := diffGuestList(imported, existing)
+	if len(changes) != 2 || changes[0].IsNew || !changes[1].IsNew {
+		t.Fatalf("Expected a change & a new family, got: +%v", changes)
+	}
+	expected := []string{"Vidhi-Invite: 4 -> 5", "Wedding-RSVP'd: 2 -> NULL"}
+	if strings.Join(changes[0].Changes, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Expected changes: +%v, got: +%v", expected, changes[0].Changes)
+	}
+	if changes[0].VidhiRsvpd != 3 {
+		t.Errorf("Expected the blank vidhi RSVP to keep the current RSVP, got: %d", changes[0].VidhiRsvpd)
+	}
+}
+
+func TestWriteGuestList(t *testing.T) {
+	imported, _ := readGuestList(strings.NewReader(mockGuestList))
+	var families []InvitedFamily
+	for _, family := range imported {
+		families = append(families, family.InvitedFamily)
+	}
+
+	var csv bytes.Buffer
+	if err := writeGuestList(&csv, families); err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	expected := `Origin,Name,Invite Name,Invite Code,Vidhi-Invite,Vidhi-RSVP'd,Garba-Invite,Garba-RSVP'd,Wedding-Invite,Wedding-RSVP'd
+Mumbai,Rakesh,The Patel Family,7,5,NULL,NULL,NULL,4,NULL
+Chicago,Nikhil,The Shah Family,8,NULL,NULL,ALL,6,ALL,NULL
+`
+	if csv.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, csv.String())
+	}
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+const (
+	HOTEL_BLOCK     = "HOTEL_BLOCK"
+	ROOM_ASSIGNMENT = "ROOM_ASSIGNMENT"
+)
+
+// RoomBlock is the rooms of one type we hold at a hotel, from CheckIn to
+// CheckOut. Details are sent to the families given these rooms (i.e. the
+// address & how to check in).
+type RoomBlock struct {
+	Hotel    string
+	RoomType string
+	Sleeps   int // guests per room
+	Rooms    int
+	CheckIn  time.Time
+	CheckOut time.Time
+	Details  string
+}
+
+// RoomAssignment is the rooms a family is staying in. The hosts can add or
+// edit these by hand in ROOM_ASSIGNMENT, and allocate-rooms never changes them.
+type RoomAssignment struct {
+	InviteCode   int
+	Hotel        string
+	RoomType     string
+	Rooms        int
+	CheckIn      time.Time
+	CheckOut     time.Time
+	Confirmation string
+	NotifiedAt   string
+	rowNumber    int
+}
+
+func (block RoomBlock) key() string {
+	return strings.ToLower(block.Hotel + "|" + block.RoomType)
+}
+
+func (assignment RoomAssignment) key() string {
+	return strings.ToLower(assignment.Hotel + "|" + assignment.RoomType)
+}
+
+// stayNights are the nights from check in up to (but not including) check out
+func stayNights(checkIn time.Time, checkOut time.Time) []string {
+	var nights []string
+	for night := checkIn; night.Before(checkOut); night = night.AddDate(0, 0, 1) {
+		nights = append(nights, night.Format(DATE_FORMAT))
+	}
+	return nights
+}
+
+// dateOnly drops the time of an arrival or departure
+func dateOnly(when time.Time) time.Time {
+	return time.Date(when.Year(), when.Month(), when.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// roomsBooked is how many rooms of each block are taken on each night
+func roomsBooked(assignments []RoomAssignment) map[string]map[string]int {
+	booked := make(map[string]map[string]int)
+	for _, assignment := range assignments {
+		if booked[assignment.key()] == nil {
+			booked[assignment.key()] = make(map[string]int)
+		}
+		for _, night := range stayNights(assignment.CheckIn, assignment.CheckOut) {
+			booked[assignment.key()][night] += assignment.Rooms
+		}
+	}
+	return booked
+}
+
+// overbookedNights are the nights the assignments (i.e. the hosts' manual
+// ones) take more rooms than a block has, or fall outside its dates
+func overbookedNights(blocks []RoomBlock, assignments []RoomAssignment) []string {
+	booked := roomsBooked(assignments)
+	var problems []string
+	for _, block := range blocks {
+		blockNights := make(map[string]bool)
+		for _, night := range stayNights(block.CheckIn, block.CheckOut) {
+			blockNights[night] = true
+		}
+		nights := make([]string, 0, len(booked[block.key()]))
+		for night := range booked[block.key()] {
+			nights = append(nights, night)
+		}
+		sort.Strings(nights)
+		for _, night := range nights {
+			switch rooms := booked[block.key()][night]; {
+			case !blockNights[night]:
+				problems = append(problems, fmt.Sprintf("%s %s: %d rooms on %s, which isn't in the block", block.Hotel, block.RoomType, rooms, night))
+			case rooms > block.Rooms:
+				problems = append(problems, fmt.Sprintf("%s %s: %d of %d rooms on %s", block.Hotel, block.RoomType, rooms, block.Rooms, night))
+			}
+		}
+	}
+	return problems
+}
+
+// familyGuests is the most guests the family RSVP'd to any one event
+func familyGuests(invitedFamily InvitedFamily) int {
+	var guests int
+	for _, rsvpd := range invitedFamily.rsvps() {
+		if rsvpd > guests {
+			guests = rsvpd
+		}
+	}
+	return guests
+}
+
+// proposeRoomAssignments assigns rooms to the families that asked for them in
+// TRAVEL and don't have any yet, biggest families first. Each family gets the
+// block that fits their stay (their arrival & departure dates, or the whole
+// block when they skipped those) with the fewest empty beds, as many rooms as
+// they asked for (more when their guests don't fit), and never more rooms on a
+// night than the block has left. The families that couldn't be given rooms are
+// returned with why.
+func proposeRoomAssignments(blocks []RoomBlock, assignments []RoomAssignment, invitedFamilies []InvitedFamily, travelDetails map[int]TravelDetails) ([]RoomAssignment, map[int]string) {
+	assigned := make(map[int]bool)
+	for _, assignment := range assignments {
+		assigned[assignment.InviteCode] = true
+	}
+	var families []InvitedFamily
+	for _, invitedFamily := range invitedFamilies {
+		if travelDetails[invitedFamily.InviteCode].Rooms > 0 && familyGuests(invitedFamily) > 0 && !assigned[invitedFamily.InviteCode] {
+			families = append(families, invitedFamily)
+		}
+	}
+	sort.SliceStable(families, func(i, j int) bool {
+		if guestsI, guestsJ := familyGuests(families[i]), familyGuests(families[j]); guestsI != guestsJ {
+			return guestsI > guestsJ
+		}
+		return families[i].InviteCode < families[j].InviteCode
+	})
+
+	booked := roomsBooked(assignments)
+	var proposals []RoomAssignment
+	unallocated := make(map[int]string)
+	for _, invitedFamily := range families {
+		details, guests := travelDetails[invitedFamily.InviteCode], familyGuests(invitedFamily)
+		best, bestEmptyBeds := -1, 0
+		var bestAssignment RoomAssignment
+		for i, block := range blocks {
+			checkIn, checkOut := block.CheckIn, block.CheckOut
+			if !details.Arrival.IsZero() {
+				checkIn = dateOnly(details.Arrival)
+			}
+			if !details.Departure.IsZero() {
+				checkOut = dateOnly(details.Departure)
+			}
+			if checkIn.Before(block.CheckIn) || checkOut.After(block.CheckOut) || !checkIn.Before(checkOut) || block.Sleeps < 1 {
+				continue
+			}
+			rooms := details.Rooms
+			if needed := (guests + block.Sleeps - 1) / block.Sleeps; needed > rooms {
+				rooms = needed
+			}
+			fits := true
+			for _, night := range stayNights(checkIn, checkOut) {
+				if booked[block.key()][night]+rooms > block.Rooms {
+					fits = false
+					break
+				}
+			}
+			if emptyBeds := rooms*block.Sleeps - guests; fits && (best == -1 || emptyBeds < bestEmptyBeds) {
+				best, bestEmptyBeds = i, emptyBeds
+				bestAssignment = RoomAssignment{InviteCode: invitedFamily.InviteCode, Hotel: block.Hotel, RoomType: block.RoomType, Rooms: rooms, CheckIn: checkIn, CheckOut: checkOut}
+			}
+		}
+		if best == -1 {
+			unallocated[invitedFamily.InviteCode] = fmt.Sprintf("no block has %d rooms for %d guests left on all their nights", details.Rooms, guests)
+			continue
+		}
+		if booked[bestAssignment.key()] == nil {
+			booked[bestAssignment.key()] = make(map[string]int)
+		}
+		for _, night := range stayNights(bestAssignment.CheckIn, bestAssignment.CheckOut) {
+			booked[bestAssignment.key()][night] += bestAssignment.Rooms
+		}
+		proposals = append(proposals, bestAssignment)
+	}
+	return proposals, unallocated
+}
+
+func parseSheetDate(cell interface{}) (time.Time, error) {
+	return time.ParseInLocation(DATE_FORMAT, strings.TrimSpace(fmt.Sprint(cell)), time.Local)
+}
+
+func readRoomBlocks() ([]RoomBlock, error) {
+	rows, err := getGoogleSheetsData(HOTEL_BLOCK, "A2:G")
+	if err != nil {
+		return nil, err
+	}
+	var blocks []RoomBlock
+	for i, row := range rows {
+		if len(row) < 6 {
+			continue
+		}
+		sleeps, sleepsErr := strconv.Atoi(fmt.Sprint(row[2]))
+		rooms, roomsErr := strconv.Atoi(fmt.Sprint(row[3]))
+		checkIn, checkInErr := parseSheetDate(row[4])
+		checkOut, checkOutErr := parseSheetDate(row[5])
+		if sleepsErr != nil || roomsErr != nil || checkInErr != nil || checkOutErr != nil {
+			log.Printf("Skipping hotel block (%d) as its sleeps & rooms aren't numbers or its dates aren't like 2019-03-14: %v", i+2, row)
+			continue
+		}
+		block := RoomBlock{Hotel: fmt.Sprint(row[0]), RoomType: fmt.Sprint(row[1]), Sleeps: sleeps, Rooms: rooms, CheckIn: checkIn, CheckOut: checkOut}
+		if len(row) > 6 {
+			block.Details = fmt.Sprint(row[6])
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+func readRoomAssignments() ([]RoomAssignment, error) {
+	rows, err := getGoogleSheetsData(ROOM_ASSIGNMENT, "A2:H")
+	if err != nil {
+		return nil, err
+	}
+	var assignments []RoomAssignment
+	for i, row := range rows {
+		if len(row) < 6 {
+			continue
+		}
+		inviteCode, codeErr := strconv.Atoi(fmt.Sprint(row[0]))
+		rooms, roomsErr := strconv.Atoi(fmt.Sprint(row[3]))
+		checkIn, checkInErr := parseSheetDate(row[4])
+		checkOut, checkOutErr := parseSheetDate(row[5])
+		if codeErr != nil || roomsErr != nil || checkInErr != nil || checkOutErr != nil {
+			log.Printf("Skipping room assignment (%d) as its invite code & rooms aren't numbers or its dates aren't like 2019-03-14: %v", i+2, row)
+			continue
+		}
+		assignment := RoomAssignment{InviteCode: inviteCode, Hotel: fmt.Sprint(row[1]), RoomType: fmt.Sprint(row[2]), Rooms: rooms, CheckIn: checkIn, CheckOut: checkOut, rowNumber: i + 2}
+		if len(row) > 6 {
+			assignment.Confirmation = fmt.Sprint(row[6])
+		}
+		if len(row) > 7 {
+			assignment.NotifiedAt = fmt.Sprint(row[7])
+		}
+		assignments = append(assignments, assignment)
+	}
+	return assignments, nil
+}
+
+func roomAssignmentRow(assignment RoomAssignment) []interface{} {
+	return []interface{}{assignment.InviteCode, assignment.Hotel, assignment.RoomType, assignment.Rooms, assignment.CheckIn.Format(DATE_FORMAT), assignment.CheckOut.Format(DATE_FORMAT), assignment.Confirmation, assignment.NotifiedAt}
+}
+
+func writeRoomAssignments(writer io.Writer, assignments []RoomAssignment, invitedFamilies []InvitedFamily) error {
+	inviteNames := make(map[int]string)
+	for _, invitedFamily := range invitedFamilies {
+		inviteNames[invitedFamily.InviteCode] = invitedFamily.InviteName
+	}
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "Invite Code\tInvite Name\tHotel\tRoom Type\tRooms\tCheck In\tCheck Out")
+	for _, assignment := range assignments {
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s\t%d\t%s\t%s\n", assignment.InviteCode, inviteNames[assignment.InviteCode], assignment.Hotel, assignment.RoomType, assignment.Rooms, assignment.CheckIn.Format(DATE_FORMAT), assignment.CheckOut.Format(DATE_FORMAT))
+	}
+	return table.Flush()
+}
+
+func allocateRoomsCommand(args []string) error {
+	flags := flag.NewFlagSet("allocate-rooms", flag.ExitOnError)
+	save := flags.Bool("save", false, "add the proposed assignments to ROOM_ASSIGNMENT (default only print them)")
+	flags.Parse(args)
+
+	blocks, err := readRoomBlocks()
+	if err != nil {
+		return err
+	}
+	assignments, err := readRoomAssignments()
+	if err != nil {
+		return err
+	}
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		return err
+	}
+	travelDetails, err := readTravelDetails()
+	if err != nil {
+		return err
+	}
+
+	for _, problem := range overbookedNights(blocks, assignments) {
+		log.Printf("Overbooked by the existing assignments: %s", problem)
+	}
+	proposals, unallocated := proposeRoomAssignments(blocks, assignments, invitedFamilies, travelDetails)
+	if err := writeRoomAssignments(os.Stdout, proposals, invitedFamilies); err != nil {
+		return err
+	}
+	var inviteCodes []int
+	for inviteCode := range unallocated {
+		inviteCodes = append(inviteCodes, inviteCode)
+	}
+	sort.Ints(inviteCodes)
+	for _, inviteCode := range inviteCodes {
+		fmt.Printf("Couldn't find rooms for invite code %d: %s\n", inviteCode, unallocated[inviteCode])
+	}
+	if !*save || len(proposals) == 0 {
+		return nil
+	}
+	var rows [][]interface{}
+	for _, proposal := range proposals {
+		rows = append(rows, roomAssignmentRow(proposal))
+	}
+	_, err = appendGoogleSheetsData(ROOM_ASSIGNMENT, rows)
+	return err
+}
+
+// assignRoomCommand is the hosts' manual override: it replaces the family's
+// assignments, even when that overbooks the block (which is only warned about)
+func assignRoomCommand(args []string) error {
+	flags := flag.NewFlagSet("assign-room", flag.ExitOnError)
+	inviteCode := flags.Int("invite-code", 0, "the family to assign the rooms to (required)")
+	hotel := flags.String("hotel", "", "the hotel, as it's written in HOTEL_BLOCK (required)")
+	roomType := flags.String("room-type", "", "the room type, as it's written in HOTEL_BLOCK (required)")
+	rooms := flags.Int("rooms", 1, "how many rooms, 0 removes the family's assignments")
+	checkIn := flags.String("check-in", "", "i.e. 2019-03-14 (default the block's check in)")
+	checkOut := flags.String("check-out", "", "i.e. 2019-03-18 (default the block's check out)")
+	confirmation := flags.String("confirmation", "", "the hotel's confirmation number, sent to the family")
+	flags.Parse(args)
+
+	if *inviteCode == 0 {
+		return fmt.Errorf("-invite-code is required")
+	}
+	if *rooms == 0 {
+		return replaceFamilyRows(ROOM_ASSIGNMENT, *inviteCode, nil)
+	}
+	blocks, err := readRoomBlocks()
+	if err != nil {
+		return err
+	}
+	assignment := RoomAssignment{InviteCode: *inviteCode, Hotel: *hotel, RoomType: *roomType, Rooms: *rooms, Confirmation: *confirmation}
+	var block RoomBlock
+	for _, b := range blocks {
+		if b.key() == assignment.key() {
+			block = b
+		}
+	}
+	if block.Hotel == "" {
+		return fmt.Errorf("there's no %q %q block in HOTEL_BLOCK", *hotel, *roomType)
+	}
+	assignment.Hotel, assignment.RoomType, assignment.CheckIn, assignment.CheckOut = block.Hotel, block.RoomType, block.CheckIn, block.CheckOut
+	if *checkIn != "" {
+		if assignment.CheckIn, err = parseSheetDate(*checkIn); err != nil {
+			return err
+		}
+	}
+	if *checkOut != "" {
+		if assignment.CheckOut, err = parseSheetDate(*checkOut); err != nil {
+			return err
+		}
+	}
+	if !assignment.CheckIn.Before(assignment.CheckOut) {
+		return fmt.Errorf("check in has to be before check out")
+	}
+
+	assignments, err := readRoomAssignments()
+	if err != nil {
+		return err
+	}
+	others := []RoomAssignment{assignment}
+	for _, existing := range assignments {
+		if existing.InviteCode != *inviteCode {
+			others = append(others, existing)
+		}
+	}
+	for _, problem := range overbookedNights([]RoomBlock{block}, others) {
+		log.Printf("Warning, overbooked: %s", problem)
+	}
+	return replaceFamilyRows(ROOM_ASSIGNMENT, *inviteCode, [][]interface{}{roomAssignmentRow(assignment)})
+}
+
+// notifyRooms texts each family's phone numbers their hotel booking, for the
+// assignments that haven't been sent yet. A family is told about all their
+// assignments in one text.
+func notifyRooms(provider SmsProvider, assignments []RoomAssignment, blocks []RoomBlock, invitedFamilies []InvitedFamily, directory []PhoneDirectoryEntry, writeNotified func(assignment RoomAssignment) error) campaignSummary {
+	familiesByInviteCode := make(map[int]InvitedFamily)
+	for _, invitedFamily := range invitedFamilies {
+		familiesByInviteCode[invitedFamily.InviteCode] = invitedFamily
+	}
+	details := make(map[string]string)
+	for _, block := range blocks {
+		details[block.key()] = block.Details
+	}
+	pending := make(map[int][]RoomAssignment)
+	var inviteCodes []int
+	for _, assignment := range assignments {
+		if assignment.NotifiedAt != "" {
+			continue
+		}
+		if pending[assignment.InviteCode] == nil {
+			inviteCodes = append(inviteCodes, assignment.InviteCode)
+		}
+		pending[assignment.InviteCode] = append(pending[assignment.InviteCode], assignment)
+	}
+
+	var summary campaignSummary
+	for _, inviteCode := range inviteCodes {
+		invitedFamily, ok := familiesByInviteCode[inviteCode]
+		if !ok {
+			log.Printf("No invited family for the room assignment of invite code %d", inviteCode)
+			summary.Skipped++
+			continue
+		}
+		message := roomAssignmentMsg(invitedFamily, pending[inviteCode], details)
+		var sent bool
+		for _, entry := range directory {
+			if entry.InviteCode != inviteCode {
+				continue
+			}
+			if _, err := provider.SendSms(entry.PhoneNumber, message); err != nil {
+				log.Printf("Unable to send the room assignment of invite code %d to %s: %v", inviteCode, entry.PhoneNumber, err)
+				continue
+			}
+			sent = true
+		}
+		if !sent {
+			summary.Failed++
+			continue
+		}
+		summary.Sent++
+		for _, assignment := range pending[inviteCode] {
+			if err := writeNotified(assignment); err != nil {
+				log.Printf("Unable to save that invite code %d was sent their room assignment: %v", inviteCode, err)
+			}
+		}
+	}
+	return summary
+}
+
+// writeRoomNotified saves when the family was sent the assignment, so it isn't sent again
+func writeRoomNotified(assignment RoomAssignment) error {
+	writeRange := ROOM_ASSIGNMENT + "!H" + strconv.Itoa(assignment.rowNumber)
+	_, err := setGoogleSheetsData([]*sheets.ValueRange{{Values: [][]interface{}{{time.Now()}}, Range: writeRange}})
+	return err
+}
+
+func notifyRoomsCommand(args []string) error {
+	flags := flag.NewFlagSet("notify-rooms", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "print the texts instead of sending them (nothing is written to the sheet)")
+	providerName := flags.String("provider", "twilio", "sms provider: twilio, stdout or file")
+	outputFile := flags.String("out", "rooms.txt", "file the texts are written to when -provider=file")
+	flags.Parse(args)
+
+	assignments, err := readRoomAssignments()
+	if err != nil {
+		return err
+	}
+	blocks, err := readRoomBlocks()
+	if err != nil {
+		return err
+	}
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		return err
+	}
+	directory, err := getPhoneDirectory()
+	if err != nil {
+		return err
+	}
+
+	var provider SmsProvider = &WriterSmsProvider{Writer: os.Stdout}
+	writeNotified := writeRoomNotified
+	if *dryRun {
+		writeNotified = func(assignment RoomAssignment) error { return nil }
+	} else if provider, err = newSmsProvider(*providerName, *outputFile); err != nil {
+		return err
+	}
+
+	summary := notifyRooms(provider, assignments, blocks, invitedFamilies, directory, writeNotified)
+	log.Printf("Room assignments sent: %d, failed: %d, skipped: %d", summary.Sent, summary.Failed, summary.Skipped)
+	if summary.Failed > 0 {
+		return fmt.Errorf("%d families couldn't be texted (are they in PHONE_DIRECTORY?), run notify-rooms again to retry them", summary.Failed)
+	}
+	return nil
+}
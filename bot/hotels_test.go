@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testDate(day int) time.Time {
+	return time.Date(2019, 3, day, 0, 0, 0, 0, time.Local)
+}
+
+func TestProposeRoomAssignments(t *testing.T) {
+	blocks := []RoomBlock{
+		{Hotel: "Hyatt", RoomType: "Double Queen", Sleeps: 4, Rooms: 2, CheckIn: testDate(13), CheckOut: testDate(18)},
+		{Hotel: "Hyatt", RoomType: "King", Sleeps: 2, Rooms: 1, CheckIn: testDate(13), CheckOut: testDate(18)},
+	}
+	invitedFamilies := []InvitedFamily{
+		{InviteCode: 1, VidhiRsvpd: 2, GarbaRsvpd: NULL_INVITEES, WeddingRsvpd: NULL_INVITEES},
+		{InviteCode: 2, VidhiRsvpd: 6, GarbaRsvpd: NULL_INVITEES, WeddingRsvpd: NULL_INVITEES},
+		{InviteCode: 3, VidhiRsvpd: 2, GarbaRsvpd: NULL_INVITEES, WeddingRsvpd: NULL_INVITEES},
+		{InviteCode: 4, VidhiRsvpd: 3, GarbaRsvpd: NULL_INVITEES, WeddingRsvpd: NULL_INVITEES},
+		{InviteCode: 5, VidhiRsvpd: 2, GarbaRsvpd: NULL_INVITEES, WeddingRsvpd: NULL_INVITEES},
+	}
+	travelDetails := map[int]TravelDetails{
+		1: {Rooms: 1, Arrival: testDate(14).Add(15 * time.Hour), Departure: testDate(16).Add(9 * time.Hour)},
+		2: {Rooms: 1}, // 6 guests need 2 of the Double Queens
+		3: {Rooms: 1, Arrival: testDate(15), Departure: testDate(17)},
+		4: {Rooms: 1},
+		5: {Rooms: 0},
+	}
+	// The hosts gave family 9 the King on the 16th by hand
+	assignments := []RoomAssignment{{InviteCode: 9, Hotel: "hyatt", RoomType: "king", Rooms: 1, CheckIn: testDate(16), CheckOut: testDate(17)}}
+
+	proposals, unallocated := proposeRoomAssignments(blocks, assignments, invitedFamilies, travelDetails)
+	var got []string
+	for _, proposal := range proposals {
+		got = append(got, proposal.RoomType+" "+proposal.CheckIn.Format("2")+"-"+proposal.CheckOut.Format("2"))
+		if proposal.InviteCode == 2 && proposal.Rooms != 2 {
+			t.Errorf("Expected 6 guests to get 2 rooms, got: +%v", proposal)
+		}
+	}
+	if expected := "Double Queen 13-18, King 14-16"; strings.Join(got, ", ") != expected {
+		t.Errorf("Expected %s, got: %s", expected, strings.Join(got, ", "))
+	}
+	if len(unallocated) != 2 || unallocated[3] == "" || unallocated[4] == "" {
+		t.Errorf("Expected families 3 & 4 not to fit, got: +%v", unallocated)
+	}
+
+	if problems := overbookedNights(blocks, append(assignments, proposals...)); len(problems) != 0 {
+		t.Errorf("Expected the proposals to stay within the blocks, got: +%v", problems)
+	}
+	overbooked := append(assignments, RoomAssignment{InviteCode: 3, Hotel: "Hyatt", RoomType: "King", Rooms: 1, CheckIn: testDate(16), CheckOut: testDate(19)})
+	if problems := overbookedNights(blocks, overbooked); len(problems) != 2 {
+		t.Errorf("Expected the 16th to be overbooked and the 18th not in the block, got: +%v", problems)
+	}
+}
+
+func TestNotifyRooms(t *testing.T) {
+	blocks := []RoomBlock{{Hotel: "Hyatt", RoomType: "King", Details: "123 Main St, check in from 3pm."}}
+	assignments := []RoomAssignment{
+		{InviteCode: 1, Hotel: "Hyatt", RoomType: "King", Rooms: 2, CheckIn: testDate(14), CheckOut: testDate(16), Confirmation: "HY123"},
+		{InviteCode: 2, Hotel: "Hyatt", RoomType: "King", Rooms: 1, CheckIn: testDate(14), CheckOut: testDate(16), NotifiedAt: "2019-03-01"},
+		{InviteCode: 3, Hotel: "Hyatt", RoomType: "King", Rooms: 1, CheckIn: testDate(14), CheckOut: testDate(16)},
+	}
+	invitedFamilies := []InvitedFamily{{InviteCode: 1, InviteName: "The Shah Family"}, {InviteCode: 2}, {InviteCode: 3}}
+	directory := []PhoneDirectoryEntry{{InviteCode: 1, PhoneNumber: "+15550001"}, {InviteCode: 2, PhoneNumber: "+15550002"}}
+
+	var buffer bytes.Buffer
+	var notified []int
+	summary := notifyRooms(&WriterSmsProvider{Writer: &buffer}, assignments, blocks, invitedFamilies, directory, func(assignment RoomAssignment) error {
+		notified = append(notified, assignment.InviteCode)
+		return nil
+	})
+	if summary.Sent != 1 || summary.Failed != 1 || len(notified) != 1 || notified[0] != 1 {
+		t.Errorf("Expected only family 1 to be texted (3 has no phone number), got: +%v %v", summary, notified)
+	}
+	if expected := "Hi The Shah Family! We've booked 2 King rooms at Hyatt, checking in Thu Mar 14 & out Sat Mar 16 (confirmation HY123). 123 Main St, check in from 3pm. See you soon!"; !strings.Contains(buffer.String(), expected) {
+		t.Errorf("Expected %s, got: %s", expected, buffer.String())
+	}
+}
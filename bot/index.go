@@ -0,0 +1,205 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+const (
+	// INVITE_CODE_METADATA_KEY is the developer metadata key of the invite code
+	// index. Each INVITED_FAMILY row is tagged with its invite code, and the
+	// tag moves with the row when rows are inserted, sorted or deleted.
+	INVITE_CODE_METADATA_KEY = "invite_code"
+
+	// SHEET_PAGE_SIZE is the number of rows read at a time
+	SHEET_PAGE_SIZE = 1000
+)
+
+var rangeRowNumber = regexp.MustCompile(`![A-Z]*(\d+)`)
+
+// getAllGoogleSheetsRows reads every row of the sheet, a page at a time, so
+// there's no limit to the number of rows
+func getAllGoogleSheetsRows(sheetName string) ([][]interface{}, error) {
+	return readRowsInPages(SHEET_PAGE_SIZE, func(first int, last int) ([][]interface{}, error) {
+		return getGoogleSheetsData(sheetName, strconv.Itoa(first)+":"+strconv.Itoa(last))
+	})
+}
+
+// readRowsInPages stops at the first page without any rows. The sheets lib
+// leaves out trailing empty rows, so each page but the last is padded back
+// to its full size to keep the row numbers right.
+func readRowsInPages(pageSize int, readPage func(first int, last int) ([][]interface{}, error)) ([][]interface{}, error) {
+	var rows [][]interface{}
+	for first := 1; ; first += pageSize {
+		page, err := readPage(first, first+pageSize-1)
+		if err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			return rows, nil
+		}
+		for len(rows) < first-1 {
+			rows = append(rows, []interface{}{})
+		}
+		rows = append(rows, page...)
+	}
+}
+
+// findIndexedInvitedFamily reads only the header row and the rows tagged with
+// the invite code. It returns a row number of 0 when no tagged row has the
+// invite code (the row isn't indexed yet, or its invite code was changed).
+func findIndexedInvitedFamily(inviteCode int) ([]interface{}, int, ColumnMap, error) {
+	headerFilter := &sheets.DataFilter{A1Range: INVITED_FAMILY + "!1:1"}
+	request := &sheets.BatchGetValuesByDataFilterRequest{DataFilters: []*sheets.DataFilter{headerFilter, inviteCodeFilter(inviteCode)}}
+	resp, err := getGoogleSheetsClient().Spreadsheets.Values.BatchGetByDataFilter(spreadsheetID, request).Do()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	var header []interface{}
+	var tagged []*sheets.ValueRange
+	for _, matched := range resp.ValueRanges {
+		if matched.ValueRange == nil {
+			continue
+		}
+		if len(matched.DataFilters) > 0 && matched.DataFilters[0].A1Range != "" {
+			if len(matched.ValueRange.Values) > 0 {
+				header = matched.ValueRange.Values[0]
+			}
+		} else {
+			tagged = append(tagged, matched.ValueRange)
+		}
+	}
+	columns, missing := newColumnMap(header, guestListColumns())
+	if len(missing) > 0 {
+		return nil, 0, columns, fmt.Errorf("%s doesn't have the %v column(s)", INVITED_FAMILY, missing)
+	}
+
+	for _, valueRange := range tagged {
+		rowNumber := rowNumberOfRange(valueRange.Range)
+		if rowNumber < 2 || len(valueRange.Values) == 0 {
+			continue
+		}
+		row := valueRange.Values[0]
+		if fmt.Sprint(columns.cell(row, "Invite Code")) == strconv.Itoa(inviteCode) {
+			return row, rowNumber, columns, nil
+		}
+	}
+	return nil, 0, columns, nil
+}
+
+// rowNumberOfRange is the first row of a range like INVITED_FAMILY!A12:J12
+func rowNumberOfRange(a1Range string) int {
+	match := rangeRowNumber.FindStringSubmatch(a1Range)
+	if match == nil {
+		return 0
+	}
+	rowNumber, _ := strconv.Atoi(match[1])
+	return rowNumber
+}
+
+func inviteCodeFilter(inviteCode int) *sheets.DataFilter {
+	return &sheets.DataFilter{DeveloperMetadataLookup: &sheets.DeveloperMetadataLookup{
+		LocationType:  "ROW",
+		MetadataKey:   INVITE_CODE_METADATA_KEY,
+		MetadataValue: strconv.Itoa(inviteCode),
+	}}
+}
+
+func tagInviteCodeRequest(sheetID int64, inviteCode int, rowNumber int) *sheets.Request {
+	return &sheets.Request{CreateDeveloperMetadata: &sheets.CreateDeveloperMetadataRequest{DeveloperMetadata: &sheets.DeveloperMetadata{
+		MetadataKey:   INVITE_CODE_METADATA_KEY,
+		MetadataValue: strconv.Itoa(inviteCode),
+		Visibility:    "DOCUMENT",
+		Location: &sheets.DeveloperMetadataLocation{DimensionRange: &sheets.DimensionRange{
+			SheetId:    sheetID,
+			Dimension:  "ROWS",
+			StartIndex: int64(rowNumber - 1), // 0-based & end exclusive
+			EndIndex:   int64(rowNumber),
+		}},
+	}}}
+}
+
+// indexInvitedFamilyRow tags the row with the invite code, replacing any
+// other row's tag for the same invite code
+func indexInvitedFamilyRow(inviteCode int, rowNumber int) error {
+	sheetID, err := getSheetID(INVITED_FAMILY)
+	if err != nil {
+		return err
+	}
+	requests := []*sheets.Request{
+		{DeleteDeveloperMetadata: &sheets.DeleteDeveloperMetadataRequest{DataFilter: inviteCodeFilter(inviteCode)}},
+		tagInviteCodeRequest(sheetID, inviteCode, rowNumber),
+	}
+	_, err = getGoogleSheetsClient().Spreadsheets.BatchUpdate(spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}).Do()
+	return err
+}
+
+// indexInvitedFamilyRows tags the rows appended from firstRow with the
+// families' invite codes, in one request
+func indexInvitedFamilyRows(invitedFamilies []InvitedFamily, firstRow int) error {
+	if firstRow < 2 {
+		return fmt.Errorf("unexpected first row %d", firstRow)
+	}
+	sheetID, err := getSheetID(INVITED_FAMILY)
+	if err != nil {
+		return err
+	}
+	var requests []*sheets.Request
+	for i, invitedFamily := range invitedFamilies {
+		requests = append(requests,
+			&sheets.Request{DeleteDeveloperMetadata: &sheets.DeleteDeveloperMetadataRequest{DataFilter: inviteCodeFilter(invitedFamily.InviteCode)}},
+			tagInviteCodeRequest(sheetID, invitedFamily.InviteCode, firstRow+i),
+		)
+	}
+	_, err = getGoogleSheetsClient().Spreadsheets.BatchUpdate(spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}).Do()
+	return err
+}
+
+// indexInviteCodesCommand rebuilds the invite code index from scratch
+func indexInviteCodesCommand(args []string) error {
+	flags := flag.NewFlagSet("index-invite-codes", flag.ExitOnError)
+	flags.Parse(args)
+
+	columns, rows, err := readInvitedFamilySheet()
+	if err != nil {
+		return err
+	}
+	sheetID, err := getSheetID(INVITED_FAMILY)
+	if err != nil {
+		return err
+	}
+
+	deleteAll := &sheets.DataFilter{DeveloperMetadataLookup: &sheets.DeveloperMetadataLookup{MetadataKey: INVITE_CODE_METADATA_KEY}}
+	requests := []*sheets.Request{{DeleteDeveloperMetadata: &sheets.DeleteDeveloperMetadataRequest{DataFilter: deleteAll}}}
+	for i, row := range rows {
+		inviteCode, err := strconv.Atoi(fmt.Sprint(columns.cell(row, "Invite Code")))
+		if err != nil {
+			continue
+		}
+		requests = append(requests, tagInviteCodeRequest(sheetID, inviteCode, i+2))
+	}
+	if _, err := getGoogleSheetsClient().Spreadsheets.BatchUpdate(spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}).Do(); err != nil {
+		return err
+	}
+	log.Printf("Indexed %d invite codes", len(requests)-1)
+	return nil
+}
+
+func getSheetID(sheetName string) (int64, error) {
+	spreadsheet, err := getGoogleSheetsClient().Spreadsheets.Get(spreadsheetID).Fields("sheets.properties").Do()
+	if err != nil {
+		return 0, err
+	}
+	for _, sheet := range spreadsheet.Sheets {
+		if sheet.Properties.Title == sheetName {
+			return sheet.Properties.SheetId, nil
+		}
+	}
+	return 0, fmt.Errorf("no sheet named %s", sheetName)
+}
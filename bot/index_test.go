@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestReadRowsInPages(t *testing.T) {
+	// 7 rows, with row 4 (the end of the 2nd page) empty & left out by the sheets lib
+	sheet := [][]interface{}{{"Origin"}, {"1"}, {"2"}, {}, {"4"}, {"5"}, {"6"}}
+	var reads []string
+	rows, err := readRowsInPages(2, func(first int, last int) ([][]interface{}, error) {
+		reads = append(reads, fmt.Sprintf("%d:%d", first, last))
+		var page [][]interface{}
+		for i := first - 1; i < last && i < len(sheet); i++ {
+			page = append(page, sheet[i])
+		}
+		for len(page) > 0 && len(page[len(page)-1]) == 0 {
+			page = page[:len(page)-1]
+		}
+		return page, nil
+	})
+	if err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if fmt.Sprint(reads) != "[1:2 3:4 5:6 7:8 9:10]" {
+		t.Errorf("Unexpected pages read: +%v", reads)
+	}
+	if len(rows) != len(sheet) || fmt.Sprint(rows[4]) != "[4]" || fmt.Sprint(rows[6]) != "[6]" {
+		t.Errorf("Expected the rows to keep their row numbers, got: +%v", rows)
+	}
+
+	_, err = readRowsInPages(2, func(first int, last int) ([][]interface{}, error) {
+		return nil, fmt.Errorf("quota exceeded")
+	})
+	if err == nil {
+		t.Errorf("Expected the read error to be returned")
+	}
+}
+
+func TestRowNumberOfRange(t *testing.T) {
+	tests := map[string]int{
+		"INVITED_FAMILY!A12:J12": 12,
+		"'INVITED_FAMILY'!A3:Z3": 3,
+		"INVITED_FAMILY!1:1":     1,
+		"INVITED_FAMILY":         0,
+	}
+	for a1Range, expected := range tests {
+		if rowNumber := rowNumberOfRange(a1Range); rowNumber != expected {
+			t.Errorf("Expected row %d for %s, got: %d", expected, a1Range, rowNumber)
+		}
+	}
+}
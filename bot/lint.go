@@ -0,0 +1,191 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// updateEventColumns are the UPDATE_EVENT columns the bot reads, as named in the README
+var updateEventColumns = []string{"Invite Code", "Phone Number", "Event", "Number Attending", "Timestamp"}
+
+// LintProblem is something wrong with a cell (or row) of the spreadsheet, i.e.
+// INVITED_FAMILY!E12: Vidhi-Invite isn't a number, ALL or NULL: "4 ppl"
+type LintProblem struct {
+	Cell    string
+	Message string
+}
+
+func (problem LintProblem) String() string {
+	return problem.Cell + ": " + problem.Message
+}
+
+func lintProblem(sheetName string, col int, rowNumber int, format string, args ...interface{}) LintProblem {
+	return LintProblem{Cell: sheetName + "!" + columnLetter(col) + strconv.Itoa(rowNumber), Message: fmt.Sprintf(format, args...)}
+}
+
+// lintHeaders checks the first row has the expected column names, in order
+func lintHeaders(sheetName string, rows [][]interface{}, columns []string) []LintProblem {
+	var problems []LintProblem
+	for col, column := range columns {
+		if len(rows) == 0 || col >= len(rows[0]) || !strings.EqualFold(strings.TrimSpace(fmt.Sprint(rows[0][col])), column) {
+			problems = append(problems, lintProblem(sheetName, col, 1, "missing the %q header", column))
+		}
+	}
+	return problems
+}
+
+// lintInvitedFamily checks the INVITED_FAMILY rows (including the header row)
+// can be read by the bot
+func lintInvitedFamily(rows [][]interface{}) []LintProblem {
+	var header []interface{}
+	if len(rows) > 0 {
+		header = rows[0]
+	}
+	columns, missing := newColumnMap(header, guestListColumns())
+	if len(missing) > 0 {
+		var problems []LintProblem
+		for _, column := range missing {
+			problems = append(problems, LintProblem{Cell: INVITED_FAMILY + "!1:1", Message: fmt.Sprintf("missing the %q header (or one of its COLUMN_ALIASES)", column)})
+		}
+		return problems
+	}
+
+	var problems []LintProblem
+	problem := func(column string, rowNumber int, format string, args ...interface{}) {
+		problems = append(problems, lintProblem(INVITED_FAMILY, columns[column], rowNumber, format, args...))
+	}
+	firstRow := make(map[int]int)
+	for i := 1; i < len(rows); i++ {
+		row, rowNumber := rows[i], i+1
+		if len(row) == 0 {
+			continue
+		}
+
+		cell := fmt.Sprint(columns.cell(row, "Invite Code"))
+		inviteCode, err := strconv.Atoi(cell)
+		switch {
+		case cell == "":
+			problem("Invite Code", rowNumber, "Invite Code is empty")
+		case err != nil:
+			problem("Invite Code", rowNumber, "Invite Code isn't a number: %q", cell)
+		case firstRow[inviteCode] != 0:
+			problem("Invite Code", rowNumber, "Invite Code %d is already used in row %d", inviteCode, firstRow[inviteCode])
+		default:
+			firstRow[inviteCode] = rowNumber
+		}
+
+		for _, event := range AllEvents {
+			invitedCol, rsvpdCol := eventColumnName(event, "Invite"), eventColumnName(event, "RSVP'd")
+			invited, invitedErr := convertSheetCellToNumber(columns.cell(row, invitedCol))
+			switch {
+			case fmt.Sprint(columns.cell(row, invitedCol)) == "":
+				problem(invitedCol, rowNumber, "%s is empty (use NULL instead of leaving cells blank)", invitedCol)
+			case invitedErr != nil:
+				problem(invitedCol, rowNumber, "%s isn't a number, ALL or NULL: %q", invitedCol, fmt.Sprint(columns.cell(row, invitedCol)))
+			}
+			rsvpd, err := convertRsvpCellToNumber(columns.cell(row, rsvpdCol))
+			switch {
+			case err != nil:
+				problem(rsvpdCol, rowNumber, "%s isn't a number or NULL: %q", rsvpdCol, fmt.Sprint(columns.cell(row, rsvpdCol)))
+			case invitedErr == nil && rsvpd > invited:
+				problem(rsvpdCol, rowNumber, "%s (%d) is more than %s (%d)", rsvpdCol, rsvpd, invitedCol, invited)
+			}
+			if event.CountsChildren {
+				lintChildren(row, columns, event, rsvpd, problem, rowNumber)
+			}
+		}
+	}
+	return problems
+}
+
+// lintChildren checks the children columns of an event that counts children
+func lintChildren(row []interface{}, columns ColumnMap, event Event, rsvpd int, problem func(column string, rowNumber int, format string, args ...interface{}), rowNumber int) {
+	invitedCol, rsvpdCol := eventColumnName(event, "Children-Invite"), eventColumnName(event, "Children-RSVP'd")
+	if _, err := convertChildrenCellToNumber(columns.cell(row, invitedCol)); err != nil {
+		problem(invitedCol, rowNumber, "%s isn't a number, ALL or NULL: %q", invitedCol, fmt.Sprint(columns.cell(row, invitedCol)))
+	}
+	children, err := convertRsvpCellToNumber(columns.cell(row, rsvpdCol))
+	switch {
+	case err != nil:
+		problem(rsvpdCol, rowNumber, "%s isn't a number or NULL: %q", rsvpdCol, fmt.Sprint(columns.cell(row, rsvpdCol)))
+	case children > rsvpd:
+		problem(rsvpdCol, rowNumber, "%s (%d) is more than %s (%d)", rsvpdCol, children, eventColumnName(event, "RSVP'd"), rsvpd)
+	}
+}
+
+// lintUpdateEvent checks the UPDATE_EVENT rows (including the header row)
+func lintUpdateEvent(rows [][]interface{}) []LintProblem {
+	problems := lintHeaders(UPDATE_EVENT, rows, updateEventColumns)
+	for i := 1; i < len(rows); i++ {
+		row, rowNumber := rows[i], i+1
+		if len(row) == 0 {
+			continue
+		}
+		if len(row) < len(updateEventColumns) {
+			problems = append(problems, lintProblem(UPDATE_EVENT, len(row), rowNumber, "row is short, %s is empty", updateEventColumns[len(row)]))
+			continue
+		}
+		if _, err := strconv.Atoi(fmt.Sprint(row[0])); err != nil {
+			problems = append(problems, lintProblem(UPDATE_EVENT, 0, rowNumber, "Invite Code isn't a number: %q", fmt.Sprint(row[0])))
+		}
+		if _, ok := eventByName(fmt.Sprint(row[2])); !ok {
+			problems = append(problems, lintProblem(UPDATE_EVENT, 2, rowNumber, "unknown Event: %q", fmt.Sprint(row[2])))
+		}
+		if _, err := strconv.Atoi(fmt.Sprint(row[3])); err != nil {
+			problems = append(problems, lintProblem(UPDATE_EVENT, 3, rowNumber, "Number Attending isn't a number: %q", fmt.Sprint(row[3])))
+		}
+	}
+	return problems
+}
+
+func lintSpreadsheet() ([]LintProblem, error) {
+	invitedFamilyRows, err := getAllGoogleSheetsRows(INVITED_FAMILY)
+	if err != nil {
+		return nil, err
+	}
+	updateEventRows, err := getGoogleSheetsData(UPDATE_EVENT, "A1:E")
+	if err != nil {
+		return nil, err
+	}
+	return append(lintInvitedFamily(invitedFamilyRows), lintUpdateEvent(updateEventRows)...), nil
+}
+
+// logSpreadsheetProblems is the startup check, run once per cold start in the
+// background so it doesn't hold up the first reply, and the problems show up
+// in the logs. The rows with problems are skipped by the bot. The other guest
+// stores don't keep the families in the sheet.
+func logSpreadsheetProblems() {
+	if _, ok := guestStore.(*sheetsStore); !ok {
+		return
+	}
+	problems, err := lintSpreadsheet()
+	if err != nil {
+		log.Printf("Unable to check the spreadsheet: %v", err)
+		return
+	}
+	for _, problem := range problems {
+		log.Printf("Spreadsheet problem - %s", problem)
+	}
+}
+
+func lintCommand(args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	flags.Parse(args)
+
+	problems, err := lintSpreadsheet()
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		fmt.Fprintln(os.Stdout, problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problems", len(problems))
+	}
+	fmt.Println("No problems found")
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintInvitedFamily(t *testing.T) {
+	rows := [][]interface{}{
+		{"Origin", "Name", "Invite Name", "Invite Code", "Vidhi-Invite", "Vidhi-RSVP'd", "Garba-Invite", "Garba-RSVP'd", "Wedding-Invite", "Wedding-RSVP'd"},
+		{"Mumbai", "Rakesh", "The Patel Family", "7", "4 ppl", "NULL", "ALL", "6", "2", "3"},
+		{"Chicago", "Nikhil", "The Shah Family", "7", "NULL", "NULL", "NULL", "NULL", "2", "NULL"},
+		{"Chicago", "Nikhil", "The Mehta Family", "9", "2"},
+		{"Chicago", "Nikhil", "The Desai Family", "abc", "2", "", "NULL", "NULL", "NULL", "NULL"},
+	}
+	expected := []string{
+		`INVITED_FAMILY!E2: Vidhi-Invite isn't a number, ALL or NULL: "4 ppl"`,
+		`INVITED_FAMILY!J2: Wedding-RSVP'd (3) is more than Wedding-Invite (2)`,
+		`INVITED_FAMILY!D3: Invite Code 7 is already used in row 2`,
+		`INVITED_FAMILY!G4: Garba-Invite is empty (use NULL instead of leaving cells blank)`,
+		`INVITED_FAMILY!I4: Wedding-Invite is empty (use NULL instead of leaving cells blank)`,
+		`INVITED_FAMILY!D5: Invite Code isn't a number: "abc"`,
+	}
+
+	var problems []string
+	for _, problem := range lintInvitedFamily(rows) {
+		problems = append(problems, problem.String())
+	}
+	if strings.Join(problems, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected problems:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(problems, "\n"))
+	}
+}
+
+func TestLintInvitedFamilyHeaders(t *testing.T) {
+	rows := [][]interface{}{{"Origin", "Name", "Invite Name", "Code", "Vidhi-Invite", "Vidhi-RSVP'd", "Garba-Invite", "Garba-RSVP'd", "Wedding-Invite"}}
+	problems := lintInvitedFamily(rows)
+	if len(problems) != 1 || problems[0].String() != `INVITED_FAMILY!1:1: missing the "Wedding-RSVP'd" header (or one of its COLUMN_ALIASES)` {
+		t.Errorf("Unexpected problems: +%v", problems)
+	}
+}
+
+func TestLintUpdateEvent(t *testing.T) {
+	rows := [][]interface{}{
+		{"Invite Code", "Phone Number", "Event", "Number Attending", "Timestamp"},
+		{"7", "+15555550100", "VIDHI", "4", "2019-02-01 10:00:00"},
+		{"7", "+15555550100", "SANGEET", "four", "2019-02-01 10:00:00"},
+		{"7", "+15555550100"},
+	}
+	problems := lintUpdateEvent(rows)
+	if len(problems) != 3 || problems[0].Cell != "UPDATE_EVENT!C3" || problems[1].Cell != "UPDATE_EVENT!D3" || problems[2].Cell != "UPDATE_EVENT!C4" {
+		t.Errorf("Unexpected problems: +%v", problems)
+	}
+}
+
+func TestToInvitedFamilyReportsBadCells(t *testing.T) {
+	columns, _ := newColumnMap([]interface{}{"Origin", "Name", "Invite Name", "Invite Code", "Vidhi-Invite", "Vidhi-RSVP'd", "Garba-Invite", "Garba-RSVP'd", "Wedding-Invite", "Wedding-RSVP'd"}, guestListColumns())
+	_, err := toInvitedFamily([]interface{}{"Mumbai", "Rakesh", "The Patel Family", "7", "4 ppl", "NULL", "NULL", "NULL", "NULL", "NULL"}, columns)
+	if err == nil || !strings.Contains(err.Error(), "col E") {
+		t.Errorf("Expected an error for col E, got: %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/golang/protobuf/ptypes/struct"
+	dialogflow "google.golang.org/genproto/googleapis/cloud/dialogflow/v2"
+)
+
+const (
+	// Minimum similarity (0-1) a name has to reach before we treat it as a match
+	NAME_MATCH_THRESHOLD = 0.8
+	// Below this length a single typo changes too much of the word, so only exact matches count
+	MIN_FUZZY_TOKEN_LENGTH = 4
+)
+
+// Words that show up on invitations or in how guests refer to themselves, but
+// don't help tell one family from another
+var nameStopWords = map[string]bool{
+	"the": true, "family": true, "families": true, "and": true, "of": true,
+	"mr": true, "mrs": true, "ms": true, "miss": true, "dr": true, "sir": true, "madam": true,
+	"shri": true, "shree": true, "smt": true, "kum": true, "kumari": true, "ji": true, "parivar": true,
+}
+
+// NameLookupFulfillment finds the invited families matching the given name. A
+// name alone isn't enough to hand out an invite code, so even a single match
+// asks for the family's origin, keeping the candidate invite codes in a context
+// so the answer can be matched on the next turn.
+func NameLookupFulfillment(response *DialogflowResponse, name string) {
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		log.Fatalf("Unable to retrieve data from sheet: %v", err)
+	}
+
+	candidates := matchFamiliesByName(name, invitedFamilies)
+	log.Printf("\nIntent: %s - Found %d families matching name: %s", intent, len(candidates), name)
+	if len(candidates) == 0 {
+		response.Text("Sorry, I couldn't find an invitation under that name. Please try the name printed on your invitation card.")
+		return
+	}
+
+	var inviteCodes []int
+	for _, family := range candidates {
+		inviteCodes = append(inviteCodes, family.InviteCode)
+	}
+	response.Text("To make sure it's your invitation, which city or town is your family from?")
+	response.Contexts(lookupCandidatesContext(inviteCodes))
+}
+
+// OriginLookupFulfillment narrows down the candidates from a name lookup using
+// the origin the guest gave us
+func OriginLookupFulfillment(response *DialogflowResponse, origin string, contexts []*dialogflow.Context) {
+	inviteCodes := getLookupCandidatesFromContext(contexts)
+	if len(inviteCodes) == 0 {
+		// The candidates context only lasts 2 turns, so start the lookup over
+		log.Printf("%s | %s | Couldn't find the name lookup candidates", sessionID, responseID)
+		response.Text("Sorry, I lost track of your name. Please tell me the name printed on your invitation card again.")
+		return
+	}
+
+	var candidates []InvitedFamily
+	for _, inviteCode := range inviteCodes {
+		candidates = append(candidates, findInvitedFamily(inviteCode))
+	}
+
+	candidates = filterFamiliesByOrigin(origin, candidates)
+	log.Printf("\nIntent: %s - Found %d families matching origin: %s", intent, len(candidates), origin)
+	if len(candidates) != 1 {
+		response.Text("Sorry, I still couldn't find your invitation. Please contact the hosts and they'll send you your invite code.")
+		return
+	}
+	foundFamilyFulfillment(response, candidates[0])
+}
+
+// foundFamilyFulfillment tells the guest their invite code and sets the same
+// context the invite code intents do, so the RSVP flow can carry on from here
+func foundFamilyFulfillment(response *DialogflowResponse, invitedFamily InvitedFamily) {
+	response.Text("Found it! Your invite code is " + strconv.Itoa(invitedFamily.InviteCode) + ".")
+	invitationResponse(response, invitedFamily)
+
+	inviteCodeContext := dialogflow.Context{
+		Name:          sessionID + "/contexts/rsvperinvitecode-followup",
+		LifespanCount: 10,
+		Parameters: &structpb.Struct{Fields: map[string]*structpb.Value{
+			"invite_code": numberValue(invitedFamily.InviteCode),
+		}},
+	}
+	response.Contexts(&inviteCodeContext)
+}
+
+func lookupCandidatesContext(inviteCodes []int) *dialogflow.Context {
+	var values []*structpb.Value
+	for _, inviteCode := range inviteCodes {
+		values = append(values, numberValue(inviteCode))
+	}
+	return &dialogflow.Context{
+		Name:          sessionID + "/contexts/rsvperlookupname-followup",
+		LifespanCount: 2,
+		Parameters: &structpb.Struct{Fields: map[string]*structpb.Value{
+			"candidate_invite_codes": {Kind: &structpb.Value_ListValue{ListValue: &structpb.ListValue{Values: values}}},
+		}},
+	}
+}
+
+func getLookupCandidatesFromContext(contexts []*dialogflow.Context) []int {
+	var inviteCodes []int
+	parameterValue := getFromContext(contexts, "candidate_invite_codes")
+	if parameterValue == nil {
+		return inviteCodes
+	}
+	for _, value := range parameterValue.GetListValue().GetValues() {
+		inviteCodes = append(inviteCodes, int(value.GetNumberValue()))
+	}
+	return inviteCodes
+}
+
+func numberValue(number int) *structpb.Value {
+	return &structpb.Value{Kind: &structpb.Value_NumberValue{NumberValue: float64(number)}}
+}
+
+// matchFamiliesByName returns the families whose Name or InviteName best match
+// the given name. If some families match exactly, the close-but-not-exact ones are dropped.
+func matchFamiliesByName(name string, invitedFamilies []InvitedFamily) []InvitedFamily {
+	queryTokens := nameTokens(name)
+	if len(queryTokens) == 0 {
+		return nil
+	}
+
+	type scoredFamily struct {
+		family InvitedFamily
+		score  float64
+	}
+	var matches []scoredFamily
+	for _, family := range invitedFamilies {
+		score := nameMatchScore(queryTokens, nameTokens(family.Name))
+		if inviteNameScore := nameMatchScore(queryTokens, nameTokens(family.InviteName)); inviteNameScore > score {
+			score = inviteNameScore
+		}
+		if score >= NAME_MATCH_THRESHOLD {
+			matches = append(matches, scoredFamily{family, score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	var bestMatches []InvitedFamily
+	for _, match := range matches {
+		if match.score < matches[0].score && matches[0].score == 1 {
+			break
+		}
+		bestMatches = append(bestMatches, match.family)
+	}
+	return bestMatches
+}
+
+func filterFamiliesByOrigin(origin string, invitedFamilies []InvitedFamily) []InvitedFamily {
+	originTokens := nameTokens(origin)
+	var matches []InvitedFamily
+	for _, family := range invitedFamilies {
+		if nameMatchScore(originTokens, nameTokens(family.Origin)) >= NAME_MATCH_THRESHOLD {
+			matches = append(matches, family)
+		}
+	}
+	return matches
+}
+
+// nameMatchScore averages how well each word the guest typed matches its
+// closest word in the candidate name
+func nameMatchScore(queryTokens []string, candidateTokens []string) float64 {
+	if len(queryTokens) == 0 || len(candidateTokens) == 0 {
+		return 0
+	}
+	var total float64
+	for _, queryToken := range queryTokens {
+		var best float64
+		for _, candidateToken := range candidateTokens {
+			if similarity := tokenSimilarity(queryToken, candidateToken); similarity > best {
+				best = similarity
+			}
+		}
+		total += best
+	}
+	return total / float64(len(queryTokens))
+}
+
+func tokenSimilarity(a string, b string) float64 {
+	if a == b {
+		return 1
+	}
+	longest := len([]rune(a))
+	if l := len([]rune(b)); l > longest {
+		longest = l
+	}
+	if longest < MIN_FUZZY_TOKEN_LENGTH {
+		return 0
+	}
+	return 1 - float64(levenshteinDistance(a, b))/float64(longest)
+}
+
+// nameTokens lowercases the name, strips punctuation and possessives and drops honorifics
+func nameTokens(name string) []string {
+	name = strings.Replace(strings.ToLower(name), "'s", "", -1)
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	var tokens []string
+	for _, word := range words {
+		if !nameStopWords[word] {
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
+
+func levenshteinDistance(a string, b string) int {
+	s, t := []rune(a), []rune(b)
+	previous := make([]int, len(t)+1)
+	current := make([]int, len(t)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		current[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(t)]
+}
+
+func minInt(first int, rest ...int) int {
+	min := first
+	for _, n := range rest {
+		if n < min {
+			min = n
+		}
+	}
+	return min
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+var mockInvitedFamilies = []InvitedFamily{
+	{Origin: "Nairobi", Name: "Rajesh Patel", InviteName: "Mr. & Mrs. Rajesh Patel", InviteCode: 1},
+	{Origin: "Vadodara", Name: "Rajesh Patel", InviteName: "The Patel Family", InviteCode: 2},
+	{Origin: "London", Name: "Priya Shah", InviteName: "Shri Priya Shah & Family", InviteCode: 3},
+}
+
+func TestMatchFamiliesByNameIgnoresHonorifics(t *testing.T) {
+	matches := matchFamiliesByName("the Shah family", mockInvitedFamilies)
+	if len(matches) != 1 || matches[0].InviteCode != 3 {
+		t.Errorf("Expected only invite code 3 to match, got: +%v", matches)
+	}
+}
+
+func TestMatchFamiliesByNameToleratesMisspelling(t *testing.T) {
+	matches := matchFamiliesByName("Priya Shaah", mockInvitedFamilies)
+	if len(matches) != 1 || matches[0].InviteCode != 3 {
+		t.Errorf("Expected only invite code 3 to match, got: +%v", matches)
+	}
+}
+
+func TestMatchFamiliesByNameReturnsAllAmbiguousMatches(t *testing.T) {
+	matches := matchFamiliesByName("Rajesh Patel", mockInvitedFamilies)
+	if len(matches) != 2 {
+		t.Errorf("Expected both Patel families to match, got: +%v", matches)
+	}
+}
+
+func TestMatchFamiliesByNameNoMatch(t *testing.T) {
+	matches := matchFamiliesByName("Mehta", mockInvitedFamilies)
+	if len(matches) != 0 {
+		t.Errorf("Expected no matches, got: +%v", matches)
+	}
+}
+
+func TestFilterFamiliesByOrigin(t *testing.T) {
+	matches := filterFamiliesByOrigin("vadodra", matchFamiliesByName("Rajesh Patel", mockInvitedFamilies))
+	if len(matches) != 1 || matches[0].InviteCode != 2 {
+		t.Errorf("Expected only invite code 2 to match, got: +%v", matches)
+	}
+}
+
+func TestNameLookupAsksForOriginBeforeRevealingInviteCode(t *testing.T) {
+	defer useMemoryStore(mockInvitedFamilies...)()
+
+	response := NewDialogflowResponse()
+	NameLookupFulfillment(response, "Priya Shah")
+	if message := response.Fallback(); strings.Contains(message, "3") || !strings.Contains(message, "city or town") {
+		t.Errorf("Expected a single match to be asked for their origin, got: %s", message)
+	}
+	contexts := response.webhookResponse().OutputContexts
+	if inviteCodes := getLookupCandidatesFromContext(contexts); len(inviteCodes) != 1 || inviteCodes[0] != 3 {
+		t.Fatalf("Expected invite code 3 to be the only candidate, got: +%v", inviteCodes)
+	}
+
+	response = NewDialogflowResponse()
+	OriginLookupFulfillment(response, "Nairobi", contexts)
+	if message := response.Fallback(); strings.Contains(message, "invite code is") {
+		t.Errorf("Expected the wrong origin not to reveal the invite code, got: %s", message)
+	}
+	response = NewDialogflowResponse()
+	OriginLookupFulfillment(response, "london", contexts)
+	if message := response.Fallback(); !strings.Contains(message, "Your invite code is 3.") {
+		t.Errorf("Expected the invite code once the origin matches, got: %s", message)
+	}
+}
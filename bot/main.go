@@ -1,8 +1,6 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -27,20 +25,28 @@ import (
 // https://serverless.com/framework/docs/providers/aws/events/apigateway/#lambda-proxy-integration
 type Response events.APIGatewayProxyResponse
 type Event struct {
-	Name                   string
-	DisplayName            string
-	InvitedCol             string
-	RsvpdCol               string
-	DialogflowAction       string
-	DialogflowRsvpVariable string
+	Name                       string
+	DisplayName                string
+	DialogflowAction           string
+	DialogflowRsvpVariable     string
+	RsvpDeadline               string // last day to RSVP, i.e. 2019-03-01 (empty to use RSVP_DEADLINE)
+	MealOptions                string // dietary options to ask about, i.e. Jain,Vegan (empty to use MEAL_OPTIONS)
+	CountsChildren             bool   // RSVPs are split into adults & children
+	DialogflowChildrenVariable string
+	Capacity                   int // most guests the venue holds, the rest go on the waitlist (0 for no limit)
 }
 
 const (
-	INVITED_FAMILY       = "INVITED_FAMILY"
-	UPDATE_EVENT         = "UPDATE_EVENT"
-	TOTAL_INVITED_FAMILY = 9999
-	MAX_INVITEES         = 9999
-	NULL_INVITEES        = -1
+	INVITED_FAMILY = "INVITED_FAMILY"
+	UPDATE_EVENT   = "UPDATE_EVENT"
+	MAX_INVITEES   = 9999
+	NULL_INVITEES  = -1
+)
+
+const (
+	RSVP_NOW_QUESTION    = "Would you like to RSVP now?"
+	RSVP_SUMMARY_TITLE   = "We've got you down for:"
+	RSVP_SUMMARY_CLOSING = "See you there! :) \nP.S. Come chat again if you need to update your RSVP." // Tried & failed -- emoji.Sprint(":tada:") \U0001f389
 )
 
 type InvitedFamily struct {
@@ -54,6 +60,15 @@ type InvitedFamily struct {
 	GarbaRsvpd     int
 	WeddingInvited int
 	WeddingRsvpd   int
+
+	// How many of the invited & RSVP'd guests are children, for the events that
+	// count them (see Event.CountsChildren)
+	VidhiChildrenInvited   int
+	VidhiChildrenRsvpd     int
+	GarbaChildrenInvited   int
+	GarbaChildrenRsvpd     int
+	WeddingChildrenInvited int
+	WeddingChildrenRsvpd   int
 }
 
 func (invitedFamily *InvitedFamily) totalEventsInvitedTo() int {
@@ -69,26 +84,178 @@ func (invitedFamily *InvitedFamily) totalEventsInvitedTo() int {
 	return totalEvents
 }
 
-var Vidhi = Event{Name: "VIDHI", DisplayName: "VIDHI", InvitedCol: "E", RsvpdCol: "F", DialogflowAction: "actions_rsvp_vidhi", DialogflowRsvpVariable: "vidhi_rsvpd"}
-var Garba = Event{Name: "GARBA", DisplayName: "GARBA-RECEPTION", InvitedCol: "G", RsvpdCol: "H", DialogflowAction: "actions_rsvp_garba", DialogflowRsvpVariable: "garba_rsvpd"}
-var Wedding = Event{Name: "WEDDING", DisplayName: "WEDDING", InvitedCol: "I", RsvpdCol: "J", DialogflowAction: "actions_rsvp_wedding", DialogflowRsvpVariable: "wedding_rsvpd"}
+func (invitedFamily *InvitedFamily) invitedTo(event Event) int {
+	switch event {
+	case Vidhi:
+		return invitedFamily.VidhiInvited
+	case Garba:
+		return invitedFamily.GarbaInvited
+	case Wedding:
+		return invitedFamily.WeddingInvited
+	}
+	return 0
+}
+
+func (invitedFamily *InvitedFamily) rsvpdTo(event Event) int {
+	switch event {
+	case Vidhi:
+		return invitedFamily.VidhiRsvpd
+	case Garba:
+		return invitedFamily.GarbaRsvpd
+	case Wedding:
+		return invitedFamily.WeddingRsvpd
+	}
+	return NULL_INVITEES
+}
+
+func (invitedFamily *InvitedFamily) setInvited(event Event, invited int) {
+	switch event {
+	case Vidhi:
+		invitedFamily.VidhiInvited = invited
+	case Garba:
+		invitedFamily.GarbaInvited = invited
+	case Wedding:
+		invitedFamily.WeddingInvited = invited
+	}
+}
+
+func (invitedFamily *InvitedFamily) setRsvpd(event Event, rsvpd int) {
+	switch event {
+	case Vidhi:
+		invitedFamily.VidhiRsvpd = rsvpd
+	case Garba:
+		invitedFamily.GarbaRsvpd = rsvpd
+	case Wedding:
+		invitedFamily.WeddingRsvpd = rsvpd
+	}
+}
+
+func (invitedFamily *InvitedFamily) childrenInvitedTo(event Event) int {
+	switch event {
+	case Vidhi:
+		return invitedFamily.VidhiChildrenInvited
+	case Garba:
+		return invitedFamily.GarbaChildrenInvited
+	case Wedding:
+		return invitedFamily.WeddingChildrenInvited
+	}
+	return 0
+}
+
+func (invitedFamily *InvitedFamily) childrenRsvpdTo(event Event) int {
+	switch event {
+	case Vidhi:
+		return invitedFamily.VidhiChildrenRsvpd
+	case Garba:
+		return invitedFamily.GarbaChildrenRsvpd
+	case Wedding:
+		return invitedFamily.WeddingChildrenRsvpd
+	}
+	return NULL_INVITEES
+}
+
+func (invitedFamily *InvitedFamily) setChildrenInvited(event Event, invited int) {
+	switch event {
+	case Vidhi:
+		invitedFamily.VidhiChildrenInvited = invited
+	case Garba:
+		invitedFamily.GarbaChildrenInvited = invited
+	case Wedding:
+		invitedFamily.WeddingChildrenInvited = invited
+	}
+}
+
+func (invitedFamily *InvitedFamily) setChildrenRsvpd(event Event, rsvpd int) {
+	switch event {
+	case Vidhi:
+		invitedFamily.VidhiChildrenRsvpd = rsvpd
+	case Garba:
+		invitedFamily.GarbaChildrenRsvpd = rsvpd
+	case Wedding:
+		invitedFamily.WeddingChildrenRsvpd = rsvpd
+	}
+}
+
+// outstandingEvents are the events the family is invited to, but hasn't RSVP'd to yet
+func (invitedFamily *InvitedFamily) outstandingEvents() []Event {
+	var outstanding []Event
+	for _, event := range AllEvents {
+		if invitedFamily.invitedTo(event) > 0 && invitedFamily.rsvpdTo(event) == NULL_INVITEES {
+			outstanding = append(outstanding, event)
+		}
+	}
+	return outstanding
+}
+
+// rsvps are the family's saved RSVP counts, for the events they've RSVP'd to
+func (invitedFamily *InvitedFamily) rsvps() map[Event]int {
+	rsvps := make(map[Event]int)
+	for _, event := range AllEvents {
+		if rsvpd := invitedFamily.rsvpdTo(event); rsvpd != NULL_INVITEES {
+			rsvps[event] = rsvpd
+		}
+	}
+	return rsvps
+}
+
+var Vidhi = Event{Name: "VIDHI", DisplayName: "VIDHI", DialogflowAction: "actions_rsvp_vidhi", DialogflowRsvpVariable: "vidhi_rsvpd", RsvpDeadline: os.Getenv("VIDHI_RSVP_DEADLINE"), MealOptions: os.Getenv("VIDHI_MEAL_OPTIONS"), CountsChildren: os.Getenv("VIDHI_COUNT_CHILDREN") == "true", DialogflowChildrenVariable: "vidhi_children", Capacity: eventCapacity("VIDHI")}
+var Garba = Event{Name: "GARBA", DisplayName: "GARBA-RECEPTION", DialogflowAction: "actions_rsvp_garba", DialogflowRsvpVariable: "garba_rsvpd", RsvpDeadline: os.Getenv("GARBA_RSVP_DEADLINE"), MealOptions: os.Getenv("GARBA_MEAL_OPTIONS"), CountsChildren: os.Getenv("GARBA_COUNT_CHILDREN") == "true", DialogflowChildrenVariable: "garba_children", Capacity: eventCapacity("GARBA")}
+var Wedding = Event{Name: "WEDDING", DisplayName: "WEDDING", DialogflowAction: "actions_rsvp_wedding", DialogflowRsvpVariable: "wedding_rsvpd", RsvpDeadline: os.Getenv("WEDDING_RSVP_DEADLINE"), MealOptions: os.Getenv("WEDDING_MEAL_OPTIONS"), CountsChildren: os.Getenv("WEDDING_COUNT_CHILDREN") == "true", DialogflowChildrenVariable: "wedding_children", Capacity: eventCapacity("WEDDING")}
 
 var AllEvents = []Event{Vidhi, Garba, Wedding}
 
+func eventByName(name string) (Event, bool) {
+	for _, event := range AllEvents {
+		if strings.EqualFold(event.Name, name) {
+			return event, true
+		}
+	}
+	return Event{}, false
+}
+
+func eventForDialogflowAction(action string) (Event, bool) {
+	for _, event := range AllEvents {
+		if event.DialogflowAction == action {
+			return event, true
+		}
+	}
+	return Event{}, false
+}
+
 var sessionID string
 var responseID string
 var intent string
 var requestStr string
+
+// smsSenderVerified is set once the SMS webhook's Twilio signature was checked,
+// so the From number can be trusted for the hosts' decisions
+var smsSenderVerified bool
 var spreadsheetID string
 
+// Handler routes the request to the handler for the webhook it was sent to
 func Handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	overrideCode = ""
+	switch {
+	case strings.HasSuffix(request.Path, "/sms"):
+		return SmsHandler(request)
+	case strings.HasSuffix(request.Path, "/voice"):
+		return VoiceHandler(request)
+	case strings.HasSuffix(request.Path, "/report"):
+		return ReportHandler(request)
+	case strings.Contains(request.Path, ADMIN_PATH):
+		return AdminHandler(request)
+	default:
+		return DialogflowHandler(request)
+	}
+}
+
+func DialogflowHandler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	wr, err := parseRequestBody(request)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	var message string
-	var followupIntentName string
+	response := NewDialogflowResponse()
 	switch intent {
 	case "rsvper.invitecode":
 		fallthrough
@@ -97,40 +264,82 @@ func Handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyRespo
 		fields := wr.QueryResult.Parameters.Fields
 		inviteCode := int(fields["invite_code"].GetNumberValue())
 		log.Printf("\nIntent: %s - Starting fulfillment for invite code: %d", intent, inviteCode)
-		message, _ = InviteCodeFulfillment(inviteCode)
+		invitationResponse(response, findInvitedFamily(inviteCode))
 	case "rsvper.invitecode - yes":
 		fallthrough
 	case "rsvper.welcome - invitecode - yes":
 		// Given invite code return number of invitees
 		inviteCode := getInviteCodeFromContext(wr.QueryResult.OutputContexts)
 		log.Printf("\nIntent: %s - Starting fulfillment for invite code: %d", intent, inviteCode)
-		_, followupIntentName = InviteCodeFulfillment(inviteCode)
+		_, followupIntentName := InviteCodeFulfillment(inviteCode)
+		response.FollowupEvent(followupIntentName)
 	case "rsvper.rsvp-wedding":
 		fallthrough
 	case "rsvper.invitecode - yes - wedding":
 		fallthrough
 	case "rsvper.welcome - invitecode - yes - wedding":
 		// Return which event values have to be filled & save updates
-		message, followupIntentName = saveRsvpCnt(Wedding, wr.QueryResult.OutputContexts)
+		saveRsvpCnt(response, Wedding, wr.QueryResult.OutputContexts)
 	case "rsvper.rsvp-garba":
 		fallthrough
 	case "rsvper.invitecode - yes - garba":
 		fallthrough
 	case "rsvper.welcome - invitecode - yes - garba":
 		// Return which event values have to be filled & save updates
-		message, followupIntentName = saveRsvpCnt(Garba, wr.QueryResult.OutputContexts)
+		saveRsvpCnt(response, Garba, wr.QueryResult.OutputContexts)
 	case "rsvper.rsvp-vidhi":
 		fallthrough
 	case "rsvper.invitecode - yes - vidhi":
 		fallthrough
 	case "rsvper.welcome - invitecode - yes - vidhi":
 		// Return which event values have to be filled & save updates
-		message, followupIntentName = saveRsvpCnt(Vidhi, wr.QueryResult.OutputContexts)
+		saveRsvpCnt(response, Vidhi, wr.QueryResult.OutputContexts)
+	case "rsvper.lookupname":
+		fallthrough
+	case "rsvper.welcome - lookupname":
+		// Given the family's name return their invitation, or ask where they're from if several families match
+		name := wr.QueryResult.Parameters.Fields["family_name"].GetStringValue()
+		log.Printf("\nIntent: %s - Starting fulfillment for name: %s", intent, name)
+		NameLookupFulfillment(response, name)
+	case "rsvper.lookupname - origin":
+		fallthrough
+	case "rsvper.welcome - lookupname - origin":
+		// Narrow down the families matching the name using where they're from
+		origin := wr.QueryResult.Parameters.Fields["origin"].GetStringValue()
+		log.Printf("\nIntent: %s - Starting fulfillment for origin: %s", intent, origin)
+		OriginLookupFulfillment(response, origin, wr.QueryResult.OutputContexts)
+	case "rsvper.overridecode":
+		// Given an override code from the hosts, let the guest change their RSVPs after the deadline
+		inviteCode := getInviteCodeFromContext(wr.QueryResult.OutputContexts)
+		code := normalizeOverrideCode(wr.QueryResult.Parameters.Fields["override_code"].GetStringValue())
+		log.Printf("\nIntent: %s - Starting fulfillment for invite code: %d", intent, inviteCode)
+		OverrideCodeFulfillment(response, inviteCode, code)
+	case "rsvper.attendees":
+		// Given the names of who's coming to the event they just RSVP'd to, save them & carry on with the RSVPs
+		AttendeeNamesFulfillment(response, wr.QueryResult.OutputContexts, wr.QueryResult.QueryText)
+	case "rsvper.dietary":
+		// Given the dietary needs of who's coming to the event, save them & carry on with the RSVPs
+		DietaryFulfillment(response, wr.QueryResult.OutputContexts, wr.QueryResult.QueryText)
+	case "rsvper.travel":
+		// Given the answer to one of the travel questions of an out-of-town family, save it & ask the next one
+		TravelFulfillment(response, wr.QueryResult.OutputContexts, wr.QueryResult.QueryText)
+	case "rsvper.accessibility":
+		// Given the family's accessibility needs once they've RSVP'd to every event, save them, let the hosts know & sum up the RSVPs
+		AccessibilityFulfillment(response, wr.QueryResult.OutputContexts, wr.QueryResult.QueryText)
+	case "rsvper.shuttle":
+		// Given a guest asking when their shuttle is, list the runs they're on
+		ShuttleFulfillment(response, wr.QueryResult.OutputContexts)
+	case "rsvper.table":
+		// Given a guest asking which table they're at, list their tables from the seating chart
+		TableFulfillment(response, wr.QueryResult.OutputContexts)
+	case "rsvper.seat_request":
+		// Given a guest asking to bring more guests to an event, queue the request for the hosts
+		SeatRequestFulfillment(response, wr.QueryResult.OutputContexts, wr.QueryResult.QueryText)
 	default:
 		log.Printf("\nNo slot-filling or fulfillment functions matched for intent: %s", wr.QueryResult.Intent.DisplayName)
 	}
 
-	respBody := createDialogflowResponse(message, followupIntentName)
+	respBody := response.String()
 	return events.APIGatewayProxyResponse{Body: respBody, StatusCode: 200}, nil
 }
 
@@ -151,36 +360,6 @@ func parseRequestBody(request events.APIGatewayProxyRequest) (dialogflow.Webhook
 	return wr, err
 }
 
-func createDialogflowResponse(message string, followupIntentName string) string {
-	// TODO: fill out the rest of the fields
-	responseBody := dialogflow.WebhookResponse{}
-
-	if message != "" {
-		responseBody.FulfillmentText = message
-	}
-
-	if followupIntentName != "" {
-		followupIntent := dialogflow.EventInput{
-			LanguageCode: "en",
-			Name:         followupIntentName,
-		}
-		log.Printf("Followup Intent: %+v", followupIntent)
-		responseBody.FollowupEventInput = &followupIntent
-	}
-
-	log.Printf("\nResponse body: %+v", responseBody)
-
-	var buf bytes.Buffer
-
-	body, err := json.Marshal(responseBody)
-	if err != nil {
-		log.Fatal("Unable to parse error response - error: ", err)
-	}
-	json.HTMLEscape(&buf, body)
-
-	return buf.String()
-}
-
 func rsvpdEvents(contexts []*dialogflow.Context) map[Event]int {
 	rsvpdEvents := make(map[Event]int)
 	for _, c := range contexts {
@@ -189,6 +368,10 @@ func rsvpdEvents(contexts []*dialogflow.Context) map[Event]int {
 				paramteters := c.Parameters.GetFields()
 				if val, ok := paramteters[e.DialogflowRsvpVariable]; ok {
 					rsvpdEvents[e] = int(val.GetNumberValue())
+					// The RSVP variable is only the adults when the event counts children
+					if children, ok := paramteters[e.DialogflowChildrenVariable]; ok && e.CountsChildren {
+						rsvpdEvents[e] += int(children.GetNumberValue())
+					}
 				}
 			}
 			break
@@ -198,7 +381,7 @@ func rsvpdEvents(contexts []*dialogflow.Context) map[Event]int {
 	return rsvpdEvents
 }
 
-func saveRsvpCnt(currentEvent Event, contexts []*dialogflow.Context) (string, string) {
+func saveRsvpCnt(response *DialogflowResponse, currentEvent Event, contexts []*dialogflow.Context) {
 	phoneNumber := getPhoneNumberFromContext(contexts)
 	inviteCode := getInviteCodeFromContext(contexts)
 	if inviteCode == -1 {
@@ -207,33 +390,111 @@ func saveRsvpCnt(currentEvent Event, contexts []*dialogflow.Context) (string, st
 	log.Printf("\nIntent: %s - Starting fulfillment for invite code: %d", intent, inviteCode)
 	parameters := contexts[0].Parameters.Fields
 
-	rsvpCnt := getRsvpCounts(currentEvent, parameters)
+	rsvpCnt, childrenCnt := getRsvpCounts(currentEvent, parameters)
 	if rsvpCnt == -1 {
 		log.Fatalf("%s | %s | Couldn't find the rsvp count for current event: %s", sessionID, responseID, currentEvent.Name)
 	}
 
+	if message, ok := checkRsvpDeadline(inviteCode, currentEvent, getOverrideCodeFromContext(contexts)); !ok {
+		response.Text(message)
+		return
+	}
+
 	eventRsvps := make(map[Event]int)
+	var childrenRsvps map[Event]int
+	if childrenCnt != -1 {
+		// The RSVP count is only the adults, so check them against their own invited count
+		invitedFamily := findInvitedFamily(inviteCode)
+		if message, ok := invitedFamily.checkRsvpSplit(currentEvent, rsvpCnt, childrenCnt); !ok {
+			response.Text(message)
+			return
+		}
+		rsvpCnt += childrenCnt
+		childrenRsvps = map[Event]int{currentEvent: childrenCnt}
+	}
 	eventRsvps[currentEvent] = rsvpCnt
 
-	saveRsvp(inviteCode, phoneNumber, eventRsvps)
+	saved, waitlisted := saveRsvp(inviteCode, phoneNumber, eventRsvps, childrenRsvps)
+	if len(waitlisted) > 0 {
+		waitlistedResponse(response, currentEvent, saved[currentEvent], waitlisted[0])
+		return
+	}
+	if rsvpCnt > 0 && collectAttendeeNames() {
+		attendeeNamesResponse(response, inviteCode, currentEvent, rsvpCnt, overrideCode)
+		return
+	}
 	alreadyRsvpdEvents := rsvpdEvents(contexts)
 	alreadyRsvpdEvents[currentEvent] = rsvpCnt
-	invitedFamily := findInvitedFamily(inviteCode)
-	return getFollowupEventAction(invitedFamily, currentEvent, alreadyRsvpdEvents)
+	dietaryOrFollowupResponse(response, findInvitedFamily(inviteCode), currentEvent, alreadyRsvpdEvents)
 }
 
-func getRsvpCounts(event Event, values map[string]*structpb.Value) int {
-	rsvpCnt := -1
+// followupRsvpResponse moves on to the next event's RSVP, or sums up the RSVPs
+// when they've RSVP'd to every event they're invited to
+func followupRsvpResponse(response *DialogflowResponse, invitedFamily InvitedFamily, currentEvent Event, alreadyRsvpdEvents map[Event]int) {
+	_, followupAction := getFollowupEventAction(invitedFamily, currentEvent, alreadyRsvpdEvents)
+	if followupAction != "" {
+		response.FollowupEvent(followupAction)
+		return
+	}
+	closingResponse(response, invitedFamily, alreadyRsvpdEvents, STEP_START)
+}
+
+// nextClosingStep is the question to ask after the given one (STEP_START for
+// the first, STEP_ACCESSIBILITY or STEP_TRAVEL) once the family has RSVP'd to
+// every event, or STEP_START when there's nothing left to ask. Only families
+// that are coming are asked.
+func nextClosingStep(invitedFamily InvitedFamily, rsvps map[Event]int, after string) string {
+	if !isAttending(rsvps) {
+		return STEP_START
+	}
+	steps := []struct {
+		step  string
+		first string // the step's first question
+		ask   bool
+	}{
+		{STEP_ACCESSIBILITY, STEP_ACCESSIBILITY, askAccessibilityNeeds()},
+		{STEP_TRAVEL, STEP_TRAVEL + TRAVEL_ARRIVAL, isOutOfTown(invitedFamily)},
+	}
+	asked := after == STEP_START
+	for _, step := range steps {
+		if asked && step.ask {
+			return step.first
+		}
+		asked = asked || after == step.step
+	}
+	return STEP_START
+}
+
+// closingResponse asks the Dialogflow guest the next closing question after
+// the given one, or sums up the RSVPs
+func closingResponse(response *DialogflowResponse, invitedFamily InvitedFamily, rsvps map[Event]int, after string) {
+	switch step := nextClosingStep(invitedFamily, rsvps, after); {
+	case step == STEP_ACCESSIBILITY:
+		accessibilityResponse(response, invitedFamily.InviteCode)
+	case strings.HasPrefix(step, STEP_TRAVEL):
+		travelResponse(response, invitedFamily.InviteCode, strings.TrimPrefix(step, STEP_TRAVEL))
+	default:
+		response.Card(rsvpSummaryCard(rsvps)).Text(RSVP_SUMMARY_CLOSING)
+	}
+}
+
+// getRsvpCounts is the event's RSVP count, and how many children are coming
+// when the event counts children (-1 when it doesn't, or the count is missing).
+// The RSVP count is only the adults when the children are counted.
+func getRsvpCounts(event Event, values map[string]*structpb.Value) (int, int) {
+	rsvpCnt, childrenCnt := -1, -1
 	for key, value := range values {
-		if CaseInsensitiveContains(key, ".original") {
+		if CaseInsensitiveContains(key, ".original") || !CaseInsensitiveContains(key, event.Name) {
 			continue
 		}
-		if CaseInsensitiveContains(key, event.Name) && CaseInsensitiveContains(key, "rsvp") {
+		switch {
+		case CaseInsensitiveContains(key, "rsvp"):
 			rsvpCnt = int(value.GetNumberValue())
-			break
+		case CaseInsensitiveContains(key, "children") && event.CountsChildren:
+			childrenCnt = int(value.GetNumberValue())
 		}
 	}
-	return rsvpCnt
+	return rsvpCnt, childrenCnt
 }
 
 func getInviteCodeFromContext(contexts []*dialogflow.Context) int {
@@ -245,6 +506,15 @@ func getInviteCodeFromContext(contexts []*dialogflow.Context) int {
 	return inviteCode
 }
 
+func getOverrideCodeFromContext(contexts []*dialogflow.Context) string {
+	code := ""
+	parameterValue := getFromContext(contexts, "override_code")
+	if parameterValue != nil {
+		code = normalizeOverrideCode(parameterValue.GetStringValue())
+	}
+	return code
+}
+
 func getPhoneNumberFromContext(contexts []*dialogflow.Context) string {
 	phoneNumber := ""
 	parameterValue := getFromContext(contexts, "twilio_sender_id")
@@ -276,6 +546,47 @@ func InviteCodeFulfillment(inviteCode int) (string, string) {
 	invitedFamily := findInvitedFamily(inviteCode)
 	log.Printf("\nReturned Invited_family row %+v", invitedFamily)
 
+	message := invitationMsg(invitedFamily) + "\n" + RSVP_NOW_QUESTION
+	_, followupAction := getFollowupEventAction(invitedFamily, Event{}, make(map[Event]int))
+
+	return message, followupAction
+}
+
+// OverrideCodeFulfillment checks the override code from the hosts and asks to
+// restart the RSVPs, keeping the code in a context for saveRsvpCnt. A followup
+// event would replace the accepted message, so the guest's "Yes" goes through
+// rsvper.invitecode - yes instead.
+func OverrideCodeFulfillment(response *DialogflowResponse, inviteCode int, code string) {
+	if inviteCode == -1 || !isValidOverrideCode(inviteCode, code) {
+		response.Text(INVALID_OVERRIDE_CODE_MSG)
+		return
+	}
+
+	overrideCodeContext := dialogflow.Context{
+		Name:          sessionID + "/contexts/rsvperoverridecode-followup",
+		LifespanCount: 10,
+		Parameters: &structpb.Struct{Fields: map[string]*structpb.Value{
+			"override_code": {Kind: &structpb.Value_StringValue{StringValue: code}},
+			"invite_code":   numberValue(inviteCode),
+		}},
+	}
+	inviteCodeContext := dialogflow.Context{
+		Name:          sessionID + "/contexts/rsvperinvitecode-followup",
+		LifespanCount: 10,
+		Parameters: &structpb.Struct{Fields: map[string]*structpb.Value{
+			"invite_code": numberValue(inviteCode),
+		}},
+	}
+	response.Text(OVERRIDE_CODE_ACCEPTED_MSG).QuickReplies(RSVP_NOW_QUESTION, "Yes", "Not now").Contexts(&overrideCodeContext, &inviteCodeContext)
+}
+
+// invitationResponse is the rich version of the InviteCodeFulfillment message,
+// with quick replies for the RSVP question
+func invitationResponse(response *DialogflowResponse, invitedFamily InvitedFamily) *DialogflowResponse {
+	return response.Text(invitationMsg(invitedFamily)).QuickReplies(RSVP_NOW_QUESTION, "Yes", "Not now")
+}
+
+func invitationMsg(invitedFamily InvitedFamily) string {
 	message := fmt.Sprintf("You must be %s.\nYou're invited to: ", invitedFamily.InviteName)
 	if invitedFamily.VidhiInvited > 0 {
 		message += eventInviteMsg(Vidhi, invitedFamily.VidhiInvited)
@@ -286,11 +597,7 @@ func InviteCodeFulfillment(inviteCode int) (string, string) {
 	if invitedFamily.WeddingInvited > 0 {
 		message += eventInviteMsg(Wedding, invitedFamily.WeddingInvited)
 	}
-
-	message += fmt.Sprintf("\nWould you like to RSVP now?")
-	_, followupAction := getFollowupEventAction(invitedFamily, Event{}, make(map[Event]int))
-
-	return message, followupAction
+	return message
 }
 
 func getFollowupEventAction(invitedFamily InvitedFamily, currentEvent Event, alreadyRsvpdEvents map[Event]int) (string, string) {
@@ -305,16 +612,23 @@ func getFollowupEventAction(invitedFamily InvitedFamily, currentEvent Event, alr
 	case isNextEvent(Wedding, currentEvent, alreadyRsvpdEvents, invitedFamily.WeddingInvited):
 		followupAction = Wedding.DialogflowAction
 	default:
-		message = "We've got you down for: \n"
-		for event, rsvpd := range alreadyRsvpdEvents {
-			message += fmt.Sprintf("%s: %d \n", event.DisplayName, rsvpd)
-		}
-		message += "See you there! :) \nP.S. Come chat again if you need to update your RSVP." // Tried & failed -- emoji.Sprint(":tada:") \U0001f389
+		summaryCard := rsvpSummaryCard(alreadyRsvpdEvents)
+		message = summaryCard.Title + "\n" + summaryCard.Subtitle + "\n" + RSVP_SUMMARY_CLOSING
 	}
 
 	return message, followupAction
 }
 
+func rsvpSummaryCard(alreadyRsvpdEvents map[Event]int) Card {
+	var lines []string
+	for _, event := range AllEvents {
+		if rsvpd, ok := alreadyRsvpdEvents[event]; ok {
+			lines = append(lines, fmt.Sprintf("%s: %d", event.DisplayName, rsvpd))
+		}
+	}
+	return Card{Title: RSVP_SUMMARY_TITLE, Subtitle: strings.Join(lines, "\n")}
+}
+
 func isNextEvent(event Event, currentEvent Event, alreadyRsvpdEvents map[Event]int, totalInvitees int) bool {
 	_, alreadyRsvpd := alreadyRsvpdEvents[event]
 	return !alreadyRsvpd && totalInvitees > 0 && currentEvent != event
@@ -339,38 +653,72 @@ func CaseInsensitiveContains(s, substr string) bool {
 }
 
 func findInvitedFamily(inviteNumber int) InvitedFamily {
-	wrappedInvitedFamily, _, err := SearchForInvitedFamily(inviteNumber)
+	invitedFamily, _, err := guestStore.FindFamily(inviteNumber)
 	if err != nil {
 		log.Fatalf("Unable to retrieve data from sheet: %v", err)
 	}
 
-	log.Printf("Invited family for invite code %d - %+v", inviteNumber, wrappedInvitedFamily)
+	log.Printf("Invited family for invite code %d - %+v", inviteNumber, invitedFamily)
 
-	return toInvitedFamily(wrappedInvitedFamily)
+	return invitedFamily
+}
+
+// lookupInvitedFamily is like findInvitedFamily, but returns false instead of
+// failing when there's no family with the given invite code
+func lookupInvitedFamily(inviteNumber int) (InvitedFamily, bool) {
+	invitedFamily, found, err := guestStore.FindFamily(inviteNumber)
+	if err != nil {
+		log.Fatalf("Unable to retrieve data from sheet: %v", err)
+	}
+	return invitedFamily, found
 }
 
-func toInvitedFamily(wrappedInvitedFamily []interface{}) InvitedFamily {
-	// Todo: break into separate function
-	inviteCodeFromInvitedFamily, _ := convertSheetCellToNumber(wrappedInvitedFamily[3])
-	vidhiInvited, _ := convertSheetCellToNumber(wrappedInvitedFamily[4])
-	vidhiRsvpd, _ := convertSheetCellToNumber(wrappedInvitedFamily[5])
-	garbaInvited, _ := convertSheetCellToNumber(wrappedInvitedFamily[6])
-	garbaRsvpd, _ := convertSheetCellToNumber(wrappedInvitedFamily[7])
-	weddingInvited, _ := convertSheetCellToNumber(wrappedInvitedFamily[8])
-	weddingRsvpd, _ := convertSheetCellToNumber(wrappedInvitedFamily[9])
+// toInvitedFamily converts an INVITED_FAMILY row, failing on the first cell
+// that isn't what the column expects (i.e. "4 ppl" instead of 4)
+func toInvitedFamily(wrappedInvitedFamily []interface{}, columns ColumnMap) (InvitedFamily, error) {
+	invitedFamily := InvitedFamily{
+		Origin:     fmt.Sprint(columns.cell(wrappedInvitedFamily, "Origin")),
+		Name:       fmt.Sprint(columns.cell(wrappedInvitedFamily, "Name")),
+		InviteName: fmt.Sprint(columns.cell(wrappedInvitedFamily, "Invite Name")),
+	}
+	cellError := func(column string) error {
+		return fmt.Errorf("col %s (%s) isn't a number: %q", columns.letter(column), column, fmt.Sprint(columns.cell(wrappedInvitedFamily, column)))
+	}
+
+	var err error
+	if invitedFamily.InviteCode, err = convertSheetCellToNumber(columns.cell(wrappedInvitedFamily, "Invite Code")); err != nil {
+		return invitedFamily, cellError("Invite Code")
+	}
+	for _, event := range AllEvents {
+		invitedCol, rsvpdCol := eventColumnName(event, "Invite"), eventColumnName(event, "RSVP'd")
+		invited, err := convertSheetCellToNumber(columns.cell(wrappedInvitedFamily, invitedCol))
+		if err != nil {
+			return invitedFamily, cellError(invitedCol)
+		}
+		rsvpd, err := convertRsvpCellToNumber(columns.cell(wrappedInvitedFamily, rsvpdCol))
+		if err != nil {
+			return invitedFamily, cellError(rsvpdCol)
+		}
+		invitedFamily.setInvited(event, invited)
+		invitedFamily.setRsvpd(event, rsvpd)
 
-	return InvitedFamily{
-		Origin:         fmt.Sprint(wrappedInvitedFamily[0]),
-		Name:           fmt.Sprint(wrappedInvitedFamily[1]),
-		InviteName:     fmt.Sprint(wrappedInvitedFamily[2]),
-		InviteCode:     inviteCodeFromInvitedFamily,
-		VidhiInvited:   vidhiInvited,
-		VidhiRsvpd:     vidhiRsvpd,
-		GarbaInvited:   garbaInvited,
-		GarbaRsvpd:     garbaRsvpd,
-		WeddingInvited: weddingInvited,
-		WeddingRsvpd:   weddingRsvpd,
+		invitedFamily.setChildrenRsvpd(event, NULL_INVITEES)
+		if !event.CountsChildren {
+			continue
+		}
+		childrenInvitedCol, childrenRsvpdCol := eventColumnName(event, "Children-Invite"), eventColumnName(event, "Children-RSVP'd")
+		childrenInvited, err := convertChildrenCellToNumber(columns.cell(wrappedInvitedFamily, childrenInvitedCol))
+		if err != nil {
+			return invitedFamily, cellError(childrenInvitedCol)
+		}
+		childrenRsvpd, err := convertRsvpCellToNumber(columns.cell(wrappedInvitedFamily, childrenRsvpdCol))
+		if err != nil {
+			return invitedFamily, cellError(childrenRsvpdCol)
+		}
+		invitedFamily.setChildrenInvited(event, childrenInvited)
+		invitedFamily.setChildrenRsvpd(event, childrenRsvpd)
 	}
+	return invitedFamily, nil
 }
 
 func convertSheetCellToNumber(data interface{}) (int, error) {
@@ -385,67 +733,145 @@ func convertSheetCellToNumber(data interface{}) (int, error) {
 	}
 }
 
-func SearchForInvitedFamily(inviteNumber int) ([]interface{}, int, error) {
-	colRange := "A2:J" + strconv.Itoa(TOTAL_INVITED_FAMILY)
-	allInvitedFamilies, err := getGoogleSheetsData(INVITED_FAMILY, colRange)
+// readInvitedFamilySheet reads INVITED_FAMILY, finding its columns from the
+// header row. The rows returned start at row 2.
+func readInvitedFamilySheet() (ColumnMap, [][]interface{}, error) {
+	rows, err := getAllGoogleSheetsRows(INVITED_FAMILY)
 	if err != nil {
-		return nil, -1, err
+		return nil, nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil, fmt.Errorf("%s doesn't have a header row", INVITED_FAMILY)
+	}
+	columns, missing := newColumnMap(rows[0], guestListColumns())
+	if len(missing) > 0 {
+		return columns, nil, fmt.Errorf("%s doesn't have the %s column(s), rename the headers or add them to COLUMN_ALIASES", INVITED_FAMILY, strings.Join(missing, ", "))
 	}
+	return columns, rows[1:], nil
+}
 
-	var invitedFamily []interface{}
-	var rowNumber int
-	for i, currentInvitedFamily := range allInvitedFamilies {
-		// log.Printf("Current invited family: %+v", currentInvitedFamily)
-		if len(currentInvitedFamily) > 3 {
-			currentInviteNumber, err := convertSheetCellToNumber(currentInvitedFamily[3])
-			if err != nil || currentInviteNumber == -1 {
-				log.Fatalf("Invite code for entry (%s) wasn't a string or int. Error: +%v", strconv.Itoa(i), err)
-			}
-			if err == nil && inviteNumber == currentInviteNumber {
-				invitedFamily = currentInvitedFamily
-				rowNumber = i + 2 // 1 for header & 1 to convert from 0-based to 1-based
-				break
-			}
+func getAllInvitedFamilies() ([]InvitedFamily, error) {
+	columns, allInvitedFamilies, err := readInvitedFamilySheet()
+	if err != nil {
+		return nil, err
+	}
 
+	var invitedFamilies []InvitedFamily
+	for i, currentInvitedFamily := range allInvitedFamilies {
+		if len(currentInvitedFamily) == 0 {
+			continue
 		}
+		invitedFamily, err := toInvitedFamily(currentInvitedFamily, columns)
+		if err != nil {
+			log.Printf("Skipping invited family entry (%d) as %v", i+2, err)
+			continue
+		}
+		invitedFamilies = append(invitedFamilies, invitedFamily)
 	}
-	// TODO error not found?
+	return invitedFamilies, nil
+}
 
-	return invitedFamily, rowNumber, nil
+// convertChildrenCellToNumber reads an empty children cell as no children invited
+func convertChildrenCellToNumber(data interface{}) (int, error) {
+	if fmt.Sprint(data) == "" {
+		return 0, nil
+	}
+	return convertSheetCellToNumber(data)
 }
 
-func saveRsvp(inviteCode int, phoneNumber string, rsvps map[Event]int) {
+// convertRsvpCellToNumber keeps NULL or empty (no RSVP yet) apart from 0 (not attending)
+func convertRsvpCellToNumber(data interface{}) (int, error) {
+	if cell := fmt.Sprint(data); cell == "NULL" || cell == "" {
+		return NULL_INVITEES, nil
+	}
+	return convertSheetCellToNumber(data)
+}
 
-	// Save to Update Event
-	resp, err := createUpdateEvents(strconv.Itoa(inviteCode), phoneNumber, rsvps)
+// SearchForInvitedFamily returns the family's INVITED_FAMILY row & row number
+// (0 when there's no family with the invite code), along with the sheet's columns.
+// It looks the invite code up in the index first, and only reads the whole
+// sheet when the family isn't indexed.
+func SearchForInvitedFamily(inviteNumber int) ([]interface{}, int, ColumnMap, error) {
+	invitedFamily, rowNumber, columns, err := findIndexedInvitedFamily(inviteNumber)
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("Unable to look up invite code %d in the index: %v", inviteNumber, err)
+	} else if rowNumber != 0 {
+		return invitedFamily, rowNumber, columns, nil
 	}
 
-	log.Printf("Http status code for appending an update event: +%v", resp.HTTPStatusCode)
+	invitedFamily, rowNumber, columns, err = scanForInvitedFamily(inviteNumber)
+	if err != nil || rowNumber == 0 {
+		return invitedFamily, rowNumber, columns, err
+	}
+	// So the next lookup only reads this row
+	if err := indexInvitedFamilyRow(inviteNumber, rowNumber); err != nil {
+		log.Printf("Unable to index invite code %d: %v", inviteNumber, err)
+	}
+	return invitedFamily, rowNumber, columns, nil
+}
 
-	// Save to Invited Family
-	batchResp, batchErr := updateInvitedFamilyRsvp(inviteCode, rsvps)
-	if batchErr != nil {
-		log.Fatal(batchErr)
+// scanForInvitedFamily reads all of INVITED_FAMILY to find the invite code
+func scanForInvitedFamily(inviteNumber int) ([]interface{}, int, ColumnMap, error) {
+	columns, allInvitedFamilies, err := readInvitedFamilySheet()
+	if err != nil {
+		return nil, -1, columns, err
 	}
-	log.Printf("Http status code for updating invited family RSVP: +%v", batchResp.HTTPStatusCode)
+
+	var invitedFamily []interface{}
+	var rowNumber int
+	for i, currentInvitedFamily := range allInvitedFamilies {
+		cell := columns.cell(currentInvitedFamily, "Invite Code")
+		if cell == "" {
+			continue
+		}
+		currentInviteNumber, err := convertSheetCellToNumber(cell)
+		if err != nil {
+			log.Printf("Skipping invited family entry (%d) as its invite code isn't a number: %v", i+2, err)
+			continue
+		}
+		if inviteNumber == currentInviteNumber {
+			invitedFamily = currentInvitedFamily
+			rowNumber = i + 2 // 1 for header & 1 to convert from 0-based to 1-based
+			break
+		}
+	}
+
+	return invitedFamily, rowNumber, columns, nil
+}
+
+// saveRsvp saves the RSVPs, within the events' capacities. It returns the
+// counts saved & the family's waitlist entries for the guests that didn't fit.
+func saveRsvp(inviteCode int, phoneNumber string, rsvps map[Event]int, children map[Event]int) (map[Event]int, []WaitlistEntry) {
+	saved, waitlisted := rsvps, []WaitlistEntry(nil)
+	var err error
+	if hasCapacity(rsvps) {
+		saved, waitlisted, err = saveRsvpWithinCapacity(inviteCode, phoneNumber, rsvps, children)
+	} else {
+		err = guestStore.SaveRsvps(inviteCode, phoneNumber, rsvps, children)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := useOverrideCode(saved); err != nil {
+		log.Fatalf("Unable to use the override code %s for invite code %d: %v", overrideCode, inviteCode, err)
+	}
+	return saved, waitlisted
 }
 
-func createUpdateEvents(inviteCode string, phoneNumber string, rsvps map[Event]int) (*sheets.AppendValuesResponse, error) {
+func createUpdateEvents(inviteCode string, phoneNumber string, rsvps map[Event]int, children map[Event]int) (*sheets.AppendValuesResponse, error) {
 	// Save to Update Event
 	var rows [][]interface{}
 	for event, attendees := range rsvps {
 		var rowData []interface{}
-		rowData = append(rowData, inviteCode, phoneNumber, event.Name, attendees, time.Now(), sessionID, responseID, requestStr)
+		rowData = append(rowData, inviteCode, phoneNumber, event.Name, attendees, time.Now(), sessionID, responseID, requestStr, overrideCode, formatChildrenCell(children, event))
 		rows = append(rows, rowData)
 	}
 
 	return appendGoogleSheetsData(UPDATE_EVENT, rows)
 }
 
-func updateInvitedFamilyRsvp(inviteCode int, rsvps map[Event]int) (*sheets.BatchUpdateValuesResponse, error) {
-	_, rowNumber, err := SearchForInvitedFamily(inviteCode)
+func updateInvitedFamilyRsvp(inviteCode int, rsvps map[Event]int, children map[Event]int) (*sheets.BatchUpdateValuesResponse, error) {
+	_, rowNumber, columns, err := SearchForInvitedFamily(inviteCode)
 	if err != nil {
 		log.Fatalf("Unable to update Invited Family rsvp as we can't retrieve the row number: %v", err)
 	}
@@ -457,8 +883,17 @@ func updateInvitedFamilyRsvp(inviteCode int, rsvps map[Event]int) (*sheets.Batch
 		var rows [][]interface{}
 		rowData = append(rowData, attendees)
 		rows = append(rows, rowData)
-		writeRange := INVITED_FAMILY + "!" + event.RsvpdCol + strconv.Itoa(rowNumber)
+		writeRange := INVITED_FAMILY + "!" + columns.letter(eventColumnName(event, "RSVP'd")) + strconv.Itoa(rowNumber)
 		batchValues = append(batchValues, &sheets.ValueRange{Values: rows, Range: writeRange})
+
+		if event.CountsChildren {
+			childrenRsvpd, ok := children[event]
+			if !ok {
+				childrenRsvpd = NULL_INVITEES
+			}
+			writeRange := INVITED_FAMILY + "!" + columns.letter(eventColumnName(event, "Children-RSVP'd")) + strconv.Itoa(rowNumber)
+			batchValues = append(batchValues, &sheets.ValueRange{Values: [][]interface{}{{formatRsvpCell(childrenRsvpd)}}, Range: writeRange})
+		}
 	}
 	return setGoogleSheetsData(batchValues)
 }
@@ -482,7 +917,10 @@ func getGoogleSheetsData(sheetName string, colRange string) ([][]interface{}, er
 	// Retrieve Data
 	readRange := sheetName + "!" + colRange
 	resp, err := getGoogleSheetsClient().Spreadsheets.Values.Get(spreadsheetID, readRange).Do()
-	return resp.Values, err
+	if err != nil {
+		return nil, err
+	}
+	return resp.Values, nil
 }
 
 func getGoogleSheetsClient() *sheets.Service {
@@ -506,7 +944,23 @@ func getGoogleSheetsClient() *sheets.Service {
 
 func main() {
 	spreadsheetID = os.Getenv("SPREADSHEET_ID")
+	store, err := newGuestStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+	guestStore = store
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:])
+		return
+	}
 	fmt.Println("Start app")
-	fmt.Println("Start lambda handler")
-	lambda.Start(Handler)
+	switch os.Getenv("LAMBDA_FUNCTION") {
+	case "reminders":
+		fmt.Println("Start reminders lambda handler")
+		lambda.Start(ReminderHandler)
+	default:
+		go logSpreadsheetProblems()
+		fmt.Println("Start lambda handler")
+		lambda.Start(Handler)
+	}
 }
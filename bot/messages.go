@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Messages shared by the channels that don't go through Dialogflow (i.e. SMS),
+// where the agent's responses aren't available
+const (
+	WELCOME_MSG                  = "Hi! Please reply with the invite code printed on your invitation card."
+	INVITE_CODE_NOT_FOUND_MSG    = "Sorry, we couldn't find an invitation with that invite code. Please double check the code printed on your invitation card."
+	NOT_NOW_MSG                  = "No problem! Reply YES whenever you're ready to RSVP."
+	DIDNT_UNDERSTAND_MSG         = "Sorry, I didn't get that."
+	INVALID_OVERRIDE_CODE_MSG    = "Sorry, that override code isn't valid for your invitation."
+	OVERRIDE_CODE_ACCEPTED_MSG   = "Thanks! You can update your RSVP now."
+	SHUTTLE_INVITE_CODE_MSG      = "Please tell me your invite code first, so I can look up your shuttle."
+	SHUTTLE_UNAVAILABLE_MSG      = "Sorry, I can't look up the shuttles right now. Please try again later."
+	SEATING_INVITE_CODE_MSG      = "Please tell me your invite code first, so I can look up your table."
+	SEATING_UNAVAILABLE_MSG      = "Sorry, I can't look up the seating right now. Please try again later."
+	WAITLIST_CONTINUE_MSG        = "Come chat again to RSVP to your other events."
+	SEAT_REQUEST_INVITE_CODE_MSG = "Please tell me your invite code first, so I can pass your request on to the hosts."
+	SEAT_REQUEST_EVENT_MSG       = "Which event would you like more seats at, and why? i.e. \"plus one to the WEDDING for my fiance\""
+	SEAT_DECISION_UNVERIFIED_MSG = "Sorry, seat requests can only be approved or denied by text when the Twilio signature is checked. Please use the admin API instead."
+)
+
+func rsvpNowPromptMsg() string {
+	return RSVP_NOW_QUESTION + " (Yes / Not now)"
+}
+
+func rsvpCountPromptMsg(event Event, invited int) string {
+	message := fmt.Sprintf("How many people from your family will be attending the %s?", event.DisplayName)
+	if invited != MAX_INVITEES {
+		message += fmt.Sprintf(" You're invited: %d.", invited)
+	}
+	return message
+}
+
+// rsvpPromptMsg asks for the event's RSVP count, or only the adults when the
+// event counts children
+func rsvpPromptMsg(event Event, invitedFamily InvitedFamily) string {
+	if !event.CountsChildren {
+		return rsvpCountPromptMsg(event, invitedFamily.invitedTo(event))
+	}
+	adults, _ := invitedFamily.invitedSplit(event)
+	message := fmt.Sprintf("How many adults from your family will be attending the %s?", event.DisplayName)
+	if adults != MAX_INVITEES {
+		message += fmt.Sprintf(" You're invited: %d adults.", adults)
+	}
+	return message
+}
+
+func rsvpChildrenPromptMsg(event Event, invitedChildren int) string {
+	message := fmt.Sprintf("And how many children will be attending the %s?", event.DisplayName)
+	if invitedChildren != MAX_INVITEES {
+		message += fmt.Sprintf(" You're invited: %d children.", invitedChildren)
+	}
+	return message
+}
+
+func rsvpCountTooHighMsg(event Event, invited int) string {
+	return fmt.Sprintf("Sorry, only %d people from your family are invited to the %s.", invited, event.DisplayName)
+}
+
+// attendeeNamesPromptMsg asks who's coming, listing the family members the
+// hosts pre-seeded so they can be picked by number
+func attendeeNamesPromptMsg(event Event, rsvpd int, members []string) string {
+	message := fmt.Sprintf("Who's coming to the %s? Reply with the %d names separated by commas", event.DisplayName, rsvpd)
+	if len(members) > 0 {
+		var picks []string
+		for i, member := range members {
+			picks = append(picks, fmt.Sprintf("%d. %s", i+1, member))
+		}
+		message += ", or their numbers (" + strings.Join(picks, ", ") + ")"
+	}
+	return message + ". Reply SKIP to skip."
+}
+
+// dietaryPromptMsg asks about dietary needs, by name when we know who's coming
+func dietaryPromptMsg(event Event, options []string, attendees []string) string {
+	message := fmt.Sprintf("Any dietary needs for the %s? We can do %s. Reply with how many of each (i.e. \"2 %s\")", event.DisplayName, strings.Join(options, ", "), options[0])
+	if len(attendees) > 0 {
+		var picks []string
+		for i, attendee := range attendees {
+			picks = append(picks, fmt.Sprintf("%d. %s", i+1, attendee))
+		}
+		message += fmt.Sprintf(" or by name or number (i.e. \"%s: %s\"; %s)", attendees[0], options[0], strings.Join(picks, ", "))
+	}
+	return message + ". Reply NONE if there aren't any."
+}
+
+func dietaryTooManyMsg(event Event, rsvpd int) string {
+	return fmt.Sprintf("Sorry, that's more than the %d people coming to the %s.", rsvpd, event.DisplayName)
+}
+
+// accessibilityPromptMsg asks about accessibility needs, with the options
+// numbered so they can be picked by number
+func accessibilityPromptMsg(options []string) string {
+	var picks []string
+	for i, option := range options {
+		picks = append(picks, fmt.Sprintf("%d. %s", i+1, option))
+	}
+	return fmt.Sprintf("Does anyone in your family need help getting around on the day? Reply with the numbers that apply (%s) and anything else we should know. Reply NONE if not.", strings.Join(picks, ", "))
+}
+
+// hostAccessibilityMsg lets the hosts know a family told us about accessibility needs
+func hostAccessibilityMsg(invitedFamily InvitedFamily, needs AccessibilityNeeds) string {
+	var rsvps []string
+	for _, event := range AllEvents {
+		if rsvpd := invitedFamily.rsvpdTo(event); rsvpd > 0 {
+			rsvps = append(rsvps, fmt.Sprintf("%s: %d", event.DisplayName, rsvpd))
+		}
+	}
+	message := fmt.Sprintf("Accessibility needs from %s (invite code %d, coming to %s):", invitedFamily.InviteName, invitedFamily.InviteCode, strings.Join(rsvps, ", "))
+	if len(needs.Options) > 0 {
+		message += " " + strings.Join(needs.Options, ", ") + "."
+	}
+	if needs.Notes != "" {
+		message += fmt.Sprintf(" \"%s\"", needs.Notes)
+	}
+	return message
+}
+
+// travelPromptMsg asks one of the travel questions of out-of-town families
+func travelPromptMsg(question string) string {
+	switch question {
+	case TRAVEL_ARRIVAL:
+		return "Since you're travelling in, we'd love to help with airport pickups & hotel rooms. When do you land? Reply with the date, time & flight number (i.e. \"Mar 14 3:30pm AI 127\"), or SKIP."
+	case TRAVEL_DEPARTURE:
+		return "And when do you fly out? Reply with the date, time & flight number, or SKIP."
+	case TRAVEL_ROOMS:
+		return "How many hotel rooms will your family need? Reply 0 if you're staying elsewhere."
+	}
+	return ""
+}
+
+// roomAssignmentMsg tells the family where they're staying, with the details
+// of each block (by RoomBlock key) they're in
+func roomAssignmentMsg(invitedFamily InvitedFamily, assignments []RoomAssignment, details map[string]string) string {
+	var stays []string
+	for _, assignment := range assignments {
+		rooms := "a " + assignment.RoomType + " room"
+		if assignment.Rooms > 1 {
+			rooms = fmt.Sprintf("%d %s rooms", assignment.Rooms, assignment.RoomType)
+		}
+		stay := fmt.Sprintf("%s at %s, checking in %s & out %s", rooms, assignment.Hotel, assignment.CheckIn.Format("Mon Jan 2"), assignment.CheckOut.Format("Mon Jan 2"))
+		if assignment.Confirmation != "" {
+			stay += " (confirmation " + assignment.Confirmation + ")"
+		}
+		if detail := details[assignment.key()]; detail != "" {
+			stay += ". " + strings.TrimSuffix(detail, ".")
+		}
+		stays = append(stays, stay)
+	}
+	return fmt.Sprintf("Hi %s! We've booked %s. See you soon!", invitedFamily.InviteName, strings.Join(stays, "; "))
+}
+
+// shuttleScheduleMsg lists the shuttle runs the family is on, with how many of
+// their seats are on each
+func shuttleScheduleMsg(runs []ShuttleRun, seats []int) string {
+	if len(runs) == 0 {
+		return "We don't have you on a shuttle yet. Shuttles are for guests staying at the hotel block, we'll text you once they're scheduled."
+	}
+	var trips []string
+	for i, run := range runs {
+		trips = append(trips, fmt.Sprintf("the %s, leaving %s at %s (%d seats)", run.Event.DisplayName, run.Hotel, run.Departs.Format("Mon Jan 2 3:04pm"), seats[i]))
+	}
+	return "Your shuttles: " + strings.Join(trips, "; ") + ". Please be in the lobby 10 minutes early!"
+}
+
+// seatingMsg lists the family's tables at each event
+func seatingMsg(assignments []SeatAssignment) string {
+	if len(assignments) == 0 {
+		return "We haven't done the seating chart for your invitation yet, check back closer to the day!"
+	}
+	var tables []string
+	for _, assignment := range assignments {
+		table := assignment.Table
+		if _, err := strconv.Atoi(table); err == nil {
+			table = "table " + table
+		}
+		table = fmt.Sprintf("%s at the %s", table, assignment.Event.DisplayName)
+		if len(assignment.Names) > 0 {
+			table += " (" + strings.Join(assignment.Names, ", ") + ")"
+		}
+		tables = append(tables, table)
+	}
+	return "You're at " + strings.Join(tables, "; ") + ". See you there!"
+}
+
+// waitlistedMsg tells the family the event is full, and where they are on the waitlist
+func waitlistedMsg(event Event, confirmed int, entry WaitlistEntry) string {
+	if confirmed == 0 {
+		return fmt.Sprintf("Sorry, the %s is full, so we've put your %d on the waitlist (#%d). We'll text you if seats open up.", event.DisplayName, entry.Guests, entry.Position)
+	}
+	return fmt.Sprintf("Sorry, the %s is nearly full, so we've got you down for %d and %d more on the waitlist (#%d). We'll text you if seats open up.", event.DisplayName, confirmed, entry.Guests, entry.Position)
+}
+
+// waitlistPromotedMsg is the text to a family given seats off the waitlist
+func waitlistPromotedMsg(invitedFamily InvitedFamily, event Event, rsvpd int, stillWaiting int) string {
+	message := fmt.Sprintf("Good news %s! Seats opened up at the %s, so we've got you down for %d now.", invitedFamily.InviteName, event.DisplayName, rsvpd)
+	if stillWaiting > 0 {
+		message += fmt.Sprintf(" %d more are still on the waitlist.", stillWaiting)
+	}
+	return message + " See you there!"
+}
+
+func seatRequestedMsg(event Event, seats int) string {
+	more := "1 more seat"
+	if seats > 1 {
+		more = fmt.Sprintf("%d more seats", seats)
+	}
+	return fmt.Sprintf("Thanks! We've asked the hosts for %s at the %s, we'll let you know once they've decided.", more, event.DisplayName)
+}
+
+func seatRequestTooManyMsg() string {
+	return fmt.Sprintf("Sorry, I can only pass on requests for up to %d more seats. Please contact the hosts about anything bigger.", MAX_SEAT_REQUEST)
+}
+
+func seatRequestPendingMsg(event Event) string {
+	return fmt.Sprintf("You've already asked for more seats at the %s, the hosts will get back to you soon.", event.DisplayName)
+}
+
+// hostSeatRequestMsg is the text to the hosts about a guest's request for more seats
+func hostSeatRequestMsg(invitedFamily InvitedFamily, request SeatRequest) string {
+	return fmt.Sprintf("Seat request %d: %s (invite code %d) asks for %d more at the %s: \"%s\". Reply APPROVE %d or DENY %d.",
+		request.ID, invitedFamily.InviteName, invitedFamily.InviteCode, request.Seats, request.Event, request.Reason, request.ID, request.ID)
+}
+
+// seatDecisionMsg tells the family what the hosts decided about their request
+func seatDecisionMsg(invitedFamily InvitedFamily, event Event, request SeatRequest) string {
+	if request.Status != SEAT_REQUEST_APPROVED {
+		return fmt.Sprintf("Hi %s, sorry, the hosts can't fit more guests at the %s. We hope to see you there!", invitedFamily.InviteName, event.DisplayName)
+	}
+	return fmt.Sprintf("Good news %s! The hosts said yes to %d more at the %s. Reply YES to update your RSVP.", invitedFamily.InviteName, request.Seats, event.DisplayName)
+}
+
+// invitationSmsMsg is the invitation we text to families before they've texted us
+func invitationSmsMsg(invitedFamily InvitedFamily) string {
+	message := fmt.Sprintf("Hi %s! You're invited to: ", invitedFamily.InviteName)
+	for _, event := range AllEvents {
+		if invited := invitedFamily.invitedTo(event); invited > 0 {
+			message += eventInviteMsg(event, invited)
+		}
+	}
+	message += fmt.Sprintf("\nYour invite code is %d. Reply with your invite code to RSVP.", invitedFamily.InviteCode)
+	return message
+}
+
+// reminderSmsMsg reminds the family to RSVP to the events they haven't RSVP'd
+// to yet, with each event's deadline when they're not all the same
+func reminderSmsMsg(invitedFamily InvitedFamily, outstandingEvents []Event, deadlines map[Event]time.Time) string {
+	sameDeadline := true
+	for _, event := range outstandingEvents {
+		sameDeadline = sameDeadline && deadlines[event].Equal(deadlines[outstandingEvents[0]])
+	}
+	var eventNames []string
+	for _, event := range outstandingEvents {
+		eventNames = append(eventNames, event.DisplayName)
+	}
+	message := fmt.Sprintf("Hi %s! Friendly reminder to RSVP for the %s by %s", invitedFamily.InviteName, strings.Join(eventNames, " & "), deadlines[outstandingEvents[0]].Format("January 2"))
+	if !sameDeadline {
+		var eventDeadlines []string
+		for _, event := range outstandingEvents {
+			eventDeadlines = append(eventDeadlines, event.DisplayName+" by "+deadlines[event].Format("January 2"))
+		}
+		message = fmt.Sprintf("Hi %s! Friendly reminder to RSVP for the %s", invitedFamily.InviteName, strings.Join(eventDeadlines, " & the "))
+	}
+	return message + fmt.Sprintf(". Reply with your invite code (%d) to RSVP.", invitedFamily.InviteCode)
+}
+
+func rsvpDeadlinePassedMsg(event Event, deadline time.Time) string {
+	return fmt.Sprintf("Sorry, RSVPs for the %s closed on %s. Please contact the hosts if you need to make changes.", event.DisplayName, deadline.Format("January 2"))
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	REMINDER_LOG = "REMINDER_LOG"
+
+	DATE_FORMAT           = "2006-01-02"
+	DEFAULT_REMINDER_DAYS = "21,10,3"
+)
+
+// Reminder is a text reminding a family to RSVP to the events they haven't RSVP'd to yet
+type Reminder struct {
+	InviteCode         int
+	PhoneNumber        string
+	Events             []Event
+	DaysBeforeDeadline int
+	Message            string
+}
+
+// ReminderConfig comes from each event's RSVP deadline (its own
+// <EVENT>_RSVP_DEADLINE or RSVP_DEADLINE, i.e. 2019-03-01) and REMINDER_DAYS
+// (days before the deadline to send reminders, i.e. 21,10,3)
+type ReminderConfig struct {
+	Deadlines    map[Event]time.Time
+	ReminderDays []int
+}
+
+func getReminderConfig() (ReminderConfig, error) {
+	config := ReminderConfig{Deadlines: make(map[Event]time.Time)}
+	for _, event := range AllEvents {
+		if deadline, ok := event.rsvpDeadline(); ok {
+			config.Deadlines[event] = deadline
+		}
+	}
+	if len(config.Deadlines) == 0 {
+		return config, fmt.Errorf("RSVP_DEADLINE or an event's own RSVP deadline (i.e. WEDDING_RSVP_DEADLINE) has to be set to a date like 2019-03-01")
+	}
+
+	reminderDays := os.Getenv("REMINDER_DAYS")
+	if reminderDays == "" {
+		reminderDays = DEFAULT_REMINDER_DAYS
+	}
+	for _, day := range strings.Split(reminderDays, ",") {
+		daysBefore, err := strconv.Atoi(strings.TrimSpace(day))
+		if err != nil {
+			return config, fmt.Errorf("REMINDER_DAYS has to be a list of numbers like 21,10,3: %v", err)
+		}
+		config.ReminderDays = append(config.ReminderDays, daysBefore)
+	}
+	return config, nil
+}
+
+// ReminderHandler is run on a schedule (see the reminders function in serverless.yml)
+func ReminderHandler(event events.CloudWatchEvent) error {
+	log.Printf("Sending reminders for scheduled event: %s", event.ID)
+	provider, err := smsProviderFromEnv()
+	if err != nil {
+		return err
+	}
+	return sendReminders(provider, time.Now(), false, false)
+}
+
+func sendRemindersCommand(args []string) error {
+	flags := flag.NewFlagSet("send-reminders", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "print the reminders instead of sending them (nothing is written to the sheet)")
+	providerName := flags.String("provider", "twilio", "sms provider: twilio, stdout or file")
+	outputFile := flags.String("out", "reminders.txt", "file the reminders are written to when -provider=file")
+	date := flags.String("date", "", "send the reminders due on this date (i.e. 2019-02-08) instead of today")
+	force := flags.Bool("force", false, "send reminders today even if it's not one of the REMINDER_DAYS")
+	flags.Parse(args)
+
+	today := time.Now()
+	if *date != "" {
+		var err error
+		if today, err = time.ParseInLocation(DATE_FORMAT, *date, time.Local); err != nil {
+			return err
+		}
+	}
+
+	var provider SmsProvider = &WriterSmsProvider{Writer: os.Stdout}
+	if !*dryRun {
+		var err error
+		if provider, err = newSmsProvider(*providerName, *outputFile); err != nil {
+			return err
+		}
+	}
+	return sendReminders(provider, today, *force, *dryRun)
+}
+
+func sendReminders(provider SmsProvider, today time.Time, force bool, dryRun bool) error {
+	config, err := getReminderConfig()
+	if err != nil {
+		return err
+	}
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		return err
+	}
+	directory, err := getPhoneDirectory()
+	if err != nil {
+		return err
+	}
+	remindedToday, err := getRemindedPhoneNumbers(today)
+	if err != nil {
+		return err
+	}
+
+	reminders := remindersDue(invitedFamilies, directory, remindedToday, config, today, force)
+	log.Printf("Sending %d reminders for %s", len(reminders), today.Format(DATE_FORMAT))
+
+	var failed int
+	for _, reminder := range reminders {
+		status, details := INVITATION_SENT, ""
+		messageID, err := provider.SendSms(reminder.PhoneNumber, reminder.Message)
+		if err != nil {
+			log.Printf("Unable to send the reminder for invite code %d to %s: %v", reminder.InviteCode, reminder.PhoneNumber, err)
+			status, details = INVITATION_FAILED, err.Error()
+			failed++
+		} else {
+			details = messageID
+		}
+		if !dryRun {
+			logStatusError(logReminder(reminder, today, status, details))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d reminders failed", failed, len(reminders))
+	}
+	return nil
+}
+
+// remindersDue returns a reminder for each phone number of the families that
+// haven't RSVP'd to the events whose reminder day is today. Events without a
+// deadline or with RSVPs closed are skipped, as are phone numbers that were
+// already sent a reminder today.
+func remindersDue(invitedFamilies []InvitedFamily, directory []PhoneDirectoryEntry, remindedToday map[string]bool, config ReminderConfig, today time.Time, force bool) []Reminder {
+	daysBefore := make(map[Event]int)
+	for event, deadline := range config.Deadlines {
+		days := daysBetween(today, deadline)
+		if days < 0 {
+			continue
+		}
+		isReminderDay := force
+		for _, reminderDay := range config.ReminderDays {
+			if reminderDay == days {
+				isReminderDay = true
+			}
+		}
+		if isReminderDay {
+			daysBefore[event] = days
+		}
+	}
+	if len(daysBefore) == 0 {
+		return nil
+	}
+
+	phoneNumbers := make(map[int][]string)
+	for _, entry := range directory {
+		phoneNumbers[entry.InviteCode] = append(phoneNumbers[entry.InviteCode], entry.PhoneNumber)
+	}
+
+	var reminders []Reminder
+	for _, family := range invitedFamilies {
+		var due []Event
+		closest := -1
+		for _, event := range family.outstandingEvents() {
+			if days, ok := daysBefore[event]; ok {
+				due = append(due, event)
+				if closest == -1 || days < closest {
+					closest = days
+				}
+			}
+		}
+		if len(due) == 0 {
+			continue
+		}
+		for _, phoneNumber := range phoneNumbers[family.InviteCode] {
+			if remindedToday[phoneNumber] {
+				continue
+			}
+			remindedToday[phoneNumber] = true
+			reminders = append(reminders, Reminder{
+				InviteCode:         family.InviteCode,
+				PhoneNumber:        phoneNumber,
+				Events:             due,
+				DaysBeforeDeadline: closest,
+				Message:            reminderSmsMsg(family, due, config.Deadlines),
+			})
+		}
+	}
+	sort.SliceStable(reminders, func(i, j int) bool { return reminders[i].InviteCode < reminders[j].InviteCode })
+	return reminders
+}
+
+// daysBetween counts calendar days, so the time of day the reminders run at doesn't matter
+func daysBetween(from time.Time, to time.Time) int {
+	fromDate := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toDate := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(toDate.Sub(fromDate).Hours() / 24)
+}
+
+func getRemindedPhoneNumbers(day time.Time) (map[string]bool, error) {
+	reminded := make(map[string]bool)
+	rows, err := getGoogleSheetsData(REMINDER_LOG, "A2:E")
+	if err != nil {
+		return reminded, err
+	}
+	date := day.Format(DATE_FORMAT)
+	for _, row := range rows {
+		if len(row) > 4 && fmt.Sprint(row[2]) == date && fmt.Sprint(row[4]) == INVITATION_SENT {
+			reminded[fmt.Sprint(row[1])] = true
+		}
+	}
+	return reminded, nil
+}
+
+func logReminder(reminder Reminder, day time.Time, status string, details string) error {
+	var eventNames []string
+	for _, event := range reminder.Events {
+		eventNames = append(eventNames, event.Name)
+	}
+	row := []interface{}{reminder.InviteCode, reminder.PhoneNumber, day.Format(DATE_FORMAT), reminder.DaysBeforeDeadline, status, strings.Join(eventNames, ","), details, time.Now()}
+	_, err := appendGoogleSheetsData(REMINDER_LOG, [][]interface{}{row})
+	return err
+}
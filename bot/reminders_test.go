@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRemindersDue(t *testing.T) {
+	families := []InvitedFamily{
+		{InviteName: "The Patel Family", InviteCode: 1, VidhiInvited: 4, VidhiRsvpd: NULL_INVITEES, WeddingInvited: 4, WeddingRsvpd: 3},
+		{InviteName: "The Shah Family", InviteCode: 2, WeddingInvited: MAX_INVITEES, WeddingRsvpd: 0},
+		{InviteName: "The Mehta Family", InviteCode: 3, GarbaInvited: 2, GarbaRsvpd: NULL_INVITEES},
+	}
+	directory := []PhoneDirectoryEntry{
+		{InviteCode: 1, PhoneNumber: "+15555550101"},
+		{InviteCode: 2, PhoneNumber: "+15555550102"},
+		{InviteCode: 3, PhoneNumber: "+15555550103"},
+		{InviteCode: 3, PhoneNumber: "+15555550104"},
+	}
+	deadline := time.Date(2019, 3, 1, 0, 0, 0, 0, time.Local)
+	config := ReminderConfig{Deadlines: map[Event]time.Time{Vidhi: deadline, Garba: deadline, Wedding: deadline}, ReminderDays: []int{21, 10, 3}}
+	remindedToday := map[string]bool{"+15555550104": true}
+
+	reminders := remindersDue(families, directory, remindedToday, config, time.Date(2019, 2, 19, 17, 0, 0, 0, time.Local), false)
+	if len(reminders) != 2 || reminders[0].PhoneNumber != "+15555550101" || reminders[1].PhoneNumber != "+15555550103" {
+		t.Fatalf("Unexpected reminders: +%v", reminders)
+	}
+	if len(reminders[0].Events) != 1 || reminders[0].Events[0] != Vidhi || reminders[0].DaysBeforeDeadline != 10 {
+		t.Errorf("Expected a reminder for the vidhi 10 days before the deadline, got: +%v", reminders[0])
+	}
+	expected := "Hi The Patel Family! Friendly reminder to RSVP for the VIDHI by March 1. Reply with your invite code (1) to RSVP."
+	if reminders[0].Message != expected {
+		t.Errorf("Expected message: %q, got: %q", expected, reminders[0].Message)
+	}
+}
+
+func TestRemindersDueOnlyOnReminderDays(t *testing.T) {
+	families := []InvitedFamily{{InviteCode: 1, VidhiInvited: 4, VidhiRsvpd: NULL_INVITEES}}
+	directory := []PhoneDirectoryEntry{{InviteCode: 1, PhoneNumber: "+15555550101"}}
+	deadline := time.Date(2019, 3, 1, 0, 0, 0, 0, time.Local)
+	config := ReminderConfig{Deadlines: map[Event]time.Time{Vidhi: deadline, Garba: deadline, Wedding: deadline}, ReminderDays: []int{21, 10, 3}}
+	today := time.Date(2019, 2, 20, 9, 0, 0, 0, time.Local)
+
+	if reminders := remindersDue(families, directory, make(map[string]bool), config, today, false); len(reminders) != 0 {
+		t.Errorf("Expected no reminders 9 days before the deadline, got: +%v", reminders)
+	}
+	if reminders := remindersDue(families, directory, make(map[string]bool), config, today, true); len(reminders) != 1 {
+		t.Errorf("Expected a forced reminder, got: +%v", reminders)
+	}
+}
+
+func TestRemindersDueForEachEventsDeadline(t *testing.T) {
+	families := []InvitedFamily{{InviteName: "The Patel Family", InviteCode: 1, VidhiInvited: 4, VidhiRsvpd: NULL_INVITEES, GarbaInvited: 4, GarbaRsvpd: NULL_INVITEES, WeddingInvited: 4, WeddingRsvpd: NULL_INVITEES}}
+	directory := []PhoneDirectoryEntry{{InviteCode: 1, PhoneNumber: "+15555550101"}}
+	// No deadline for the garba, the vidhi's RSVPs closed & the wedding's reminder is due
+	config := ReminderConfig{Deadlines: map[Event]time.Time{
+		Vidhi:   time.Date(2019, 2, 1, 0, 0, 0, 0, time.Local),
+		Wedding: time.Date(2019, 3, 1, 0, 0, 0, 0, time.Local),
+	}, ReminderDays: []int{21, 10, 3}}
+
+	reminders := remindersDue(families, directory, make(map[string]bool), config, time.Date(2019, 2, 19, 17, 0, 0, 0, time.Local), false)
+	if len(reminders) != 1 || len(reminders[0].Events) != 1 || reminders[0].Events[0] != Wedding || reminders[0].DaysBeforeDeadline != 10 {
+		t.Fatalf("Expected a reminder for the wedding only, got: +%v", reminders)
+	}
+
+	config.Deadlines[Vidhi] = time.Date(2019, 2, 22, 0, 0, 0, 0, time.Local)
+	reminders = remindersDue(families, directory, make(map[string]bool), config, time.Date(2019, 2, 19, 17, 0, 0, 0, time.Local), false)
+	if len(reminders) != 1 || reminders[0].DaysBeforeDeadline != 3 {
+		t.Fatalf("Expected one reminder for both events, 3 days before the closest deadline, got: +%v", reminders)
+	}
+	expected := "Hi The Patel Family! Friendly reminder to RSVP for the VIDHI by February 22 & the WEDDING by March 1. Reply with your invite code (1) to RSVP."
+	if reminders[0].Message != expected {
+		t.Errorf("Expected message: %q, got: %q", expected, reminders[0].Message)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	ALL_ORIGINS = "ALL ORIGINS"
+
+	REPORT_TABLE = "table"
+	REPORT_CSV   = "csv"
+	REPORT_JSON  = "json"
+)
+
+// HeadcountRow is the headcount of one event for the families from one origin
+// (or ALL_ORIGINS for the event's total). Families invited with ALL are
+// counted in FullFamilyInvites instead of Invited, since we don't know how
+// many people that is until they RSVP. The RSVP'd guests are split into
+// Adults & Children for the events that count children (children are counted
+// as adults when the family didn't say how many are coming).
+type HeadcountRow struct {
+	Event             string  `json:"event"`
+	Origin            string  `json:"origin"`
+	Families          int     `json:"families"`
+	Invited           int     `json:"invited"`
+	FullFamilyInvites int     `json:"fullFamilyInvites"`
+	Rsvpd             int     `json:"rsvpd"`
+	Adults            int     `json:"adults"`
+	Children          int     `json:"children"`
+	Declined          int     `json:"declined"`
+	Outstanding       int     `json:"outstanding"`
+	ResponseRate      float64 `json:"responseRate"` // families that have RSVP'd, from 0 to 1
+}
+
+var headcountColumns = []string{"Event", "Origin", "Families", "Invited", "Full Family Invites", "RSVP'd", "Adults", "Children", "Declined", "Outstanding", "Response Rate"}
+
+func (row HeadcountRow) record() []string {
+	return []string{
+		row.Event,
+		row.Origin,
+		strconv.Itoa(row.Families),
+		strconv.Itoa(row.Invited),
+		strconv.Itoa(row.FullFamilyInvites),
+		strconv.Itoa(row.Rsvpd),
+		strconv.Itoa(row.Adults),
+		strconv.Itoa(row.Children),
+		strconv.Itoa(row.Declined),
+		strconv.Itoa(row.Outstanding),
+		fmt.Sprintf("%.0f%%", row.ResponseRate*100),
+	}
+}
+
+func (row *HeadcountRow) add(invitedFamily InvitedFamily, event Event) {
+	invited, rsvpd := invitedFamily.invitedTo(event), invitedFamily.rsvpdTo(event)
+	row.Families++
+	if invited == MAX_INVITEES {
+		row.FullFamilyInvites++
+	} else {
+		row.Invited += invited
+	}
+
+	switch {
+	case rsvpd == NULL_INVITEES:
+		row.Outstanding++
+	case rsvpd == 0:
+		row.Declined++
+	default:
+		row.Rsvpd += rsvpd
+		children := invitedFamily.childrenRsvpdTo(event)
+		if !event.CountsChildren || children == NULL_INVITEES {
+			children = 0
+		}
+		row.Adults += rsvpd - children
+		row.Children += children
+	}
+	row.ResponseRate = float64(row.Families-row.Outstanding) / float64(row.Families)
+}
+
+// headcountReport totals the RSVPs of each event, for every origin and for
+// ALL_ORIGINS. Families aren't counted for events they aren't invited to.
+func headcountReport(invitedFamilies []InvitedFamily) []HeadcountRow {
+	var report []HeadcountRow
+	for _, event := range AllEvents {
+		total := HeadcountRow{Event: event.Name, Origin: ALL_ORIGINS}
+		byOrigin := make(map[string]*HeadcountRow)
+		var origins []string
+		for _, invitedFamily := range invitedFamilies {
+			if invitedFamily.invitedTo(event) <= 0 {
+				continue
+			}
+			row, ok := byOrigin[invitedFamily.Origin]
+			if !ok {
+				row = &HeadcountRow{Event: event.Name, Origin: invitedFamily.Origin}
+				byOrigin[invitedFamily.Origin] = row
+				origins = append(origins, invitedFamily.Origin)
+			}
+			row.add(invitedFamily, event)
+			total.add(invitedFamily, event)
+		}
+
+		sort.Strings(origins)
+		for _, origin := range origins {
+			report = append(report, *byOrigin[origin])
+		}
+		report = append(report, total)
+	}
+	return report
+}
+
+func writeHeadcountReport(writer io.Writer, report []HeadcountRow, format string) error {
+	switch format {
+	case REPORT_TABLE:
+		table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, strings.Join(headcountColumns, "\t"))
+		for _, row := range report {
+			fmt.Fprintln(table, strings.Join(row.record(), "\t"))
+		}
+		return table.Flush()
+	case REPORT_CSV:
+		csvWriter := csv.NewWriter(writer)
+		csvWriter.Write(headcountColumns)
+		for _, row := range report {
+			csvWriter.Write(row.record())
+		}
+		csvWriter.Flush()
+		return csvWriter.Error()
+	case REPORT_JSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return fmt.Errorf("unknown report format %q (table, csv or json)", format)
+}
+
+func headcountReportCommand(args []string) error {
+	flags := flag.NewFlagSet("headcount-report", flag.ExitOnError)
+	format := flags.String("format", REPORT_TABLE, "table, csv or json")
+	outputFile := flags.String("out", "", "file to write the report to (default stdout)")
+	flags.Parse(args)
+
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		return err
+	}
+
+	var writer io.Writer = os.Stdout
+	if *outputFile != "" {
+		file, err := os.Create(*outputFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+	return writeHeadcountReport(writer, headcountReport(invitedFamilies), *format)
+}
+
+// ReportHandler answers GET /report with the headcount report, as a table
+// unless the format query parameter says otherwise (i.e. /report?format=csv)
+func ReportHandler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod != "GET" {
+		return events.APIGatewayProxyResponse{StatusCode: 405}, nil
+	}
+	format := request.QueryStringParameters["format"]
+	if format == "" {
+		format = REPORT_TABLE
+	}
+	contentType, ok := map[string]string{REPORT_TABLE: "text/plain", REPORT_CSV: "text/csv", REPORT_JSON: "application/json"}[format]
+	if !ok {
+		return events.APIGatewayProxyResponse{StatusCode: 400, Body: "format has to be table, csv or json"}, nil
+	}
+
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		log.Printf("Unable to retrieve data from sheet: %v", err)
+		return events.APIGatewayProxyResponse{StatusCode: 500}, nil
+	}
+	var body bytes.Buffer
+	if err := writeHeadcountReport(&body, headcountReport(invitedFamilies), format); err != nil {
+		log.Printf("Unable to write the headcount report: %v", err)
+		return events.APIGatewayProxyResponse{StatusCode: 500}, nil
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    map[string]string{"Content-Type": contentType + "; charset=utf-8"},
+		Body:       body.String(),
+	}, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHeadcountReport(t *testing.T) {
+	families := []InvitedFamily{
+		{Origin: "Mumbai", InviteCode: 1, VidhiInvited: 4, VidhiRsvpd: 3, WeddingInvited: 4, WeddingRsvpd: NULL_INVITEES},
+		{Origin: "Mumbai", InviteCode: 2, WeddingInvited: MAX_INVITEES, WeddingRsvpd: 6},
+		{Origin: "Chicago", InviteCode: 3, VidhiInvited: 2, VidhiRsvpd: 0, WeddingInvited: 2, WeddingRsvpd: 2},
+	}
+
+	report := headcountReport(families)
+	expected := []HeadcountRow{
+		{Event: "VIDHI", Origin: "Chicago", Families: 1, Invited: 2, Declined: 1, ResponseRate: 1},
+		{Event: "VIDHI", Origin: "Mumbai", Families: 1, Invited: 4, Rsvpd: 3, Adults: 3, ResponseRate: 1},
+		{Event: "VIDHI", Origin: ALL_ORIGINS, Families: 2, Invited: 6, Rsvpd: 3, Adults: 3, Declined: 1, ResponseRate: 1},
+		{Event: "GARBA", Origin: ALL_ORIGINS},
+		{Event: "WEDDING", Origin: "Chicago", Families: 1, Invited: 2, Rsvpd: 2, Adults: 2, ResponseRate: 1},
+		{Event: "WEDDING", Origin: "Mumbai", Families: 2, Invited: 4, FullFamilyInvites: 1, Rsvpd: 6, Adults: 6, Outstanding: 1, ResponseRate: 0.5},
+		{Event: "WEDDING", Origin: ALL_ORIGINS, Families: 3, Invited: 6, FullFamilyInvites: 1, Rsvpd: 8, Adults: 8, Outstanding: 1, ResponseRate: 2.0 / 3},
+	}
+	if len(report) != len(expected) {
+		t.Fatalf("Expected %d rows, got: +%v", len(expected), report)
+	}
+	for i := range expected {
+		if report[i] != expected[i] {
+			t.Errorf("Expected row %d to be +%v, got +%v", i, expected[i], report[i])
+		}
+	}
+}
+
+func TestWriteHeadcountReport(t *testing.T) {
+	report := []HeadcountRow{{Event: "VIDHI", Origin: ALL_ORIGINS, Families: 2, Invited: 6, Rsvpd: 3, Adults: 3, Outstanding: 1, ResponseRate: 0.5}}
+
+	var csv bytes.Buffer
+	if err := writeHeadcountReport(&csv, report, REPORT_CSV); err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	expected := "Event,Origin,Families,Invited,Full Family Invites,RSVP'd,Adults,Children,Declined,Outstanding,Response Rate\nVIDHI,ALL ORIGINS,2,6,0,3,3,0,0,1,50%\n"
+	if csv.String() != expected {
+		t.Errorf("Expected csv: %q, got: %q", expected, csv.String())
+	}
+
+	var json bytes.Buffer
+	if err := writeHeadcountReport(&json, report, REPORT_JSON); err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if !strings.Contains(json.String(), `"responseRate": 0.5`) {
+		t.Errorf("Unexpected json: %s", json.String())
+	}
+
+	if err := writeHeadcountReport(&json, report, "xml"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/ptypes/struct"
+	dialogflow "google.golang.org/genproto/googleapis/cloud/dialogflow/v2"
+)
+
+// Keys used for the raw platform payloads in the webhook response
+const (
+	TWILIO_PAYLOAD   = "twilio"
+	TELEGRAM_PAYLOAD = "telegram"
+	FACEBOOK_PAYLOAD = "facebook"
+)
+
+// Platforms that can render quick replies & cards. Everything else (i.e. Twilio
+// SMS) only gets the plain-text messages of the default platform.
+var richPlatforms = []dialogflow.Intent_Message_Platform{
+	dialogflow.Intent_Message_FACEBOOK,
+	dialogflow.Intent_Message_TELEGRAM,
+}
+
+type Card struct {
+	Title    string
+	Subtitle string
+	ImageUri string
+	Buttons  []CardButton
+}
+
+type CardButton struct {
+	Text     string
+	Postback string
+}
+
+// DialogflowResponse builds the webhook response for a fulfillment. Messages
+// are rendered natively for the rich platforms, and every message also has a
+// plain-text fallback which is sent to all other platforms.
+//
+// https://dialogflow.com/docs/fulfillment/how-it-works#response
+type DialogflowResponse struct {
+	messages           []responseMessage
+	payload            map[string]*structpb.Value
+	outputContexts     []*dialogflow.Context
+	followupIntentName string
+}
+
+// responseMessage holds one rich message along with its plain-text fallback
+type responseMessage struct {
+	fallback string
+	rich     func() *dialogflow.Intent_Message
+}
+
+func NewDialogflowResponse() *DialogflowResponse {
+	return &DialogflowResponse{payload: make(map[string]*structpb.Value)}
+}
+
+// Text adds a plain-text message. Empty messages are skipped.
+func (r *DialogflowResponse) Text(message string) *DialogflowResponse {
+	if message == "" {
+		return r
+	}
+	r.messages = append(r.messages, responseMessage{
+		fallback: message,
+		rich: func() *dialogflow.Intent_Message {
+			return &dialogflow.Intent_Message{Message: &dialogflow.Intent_Message_Text_{Text: &dialogflow.Intent_Message_Text{Text: []string{message}}}}
+		},
+	})
+	return r
+}
+
+// QuickReplies adds a question with reply buttons, e.g. QuickReplies("Would you like to RSVP now?", "Yes", "Not now")
+func (r *DialogflowResponse) QuickReplies(title string, replies ...string) *DialogflowResponse {
+	r.messages = append(r.messages, responseMessage{
+		fallback: fmt.Sprintf("%s\n(%s)", title, strings.Join(replies, " / ")),
+		rich: func() *dialogflow.Intent_Message {
+			return &dialogflow.Intent_Message{Message: &dialogflow.Intent_Message_QuickReplies_{QuickReplies: &dialogflow.Intent_Message_QuickReplies{Title: title, QuickReplies: replies}}}
+		},
+	})
+	return r
+}
+
+// Card adds a card, i.e. an event summary. The fallback lists the title,
+// subtitle and button text on separate lines.
+func (r *DialogflowResponse) Card(card Card) *DialogflowResponse {
+	fallback := card.Title
+	if card.Subtitle != "" {
+		fallback += "\n" + card.Subtitle
+	}
+	var buttons []*dialogflow.Intent_Message_Card_Button
+	for _, button := range card.Buttons {
+		fallback += "\n" + button.Text
+		buttons = append(buttons, &dialogflow.Intent_Message_Card_Button{Text: button.Text, Postback: button.Postback})
+	}
+
+	r.messages = append(r.messages, responseMessage{
+		fallback: fallback,
+		rich: func() *dialogflow.Intent_Message {
+			return &dialogflow.Intent_Message{Message: &dialogflow.Intent_Message_Card_{Card: &dialogflow.Intent_Message_Card{
+				Title:    card.Title,
+				Subtitle: card.Subtitle,
+				ImageUri: card.ImageUri,
+				Buttons:  buttons,
+			}}}
+		},
+	})
+	return r
+}
+
+// Payload sets the raw payload for the given platform (i.e. TWILIO_PAYLOAD) and
+// adds the fallback as a plain-text message for everyone else
+func (r *DialogflowResponse) Payload(platform string, payload map[string]interface{}, fallback string) *DialogflowResponse {
+	value, err := toStructValue(payload)
+	if err != nil {
+		log.Fatalf("Unable to convert the %s payload: %v", platform, err)
+	}
+	r.payload[platform] = value
+	return r.Text(fallback)
+}
+
+func (r *DialogflowResponse) Contexts(contexts ...*dialogflow.Context) *DialogflowResponse {
+	r.outputContexts = append(r.outputContexts, contexts...)
+	return r
+}
+
+// FollowupEvent triggers the intent with the given event. Empty names are skipped.
+func (r *DialogflowResponse) FollowupEvent(followupIntentName string) *DialogflowResponse {
+	r.followupIntentName = followupIntentName
+	return r
+}
+
+// Fallback returns the plain-text version of the response
+func (r *DialogflowResponse) Fallback() string {
+	var fallbacks []string
+	for _, message := range r.messages {
+		fallbacks = append(fallbacks, message.fallback)
+	}
+	return strings.Join(fallbacks, "\n")
+}
+
+func (r *DialogflowResponse) webhookResponse() dialogflow.WebhookResponse {
+	responseBody := dialogflow.WebhookResponse{}
+
+	if len(r.messages) > 0 {
+		responseBody.FulfillmentText = r.Fallback()
+		for _, platform := range richPlatforms {
+			for _, message := range r.messages {
+				richMessage := message.rich()
+				richMessage.Platform = platform
+				responseBody.FulfillmentMessages = append(responseBody.FulfillmentMessages, richMessage)
+			}
+		}
+		for _, message := range r.messages {
+			responseBody.FulfillmentMessages = append(responseBody.FulfillmentMessages, &dialogflow.Intent_Message{
+				Message: &dialogflow.Intent_Message_Text_{Text: &dialogflow.Intent_Message_Text{Text: []string{message.fallback}}},
+			})
+		}
+	}
+
+	if len(r.payload) > 0 {
+		responseBody.Payload = &structpb.Struct{Fields: r.payload}
+	}
+
+	if len(r.outputContexts) > 0 {
+		responseBody.OutputContexts = r.outputContexts
+	}
+
+	if r.followupIntentName != "" {
+		followupIntent := dialogflow.EventInput{
+			LanguageCode: "en",
+			Name:         r.followupIntentName,
+		}
+		log.Printf("Followup Intent: %+v", followupIntent)
+		responseBody.FollowupEventInput = &followupIntent
+	}
+
+	return responseBody
+}
+
+// String returns the JSON body sent back to Dialogflow
+func (r *DialogflowResponse) String() string {
+	responseBody := r.webhookResponse()
+	log.Printf("\nResponse body: %+v", responseBody)
+
+	var buf bytes.Buffer
+
+	// jsonpb (unlike encoding/json) knows how to write the oneof messages and struct values
+	marshaler := jsonpb.Marshaler{}
+	body, err := marshaler.MarshalToString(&responseBody)
+	if err != nil {
+		log.Fatal("Unable to parse error response - error: ", err)
+	}
+	json.HTMLEscape(&buf, []byte(body))
+
+	return buf.String()
+}
+
+// toStructValue converts plain go values (i.e. decoded JSON) into a protobuf struct value
+func toStructValue(v interface{}) (*structpb.Value, error) {
+	switch value := v.(type) {
+	case nil:
+		return &structpb.Value{Kind: &structpb.Value_NullValue{}}, nil
+	case string:
+		return &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: value}}, nil
+	case bool:
+		return &structpb.Value{Kind: &structpb.Value_BoolValue{BoolValue: value}}, nil
+	case int:
+		return &structpb.Value{Kind: &structpb.Value_NumberValue{NumberValue: float64(value)}}, nil
+	case float64:
+		return &structpb.Value{Kind: &structpb.Value_NumberValue{NumberValue: value}}, nil
+	case []string:
+		var values []interface{}
+		for _, s := range value {
+			values = append(values, s)
+		}
+		return toStructValue(values)
+	case []interface{}:
+		listValue := &structpb.ListValue{}
+		for _, item := range value {
+			itemValue, err := toStructValue(item)
+			if err != nil {
+				return nil, err
+			}
+			listValue.Values = append(listValue.Values, itemValue)
+		}
+		return &structpb.Value{Kind: &structpb.Value_ListValue{ListValue: listValue}}, nil
+	case map[string]interface{}:
+		structValue := &structpb.Struct{Fields: make(map[string]*structpb.Value)}
+		for key, item := range value {
+			itemValue, err := toStructValue(item)
+			if err != nil {
+				return nil, err
+			}
+			structValue.Fields[key] = itemValue
+		}
+		return &structpb.Value{Kind: &structpb.Value_StructValue{StructValue: structValue}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported payload value type %T", v)
+	}
+}
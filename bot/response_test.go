@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	dialogflow "google.golang.org/genproto/googleapis/cloud/dialogflow/v2"
+)
+
+func TestDialogflowResponseFallback(t *testing.T) {
+	response := NewDialogflowResponse().
+		Text("You must be The Patel Family.").
+		QuickReplies(RSVP_NOW_QUESTION, "Yes", "Not now").
+		Card(Card{Title: RSVP_SUMMARY_TITLE, Subtitle: "WEDDING: 4", Buttons: []CardButton{{Text: "Update RSVP"}}})
+
+	expected := "You must be The Patel Family.\nWould you like to RSVP now?\n(Yes / Not now)\nWe've got you down for:\nWEDDING: 4\nUpdate RSVP"
+	if fallback := response.Fallback(); fallback != expected {
+		t.Errorf("Expected fallback: %q, got: %q", expected, fallback)
+	}
+}
+
+func TestDialogflowResponseRichMessages(t *testing.T) {
+	response := NewDialogflowResponse().
+		Text("You must be The Patel Family.").
+		QuickReplies(RSVP_NOW_QUESTION, "Yes", "Not now")
+
+	webhookResponse := response.webhookResponse()
+	if len(webhookResponse.FulfillmentMessages) != 2*(len(richPlatforms)+1) {
+		t.Fatalf("Expected 2 messages for each rich platform and the default platform, got: +%v", webhookResponse.FulfillmentMessages)
+	}
+
+	var quickReplies, defaultMessages int
+	for _, message := range webhookResponse.FulfillmentMessages {
+		if message.GetQuickReplies() != nil {
+			quickReplies++
+		}
+		if message.Platform == dialogflow.Intent_Message_PLATFORM_UNSPECIFIED {
+			defaultMessages++
+			if message.GetText() == nil {
+				t.Errorf("Expected only plain-text messages for the default platform, got: +%v", message)
+			}
+		}
+	}
+	if quickReplies != len(richPlatforms) || defaultMessages != 2 {
+		t.Errorf("Expected %d quick replies and 2 default messages, got %d and %d", len(richPlatforms), quickReplies, defaultMessages)
+	}
+}
+
+func TestDialogflowResponsePayload(t *testing.T) {
+	response := NewDialogflowResponse().Payload(TELEGRAM_PAYLOAD, map[string]interface{}{
+		"text":         "Would you like to RSVP now?",
+		"reply_markup": map[string]interface{}{"keyboard": []interface{}{[]string{"Yes", "Not now"}}},
+	}, "Would you like to RSVP now? (Yes / Not now)")
+
+	webhookResponse := response.webhookResponse()
+	payload := webhookResponse.Payload.GetFields()[TELEGRAM_PAYLOAD].GetStructValue()
+	if payload.GetFields()["text"].GetStringValue() != "Would you like to RSVP now?" {
+		t.Errorf("Expected the telegram payload text to be set, got: +%v", payload)
+	}
+	if webhookResponse.FulfillmentText != "Would you like to RSVP now? (Yes / Not now)" {
+		t.Errorf("Expected the fallback as the fulfillment text, got: %q", webhookResponse.FulfillmentText)
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+	dialogflow "google.golang.org/genproto/googleapis/cloud/dialogflow/v2"
+)
+
+const (
+	SEAT_REQUEST = "SEAT_REQUEST"
+
+	SEAT_REQUEST_PENDING  = "PENDING"
+	SEAT_REQUEST_APPROVED = "APPROVED"
+	SEAT_REQUEST_DENIED   = "DENIED"
+
+	MAX_SEAT_REQUEST = 5 // more seats than this are for the guest to sort out with the hosts
+)
+
+var smsSeatRequest = regexp.MustCompile(`(?i)\bplus[ -]?(one|1)s?\b|\b(extra|more|additional|another) (seats?|guests?|people|person)\b`)
+var smsSeatCount = regexp.MustCompile(`(?i)\b(\d+|[a-z]+) (?:(?:extra|more|additional) )?(?:seats?|guests?|people|persons?|plus[ -]?(?:one|1)s)\b`)
+var smsPlusSeats = regexp.MustCompile(`(?i)\bplus[ -]?(\d+|[a-z]+)\b`)
+var smsSeatDecision = regexp.MustCompile(`(?i)^\s*(approve|deny)\s+#?(\d+)\s*$`)
+
+// SeatRequest is a family asking the hosts for more seats at an event than
+// they're invited with. Reason is the guest's whole message.
+type SeatRequest struct {
+	ID          int    `json:"id"`
+	InviteCode  int    `json:"inviteCode"`
+	Event       string `json:"event"`
+	Seats       int    `json:"seats"`
+	Reason      string `json:"reason"`
+	PhoneNumber string `json:"phoneNumber,omitempty"`
+	Status      string `json:"status"`
+	RequestedAt string `json:"requestedAt"`
+	DecidedAt   string `json:"decidedAt,omitempty"`
+	rowNumber   int
+}
+
+// parseSeatRequest finds the event (by name, or the family's only event) &
+// how many more seats in the guest's message. Only a number next to the seats
+// (i.e. "2 extra seats", "plus two") counts, so dates & times are left alone,
+// and it's 1 otherwise (i.e. for "plus one").
+func parseSeatRequest(text string, invitedFamily InvitedFamily) (Event, int, bool) {
+	lowered := strings.ToLower(text)
+	var invitedEvents []Event
+	var mentioned []Event
+	for _, event := range AllEvents {
+		if invitedFamily.invitedTo(event) <= 0 {
+			continue
+		}
+		invitedEvents = append(invitedEvents, event)
+		for _, name := range append(strings.Split(event.DisplayName, "-"), event.Name) {
+			if regexp.MustCompile(`\b` + regexp.QuoteMeta(strings.ToLower(name)) + `\b`).MatchString(lowered) {
+				mentioned = append(mentioned, event)
+				break
+			}
+		}
+	}
+	var event Event
+	switch {
+	case len(mentioned) == 1:
+		event = mentioned[0]
+	case len(mentioned) == 0 && len(invitedEvents) == 1:
+		event = invitedEvents[0]
+	default:
+		return Event{}, 0, false
+	}
+
+	seats := 1
+	if number, ok := seatCount(smsSeatCount, lowered); ok {
+		seats = number
+	} else if number, ok := seatCount(smsPlusSeats, lowered); ok {
+		seats = number
+	}
+	return event, seats, seats > 0
+}
+
+// seatCount is the first number (in digits or words) the pattern matches
+func seatCount(pattern *regexp.Regexp, text string) (int, bool) {
+	for _, match := range pattern.FindAllStringSubmatch(text, -1) {
+		if number, err := strconv.Atoi(match[1]); err == nil {
+			return number, true
+		}
+		if number, ok := smsNumberWords[match[1]]; ok {
+			return number, true
+		}
+	}
+	return 0, false
+}
+
+// parseSeatDecision reads a host's "APPROVE 7" or "DENY 7" SMS reply
+func parseSeatDecision(body string) (int, bool, bool) {
+	match := smsSeatDecision.FindStringSubmatch(body)
+	if match == nil {
+		return 0, false, false
+	}
+	id, err := strconv.Atoi(match[2])
+	return id, strings.EqualFold(match[1], "approve"), err == nil
+}
+
+func isHostPhoneNumber(phoneNumber string) bool {
+	for _, hostPhoneNumber := range hostPhoneNumbers() {
+		if hostPhoneNumber == phoneNumber {
+			return true
+		}
+	}
+	return false
+}
+
+// approvedInvited is the family's invited count for the event once the
+// request is approved; everyone ("ALL") stays everyone
+func approvedInvited(invitedFamily InvitedFamily, event Event, seats int) int {
+	invited := invitedFamily.invitedTo(event)
+	if invited == MAX_INVITEES {
+		return invited
+	}
+	return invited + seats
+}
+
+func readSeatRequests() ([]SeatRequest, error) {
+	rows, err := getGoogleSheetsData(SEAT_REQUEST, "A2:I")
+	if err != nil {
+		return nil, err
+	}
+	var requests []SeatRequest
+	for i, row := range rows {
+		if len(row) < 7 {
+			continue
+		}
+		id, idErr := strconv.Atoi(fmt.Sprint(row[0]))
+		inviteCode, codeErr := strconv.Atoi(fmt.Sprint(row[1]))
+		seats, seatsErr := strconv.Atoi(fmt.Sprint(row[3]))
+		if idErr != nil || codeErr != nil || seatsErr != nil {
+			log.Printf("Skipping seat request (%d) as its id, invite code or seats aren't numbers: %v", i+2, row)
+			continue
+		}
+		request := SeatRequest{ID: id, InviteCode: inviteCode, Event: fmt.Sprint(row[2]), Seats: seats, Reason: fmt.Sprint(row[4]), PhoneNumber: fmt.Sprint(row[5]), Status: strings.ToUpper(fmt.Sprint(row[6])), rowNumber: i + 2}
+		if len(row) > 7 {
+			request.RequestedAt = fmt.Sprint(row[7])
+		}
+		if len(row) > 8 {
+			request.DecidedAt = fmt.Sprint(row[8])
+		}
+		requests = append(requests, request)
+	}
+	return requests, nil
+}
+
+// requestSeats adds the family's request to the hosts' queue & texts the
+// hosts, unless they already have a request for the event waiting
+func requestSeats(invitedFamily InvitedFamily, event Event, seats int, reason string, phoneNumber string) string {
+	requests, err := readSeatRequests()
+	if err != nil {
+		log.Fatalf("Unable to read the seat requests for invite code %d: %v", invitedFamily.InviteCode, err)
+	}
+	request := SeatRequest{ID: 1, InviteCode: invitedFamily.InviteCode, Event: event.Name, Seats: seats, Reason: reason, PhoneNumber: phoneNumber, Status: SEAT_REQUEST_PENDING}
+	for _, existing := range requests {
+		if existing.InviteCode == request.InviteCode && existing.Event == request.Event && existing.Status == SEAT_REQUEST_PENDING {
+			return seatRequestPendingMsg(event)
+		}
+		if existing.ID >= request.ID {
+			request.ID = existing.ID + 1
+		}
+	}
+	row := []interface{}{request.ID, request.InviteCode, request.Event, request.Seats, request.Reason, request.PhoneNumber, request.Status, time.Now()}
+	if _, err := appendGoogleSheetsData(SEAT_REQUEST, [][]interface{}{row}); err != nil {
+		log.Fatalf("Unable to save the seat request of invite code %d: %v", invitedFamily.InviteCode, err)
+	}
+
+	provider, err := smsProviderFromEnv()
+	if err != nil {
+		log.Printf("Unable to let the hosts know about seat request %d: %v", request.ID, err)
+	} else {
+		notifyHosts(provider, hostPhoneNumbers(), hostSeatRequestMsg(invitedFamily, request))
+	}
+	return seatRequestedMsg(event, seats)
+}
+
+// seatRequestMsg answers the guest's message asking for more seats
+func seatRequestMsg(inviteCode int, text string, phoneNumber string) string {
+	invitedFamily := findInvitedFamily(inviteCode)
+	event, seats, ok := parseSeatRequest(text, invitedFamily)
+	if !ok {
+		return SEAT_REQUEST_EVENT_MSG
+	}
+	if seats > MAX_SEAT_REQUEST {
+		return seatRequestTooManyMsg()
+	}
+	return requestSeats(invitedFamily, event, seats, strings.TrimSpace(text), phoneNumber)
+}
+
+// SeatRequestFulfillment puts the Dialogflow guest's request for more seats
+// in the hosts' queue
+func SeatRequestFulfillment(response *DialogflowResponse, contexts []*dialogflow.Context, queryText string) {
+	inviteCode := getInviteCodeFromContext(contexts)
+	log.Printf("\nIntent: %s - Starting fulfillment for invite code: %d", intent, inviteCode)
+	if inviteCode == -1 {
+		response.Text(SEAT_REQUEST_INVITE_CODE_MSG)
+		return
+	}
+	response.Text(seatRequestMsg(inviteCode, queryText, getPhoneNumberFromContext(contexts)))
+}
+
+// decideSeatRequest approves (raising the family's invited count) or denies
+// the pending request, and texts the family the decision
+func decideSeatRequest(id int, approve bool) (SeatRequest, error) {
+	requests, err := readSeatRequests()
+	if err != nil {
+		return SeatRequest{}, err
+	}
+	var request SeatRequest
+	for _, existing := range requests {
+		if existing.ID == id {
+			request = existing
+		}
+	}
+	if request.ID == 0 {
+		return request, adminError{404, fmt.Sprintf("no seat request %d", id)}
+	}
+	if request.Status != SEAT_REQUEST_PENDING {
+		return request, adminError{409, fmt.Sprintf("seat request %d was already %s", id, strings.ToLower(request.Status))}
+	}
+	event, ok := eventByName(request.Event)
+	if !ok {
+		return request, adminError{400, fmt.Sprintf("seat request %d is for an unknown event %q", id, request.Event)}
+	}
+	invitedFamily, found, err := guestStore.FindFamily(request.InviteCode)
+	if err != nil {
+		return request, err
+	}
+	if !found {
+		return request, adminError{404, fmt.Sprintf("no family with invite code %d", request.InviteCode)}
+	}
+
+	request.Status = SEAT_REQUEST_DENIED
+	if approve {
+		request.Status = SEAT_REQUEST_APPROVED
+		invitedFamily.setInvited(event, approvedInvited(invitedFamily, event, request.Seats))
+		if err := guestStore.UpdateFamily(invitedFamily); err != nil {
+			return request, err
+		}
+	}
+	request.DecidedAt = time.Now().Format(time.RFC3339)
+	rowNumber := strconv.Itoa(request.rowNumber)
+	if _, err := setGoogleSheetsData([]*sheets.ValueRange{
+		{Range: SEAT_REQUEST + "!G" + rowNumber, Values: [][]interface{}{{request.Status}}},
+		{Range: SEAT_REQUEST + "!I" + rowNumber, Values: [][]interface{}{{request.DecidedAt}}},
+	}); err != nil {
+		return request, err
+	}
+	log.Printf("Seat request %d of invite code %d %s", id, request.InviteCode, strings.ToLower(request.Status))
+
+	phoneNumber := request.PhoneNumber
+	if phoneNumber == "" {
+		directory, err := getPhoneDirectory()
+		if err != nil {
+			log.Printf("Unable to read PHONE_DIRECTORY for invite code %d: %v", request.InviteCode, err)
+		}
+		for _, entry := range directory {
+			if entry.InviteCode == request.InviteCode && phoneNumber == "" {
+				phoneNumber = entry.PhoneNumber
+			}
+		}
+	}
+	if phoneNumber == "" {
+		log.Printf("No phone number to tell invite code %d about seat request %d", request.InviteCode, id)
+		return request, nil
+	}
+	provider, err := smsProviderFromEnv()
+	if err == nil {
+		_, err = provider.SendSms(phoneNumber, seatDecisionMsg(invitedFamily, event, request))
+	}
+	if err != nil {
+		log.Printf("Unable to tell invite code %d about seat request %d: %v", request.InviteCode, id, err)
+	}
+	return request, nil
+}
+
+// smsSeatDecisionMsg answers a host's "APPROVE 7" or "DENY 7" reply
+func smsSeatDecisionMsg(id int, approve bool) string {
+	request, err := decideSeatRequest(id, approve)
+	if err != nil {
+		if _, ok := err.(adminError); !ok {
+			log.Printf("Unable to decide seat request %d: %v", id, err)
+		}
+		return "Sorry, " + err.Error() + "."
+	}
+	return fmt.Sprintf("Seat request %d of invite code %d %s, we've let them know.", id, request.InviteCode, strings.ToLower(request.Status))
+}
+
+// adminSeatRequests serves /admin/seat-requests
+func adminSeatRequests(method string, path []string, status string) (interface{}, error) {
+	if len(path) == 1 {
+		if method != "GET" {
+			return nil, adminError{405, "method not allowed"}
+		}
+		requests, err := readSeatRequests()
+		if err != nil {
+			return nil, err
+		}
+		matching := []SeatRequest{}
+		for _, request := range requests {
+			if status == "" || strings.EqualFold(request.Status, status) {
+				matching = append(matching, request)
+			}
+		}
+		sort.Slice(matching, func(i, j int) bool { return matching[i].ID < matching[j].ID })
+		return matching, nil
+	}
+	id, err := strconv.Atoi(path[1])
+	if err != nil || len(path) != 3 {
+		return nil, adminError{404, "not found"}
+	}
+	switch method + " " + path[2] {
+	case "POST approve":
+		return decideSeatRequest(id, true)
+	case "POST deny":
+		return decideSeatRequest(id, false)
+	}
+	return nil, adminError{404, "not found"}
+}
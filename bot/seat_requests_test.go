@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseSeatRequest(t *testing.T) {
+	invitedFamily := InvitedFamily{VidhiInvited: 0, GarbaInvited: 4, WeddingInvited: 4}
+	tests := map[string]struct {
+		event Event
+		seats int
+	}{
+		"Can I bring a plus one to the wedding?":        {Wedding, 1},
+		"2 extra seats at the reception for my cousins": {Garba, 2},
+		"three more people for the GARBA please":        {Garba, 3},
+		"plus one for the wedding on the 12th":          {Wedding, 1},
+		"Plus two at the 7:30 garba on June 14, 2019":   {Garba, 2},
+		"My 2 kids need seats at the wedding at 6pm":    {Wedding, 1},
+		"4 more guests for the wedding on the 12th":     {Wedding, 4},
+		"30 extra seats for the wedding":                {Wedding, 30},
+	}
+	for text, expected := range tests {
+		event, seats, ok := parseSeatRequest(text, invitedFamily)
+		if !ok || event != expected.event || seats != expected.seats {
+			t.Errorf("Expected %q to be %d for the %s, got: %d %s %v", text, expected.seats, expected.event.Name, seats, event.Name, ok)
+		}
+	}
+
+	if _, _, ok := parseSeatRequest("plus one please", invitedFamily); ok {
+		t.Errorf("Expected a family invited to 2 events to have to say which one")
+	}
+	if _, _, ok := parseSeatRequest("plus one for the vidhi", invitedFamily); ok {
+		t.Errorf("Expected no requests for an event the family isn't invited to")
+	}
+	if event, seats, ok := parseSeatRequest("plus one please", InvitedFamily{WeddingInvited: 2}); !ok || event != Wedding || seats != 1 {
+		t.Errorf("Expected the family's only event, got: %s %d %v", event.Name, seats, ok)
+	}
+}
+
+func TestSeatRequestTooMany(t *testing.T) {
+	defer useMemoryStore(InvitedFamily{InviteCode: 7, WeddingInvited: 4})()
+	if message := seatRequestMsg(7, "30 extra seats for the wedding", ""); message != seatRequestTooManyMsg() {
+		t.Errorf("Expected a request for 30 seats to be turned down, got: %s", message)
+	}
+}
+
+func TestParseSeatDecision(t *testing.T) {
+	if id, approve, ok := parseSeatDecision(" Approve #12 "); !ok || !approve || id != 12 {
+		t.Errorf("Expected approve 12, got: %d %v %v", id, approve, ok)
+	}
+	if id, approve, ok := parseSeatDecision("DENY 3"); !ok || approve || id != 3 {
+		t.Errorf("Expected deny 3, got: %d %v %v", id, approve, ok)
+	}
+	if _, _, ok := parseSeatDecision("deny everything"); ok {
+		t.Errorf("Expected a decision to need a request id")
+	}
+}
+
+func TestApprovedInvited(t *testing.T) {
+	invitedFamily := InvitedFamily{WeddingInvited: 3, GarbaInvited: MAX_INVITEES}
+	if invited := approvedInvited(invitedFamily, Wedding, 2); invited != 5 {
+		t.Errorf("Expected 5 invited, got: %d", invited)
+	}
+	if invited := approvedInvited(invitedFamily, Garba, 2); invited != MAX_INVITEES {
+		t.Errorf("Expected everyone to stay invited, got: %d", invited)
+	}
+}
+
+func TestUnverifiedSeatDecision(t *testing.T) {
+	os.Setenv("HOST_PHONE_NUMBERS", "+15555550199")
+	defer os.Unsetenv("HOST_PHONE_NUMBERS")
+	smsSenderVerified = false
+	conversation := Conversation{PhoneNumber: "+15555550199", Rsvps: make(map[Event]int)}
+	if message := smsFulfillment(&conversation, parseSmsMessage("APPROVE 7"), "APPROVE 7"); message != SEAT_DECISION_UNVERIFIED_MSG {
+		t.Errorf("Expected a host's decision to be refused without the signature check, got: %s", message)
+	}
+}
@@ -0,0 +1,639 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	dialogflow "google.golang.org/genproto/googleapis/cloud/dialogflow/v2"
+)
+
+const (
+	SEATING_TABLE      = "SEATING_TABLE"
+	SEATING_RULE       = "SEATING_RULE"
+	SEATING_ASSIGNMENT = "SEATING_ASSIGNMENT"
+)
+
+// The kinds of SEATING_RULE
+const (
+	SEATING_TOGETHER   = "TOGETHER"
+	SEATING_APART      = "APART"
+	SEATING_NEAR_STAGE = "NEAR_STAGE"
+)
+
+// SeatingTable is a table at an event
+type SeatingTable struct {
+	Event     Event
+	Name      string
+	Seats     int
+	NearStage bool
+}
+
+// SeatingRule keeps the families together at one table, apart at different
+// tables or near the stage, at an event (all of them when EventName is empty)
+type SeatingRule struct {
+	EventName   string
+	Kind        string
+	InviteCodes []int
+}
+
+// SeatAssignment is a family's guests at a table (a family that doesn't fit
+// at one table is split over several)
+type SeatAssignment struct {
+	Event      Event
+	Table      string
+	InviteCode int
+	Seats      int
+	Names      []string
+}
+
+func (rule SeatingRule) isFor(event Event) bool {
+	return rule.EventName == "" || strings.EqualFold(rule.EventName, event.Name)
+}
+
+// seatingGroup are the families that sit together
+type seatingGroup struct {
+	families  []InvitedFamily
+	guests    int
+	nearStage bool
+}
+
+// proposeSeating seats the families coming to the event that aren't in the
+// existing assignments yet. The families a TOGETHER rule joins sit at one
+// table, and every family sits together, when there's a table with room for
+// them; the families of an APART rule never share a table, and NEAR_STAGE
+// families get the tables near the stage. Groups are seated near the stage
+// first, then biggest first, each at the table they leave the fewest empty
+// seats at. What couldn't be done is returned as problems for the hosts.
+func proposeSeating(event Event, tables []SeatingTable, rules []SeatingRule, existing []SeatAssignment, invitedFamilies []InvitedFamily, attendees map[int]map[string][]string) ([]SeatAssignment, []string) {
+	var eventTables []SeatingTable
+	for _, table := range tables {
+		if table.Event == event {
+			eventTables = append(eventTables, table)
+		}
+	}
+	seatsLeft := make([]int, len(eventTables))
+	occupants := make([]map[int]bool, len(eventTables))
+	tableIndex := make(map[string]int)
+	for i, table := range eventTables {
+		seatsLeft[i] = table.Seats
+		occupants[i] = make(map[int]bool)
+		tableIndex[strings.ToLower(table.Name)] = i
+	}
+	seated := make(map[int]bool)
+	for _, assignment := range existing {
+		if assignment.Event != event {
+			continue
+		}
+		seated[assignment.InviteCode] = true
+		if i, ok := tableIndex[strings.ToLower(assignment.Table)]; ok {
+			seatsLeft[i] -= assignment.Seats
+			occupants[i][assignment.InviteCode] = true
+		}
+	}
+
+	// Join the families of each TOGETHER rule into groups
+	group := make(map[int]int) // invite code to its group's first invite code
+	find := func(inviteCode int) int {
+		for group[inviteCode] != 0 && group[inviteCode] != inviteCode {
+			inviteCode = group[inviteCode]
+		}
+		return inviteCode
+	}
+	apart := make(map[int]map[int]bool)
+	nearStage := make(map[int]bool)
+	for _, rule := range rules {
+		if !rule.isFor(event) {
+			continue
+		}
+		for _, inviteCode := range rule.InviteCodes {
+			switch rule.Kind {
+			case SEATING_TOGETHER:
+				group[find(inviteCode)] = find(rule.InviteCodes[0])
+			case SEATING_APART:
+				for _, other := range rule.InviteCodes {
+					if other != inviteCode {
+						if apart[inviteCode] == nil {
+							apart[inviteCode] = make(map[int]bool)
+						}
+						apart[inviteCode][other] = true
+					}
+				}
+			case SEATING_NEAR_STAGE:
+				nearStage[inviteCode] = true
+			}
+		}
+	}
+
+	groups := make(map[int]*seatingGroup)
+	var groupOrder []int
+	families := append([]InvitedFamily{}, invitedFamilies...)
+	sort.SliceStable(families, func(i, j int) bool { return families[i].InviteCode < families[j].InviteCode })
+	for _, invitedFamily := range families {
+		guests := invitedFamily.rsvpdTo(event)
+		if guests <= 0 || seated[invitedFamily.InviteCode] {
+			continue
+		}
+		root := find(invitedFamily.InviteCode)
+		if groups[root] == nil {
+			groups[root] = &seatingGroup{}
+			groupOrder = append(groupOrder, root)
+		}
+		groups[root].families = append(groups[root].families, invitedFamily)
+		groups[root].guests += guests
+		groups[root].nearStage = groups[root].nearStage || nearStage[invitedFamily.InviteCode]
+	}
+	sort.SliceStable(groupOrder, func(i, j int) bool {
+		groupI, groupJ := groups[groupOrder[i]], groups[groupOrder[j]]
+		if groupI.nearStage != groupJ.nearStage {
+			return groupI.nearStage
+		}
+		return groupI.guests > groupJ.guests
+	})
+
+	conflicts := func(i int, inviteCodes []int) bool {
+		for _, inviteCode := range inviteCodes {
+			for occupant := range occupants[i] {
+				if apart[inviteCode][occupant] {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	// bestTable is the table the guests fit at with the fewest empty seats
+	// left, near the stage when they want to be (& away from it otherwise,
+	// to keep those tables free) if there's one
+	bestTable := func(inviteCodes []int, guests int, wantsStage bool) int {
+		best := -1
+		for i, table := range eventTables {
+			if seatsLeft[i] < guests || conflicts(i, inviteCodes) {
+				continue
+			}
+			if best == -1 {
+				best = i
+				continue
+			}
+			if matches, bestMatches := table.NearStage == wantsStage, eventTables[best].NearStage == wantsStage; matches != bestMatches {
+				if matches {
+					best = i
+				}
+				continue
+			}
+			if seatsLeft[i] < seatsLeft[best] {
+				best = i
+			}
+		}
+		return best
+	}
+
+	var proposals []SeatAssignment
+	var problems []string
+	names := make(map[int][]string)
+	for _, invitedFamily := range families {
+		names[invitedFamily.InviteCode] = attendees[invitedFamily.InviteCode][event.Name]
+	}
+	seat := func(i int, inviteCode int, guests int) {
+		assignment := SeatAssignment{Event: event, Table: eventTables[i].Name, InviteCode: inviteCode, Seats: guests}
+		count := guests
+		if count > len(names[inviteCode]) {
+			count = len(names[inviteCode])
+		}
+		assignment.Names, names[inviteCode] = names[inviteCode][:count], names[inviteCode][count:]
+		proposals = append(proposals, assignment)
+		seatsLeft[i] -= guests
+		occupants[i][inviteCode] = true
+	}
+	seatFamily := func(invitedFamily InvitedFamily, wantsStage bool) {
+		inviteCode, guests := invitedFamily.InviteCode, invitedFamily.rsvpdTo(event)
+		if i := bestTable([]int{inviteCode}, guests, wantsStage); i != -1 {
+			if wantsStage && !eventTables[i].NearStage {
+				problems = append(problems, fmt.Sprintf("invite code %d isn't near the stage, those tables are full", inviteCode))
+			}
+			seat(i, inviteCode, guests)
+			return
+		}
+		// Split them over the tables with the most seats left
+		order := make([]int, len(eventTables))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool { return seatsLeft[order[i]] > seatsLeft[order[j]] })
+		for _, i := range order {
+			if guests == 0 || seatsLeft[i] <= 0 || conflicts(i, []int{inviteCode}) {
+				continue
+			}
+			count := guests
+			if count > seatsLeft[i] {
+				count = seatsLeft[i]
+			}
+			seat(i, inviteCode, count)
+			guests -= count
+		}
+		if guests > 0 {
+			problems = append(problems, fmt.Sprintf("no seats for %d guests of invite code %d, add a table or seats", guests, inviteCode))
+		} else {
+			problems = append(problems, fmt.Sprintf("invite code %d is split over tables, no table has room for all of them", inviteCode))
+		}
+	}
+
+	for _, root := range groupOrder {
+		seatingGroup := groups[root]
+		var inviteCodes []int
+		for _, invitedFamily := range seatingGroup.families {
+			inviteCodes = append(inviteCodes, invitedFamily.InviteCode)
+		}
+		if len(seatingGroup.families) > 1 {
+			if i := bestTable(inviteCodes, seatingGroup.guests, seatingGroup.nearStage); i != -1 {
+				for _, invitedFamily := range seatingGroup.families {
+					seat(i, invitedFamily.InviteCode, invitedFamily.rsvpdTo(event))
+				}
+				continue
+			}
+			problems = append(problems, fmt.Sprintf("invite codes %s can't sit together, no table has room for all %d of them", joinInts(inviteCodes), seatingGroup.guests))
+		}
+		for _, invitedFamily := range seatingGroup.families {
+			seatFamily(invitedFamily, seatingGroup.nearStage)
+		}
+	}
+	return proposals, problems
+}
+
+func joinInts(numbers []int) string {
+	var strs []string
+	for _, number := range numbers {
+		strs = append(strs, strconv.Itoa(number))
+	}
+	return strings.Join(strs, ", ")
+}
+
+// parseInviteCodes reads a comma separated list of invite codes, i.e. "12, 15"
+func parseInviteCodes(text string) ([]int, error) {
+	var inviteCodes []int
+	for _, field := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' }) {
+		inviteCode, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		inviteCodes = append(inviteCodes, inviteCode)
+	}
+	return inviteCodes, nil
+}
+
+func readSeatingTables() ([]SeatingTable, error) {
+	rows, err := getGoogleSheetsData(SEATING_TABLE, "A2:D")
+	if err != nil {
+		return nil, err
+	}
+	var tables []SeatingTable
+	for i, row := range rows {
+		if len(row) < 3 {
+			continue
+		}
+		event, ok := eventByName(fmt.Sprint(row[0]))
+		seats, err := strconv.Atoi(fmt.Sprint(row[2]))
+		if !ok || err != nil {
+			log.Printf("Skipping seating table (%d) as its event isn't known or its seats aren't a number: %v", i+2, row)
+			continue
+		}
+		table := SeatingTable{Event: event, Name: strings.TrimSpace(fmt.Sprint(row[1])), Seats: seats}
+		if len(row) > 3 {
+			table.NearStage = strings.EqualFold(strings.TrimSpace(fmt.Sprint(row[3])), "TRUE")
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+func readSeatingRules() ([]SeatingRule, error) {
+	rows, err := getGoogleSheetsData(SEATING_RULE, "A2:C")
+	if err != nil {
+		return nil, err
+	}
+	var rules []SeatingRule
+	for i, row := range rows {
+		if len(row) < 3 {
+			continue
+		}
+		kind := strings.ToUpper(strings.TrimSpace(fmt.Sprint(row[1])))
+		inviteCodes, err := parseInviteCodes(fmt.Sprint(row[2]))
+		if err != nil || len(inviteCodes) == 0 || (kind != SEATING_TOGETHER && kind != SEATING_APART && kind != SEATING_NEAR_STAGE) {
+			log.Printf("Skipping seating rule (%d) as it isn't TOGETHER, APART or NEAR_STAGE or its invite codes aren't numbers: %v", i+2, row)
+			continue
+		}
+		rules = append(rules, SeatingRule{EventName: strings.TrimSpace(fmt.Sprint(row[0])), Kind: kind, InviteCodes: inviteCodes})
+	}
+	return rules, nil
+}
+
+func readSeatAssignments() ([]SeatAssignment, error) {
+	rows, err := getGoogleSheetsData(SEATING_ASSIGNMENT, "A2:E")
+	if err != nil {
+		return nil, err
+	}
+	var assignments []SeatAssignment
+	for i, row := range rows {
+		if len(row) < 4 {
+			continue
+		}
+		event, ok := eventByName(fmt.Sprint(row[0]))
+		inviteCode, codeErr := strconv.Atoi(fmt.Sprint(row[2]))
+		seats, seatsErr := strconv.Atoi(fmt.Sprint(row[3]))
+		if !ok || codeErr != nil || seatsErr != nil {
+			log.Printf("Skipping seat assignment (%d) as its event isn't known or its invite code & seats aren't numbers: %v", i+2, row)
+			continue
+		}
+		assignment := SeatAssignment{Event: event, Table: strings.TrimSpace(fmt.Sprint(row[1])), InviteCode: inviteCode, Seats: seats}
+		if len(row) > 4 {
+			for _, name := range strings.Split(fmt.Sprint(row[4]), ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					assignment.Names = append(assignment.Names, name)
+				}
+			}
+		}
+		assignments = append(assignments, assignment)
+	}
+	return assignments, nil
+}
+
+// familyTables are the family's seat assignments, in event order
+func familyTables(assignments []SeatAssignment, inviteCode int) []SeatAssignment {
+	var tables []SeatAssignment
+	for _, event := range AllEvents {
+		for _, assignment := range assignments {
+			if assignment.InviteCode == inviteCode && assignment.Event == event {
+				tables = append(tables, assignment)
+			}
+		}
+	}
+	return tables
+}
+
+// tableAnswerMsg answers "which table am I at" for the family
+func tableAnswerMsg(inviteCode int) string {
+	assignments, err := readSeatAssignments()
+	if err != nil {
+		log.Printf("Unable to read the seating for invite code %d: %v", inviteCode, err)
+		return SEATING_UNAVAILABLE_MSG
+	}
+	return seatingMsg(familyTables(assignments, inviteCode))
+}
+
+// TableFulfillment answers the Dialogflow guest's "which table am I at"
+func TableFulfillment(response *DialogflowResponse, contexts []*dialogflow.Context) {
+	inviteCode := getInviteCodeFromContext(contexts)
+	log.Printf("\nIntent: %s - Starting fulfillment for invite code: %d", intent, inviteCode)
+	if inviteCode == -1 {
+		response.Text(SEATING_INVITE_CODE_MSG)
+		return
+	}
+	response.Text(tableAnswerMsg(inviteCode))
+}
+
+func sortSeatAssignments(assignments []SeatAssignment) {
+	eventOrder := make(map[Event]int)
+	for i, event := range AllEvents {
+		eventOrder[event] = i
+	}
+	sort.SliceStable(assignments, func(i, j int) bool {
+		if assignments[i].Event != assignments[j].Event {
+			return eventOrder[assignments[i].Event] < eventOrder[assignments[j].Event]
+		}
+		if assignments[i].Table != assignments[j].Table {
+			return naturalLess(assignments[i].Table, assignments[j].Table)
+		}
+		return assignments[i].InviteCode < assignments[j].InviteCode
+	})
+}
+
+// naturalLess orders table names with numbers by their number, so table 2
+// comes before table 10
+func naturalLess(a, b string) bool {
+	numberA, errA := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(strings.ToLower(a), "table")))
+	numberB, errB := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(strings.ToLower(b), "table")))
+	if errA == nil && errB == nil {
+		return numberA < numberB
+	}
+	return a < b
+}
+
+func writeSeatingChart(writer io.Writer, assignments []SeatAssignment, invitedFamilies []InvitedFamily, format string) error {
+	inviteNames := make(map[int]string)
+	for _, invitedFamily := range invitedFamilies {
+		inviteNames[invitedFamily.InviteCode] = invitedFamily.InviteName
+	}
+	header := []string{"Event", "Table", "Invite Code", "Invite Name", "Seats", "Names"}
+	var records [][]string
+	for _, assignment := range assignments {
+		records = append(records, []string{assignment.Event.Name, assignment.Table, strconv.Itoa(assignment.InviteCode), inviteNames[assignment.InviteCode], strconv.Itoa(assignment.Seats), strings.Join(assignment.Names, ", ")})
+	}
+	switch format {
+	case REPORT_TABLE:
+		table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, strings.Join(header, "\t"))
+		for _, record := range records {
+			fmt.Fprintln(table, strings.Join(record, "\t"))
+		}
+		return table.Flush()
+	case REPORT_CSV:
+		csvWriter := csv.NewWriter(writer)
+		csvWriter.Write(header)
+		csvWriter.WriteAll(records)
+		return csvWriter.Error()
+	}
+	return fmt.Errorf("unknown format %q, use table or csv", format)
+}
+
+// PlaceCard is one guest's card, named by the family's invite name (& which
+// guest they are) when we don't have their name
+type PlaceCard struct {
+	Name  string
+	Event string
+	Table string
+}
+
+func placeCards(assignments []SeatAssignment, invitedFamilies []InvitedFamily) []PlaceCard {
+	inviteNames := make(map[int]string)
+	for _, invitedFamily := range invitedFamilies {
+		inviteNames[invitedFamily.InviteCode] = invitedFamily.InviteName
+	}
+	var cards []PlaceCard
+	unnamed := make(map[Event]map[int]int)
+	for _, assignment := range assignments {
+		if unnamed[assignment.Event] == nil {
+			unnamed[assignment.Event] = make(map[int]int)
+		}
+		for seat := 0; seat < assignment.Seats; seat++ {
+			card := PlaceCard{Event: assignment.Event.DisplayName, Table: assignment.Table}
+			if seat < len(assignment.Names) {
+				card.Name = assignment.Names[seat]
+			} else {
+				unnamed[assignment.Event][assignment.InviteCode]++
+				card.Name = fmt.Sprintf("%s (guest %d)", inviteNames[assignment.InviteCode], unnamed[assignment.Event][assignment.InviteCode])
+			}
+			cards = append(cards, card)
+		}
+	}
+	return cards
+}
+
+var placeCardsTemplate = template.Must(template.New("place-cards").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Place Cards</title>
+<style>
+body { font-family: Georgia, serif; margin: 0; }
+.card { display: inline-block; box-sizing: border-box; width: 3.5in; height: 2in; margin: 0.1in; padding: 0.4in 0.2in; border: 1px dashed #999; text-align: center; page-break-inside: avoid; vertical-align: top; }
+.name { font-size: 20pt; }
+.table { font-size: 14pt; margin-top: 0.2in; }
+.event { font-size: 9pt; margin-top: 0.1in; color: #666; }
+</style>
+</head>
+<body>
+{{range .}}<div class="card"><div class="name">{{.Name}}</div><div class="table">{{.Table}}</div><div class="event">{{.Event}}</div></div>
+{{end}}</body>
+</html>
+`))
+
+func writePlaceCards(writer io.Writer, cards []PlaceCard) error {
+	return placeCardsTemplate.Execute(writer, cards)
+}
+
+// seatingEvents are the event given by the -event flag, or all of them
+func seatingEvents(eventName string) ([]Event, error) {
+	if eventName == "" {
+		return AllEvents, nil
+	}
+	event, ok := eventByName(eventName)
+	if !ok {
+		return nil, fmt.Errorf("unknown event %q", eventName)
+	}
+	return []Event{event}, nil
+}
+
+func assignSeatsCommand(args []string) error {
+	flags := flag.NewFlagSet("assign-seats", flag.ExitOnError)
+	eventName := flags.String("event", "", "only seat this event, i.e. WEDDING (default every event with tables in SEATING_TABLE)")
+	save := flags.Bool("save", false, "add the proposed seats to SEATING_ASSIGNMENT (default only print them)")
+	flags.Parse(args)
+
+	events, err := seatingEvents(*eventName)
+	if err != nil {
+		return err
+	}
+	tables, err := readSeatingTables()
+	if err != nil {
+		return err
+	}
+	rules, err := readSeatingRules()
+	if err != nil {
+		return err
+	}
+	existing, err := readSeatAssignments()
+	if err != nil {
+		return err
+	}
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		return err
+	}
+	attendees, err := readAttendees()
+	if err != nil {
+		log.Printf("Seating the guests without their names, as ATTENDEES couldn't be read: %v", err)
+	}
+
+	var proposals []SeatAssignment
+	for _, event := range events {
+		eventProposals, problems := proposeSeating(event, tables, rules, existing, invitedFamilies, attendees)
+		proposals = append(proposals, eventProposals...)
+		for _, problem := range problems {
+			fmt.Printf("%s: %s\n", event.Name, problem)
+		}
+	}
+	sortSeatAssignments(proposals)
+	if err := writeSeatingChart(os.Stdout, proposals, invitedFamilies, REPORT_TABLE); err != nil {
+		return err
+	}
+	if !*save || len(proposals) == 0 {
+		return nil
+	}
+	var rows [][]interface{}
+	for _, proposal := range proposals {
+		rows = append(rows, []interface{}{proposal.Event.Name, proposal.Table, proposal.InviteCode, proposal.Seats, strings.Join(proposal.Names, ", "), time.Now()})
+	}
+	_, err = appendGoogleSheetsData(SEATING_ASSIGNMENT, rows)
+	return err
+}
+
+// seatingOutput reads SEATING_ASSIGNMENT for the events, sorted by table,
+// and where to write it
+func seatingOutput(eventName, outputFile string) ([]SeatAssignment, []InvitedFamily, io.Writer, func() error, error) {
+	events, err := seatingEvents(eventName)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	assignments, err := readSeatAssignments()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	var eventAssignments []SeatAssignment
+	for _, assignment := range assignments {
+		for _, event := range events {
+			if assignment.Event == event {
+				eventAssignments = append(eventAssignments, assignment)
+			}
+		}
+	}
+	sortSeatAssignments(eventAssignments)
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if outputFile == "" {
+		return eventAssignments, invitedFamilies, os.Stdout, func() error { return nil }, nil
+	}
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return eventAssignments, invitedFamilies, file, file.Close, nil
+}
+
+func seatingChartCommand(args []string) error {
+	flags := flag.NewFlagSet("seating-chart", flag.ExitOnError)
+	eventName := flags.String("event", "", "only list this event's tables, i.e. WEDDING (default all events)")
+	format := flags.String("format", REPORT_TABLE, "table or csv")
+	outputFile := flags.String("out", "", "file to write the chart to (default stdout)")
+	flags.Parse(args)
+
+	assignments, invitedFamilies, writer, closeWriter, err := seatingOutput(*eventName, *outputFile)
+	if err != nil {
+		return err
+	}
+	defer closeWriter()
+	return writeSeatingChart(writer, assignments, invitedFamilies, *format)
+}
+
+func placeCardsCommand(args []string) error {
+	flags := flag.NewFlagSet("place-cards", flag.ExitOnError)
+	eventName := flags.String("event", "", "only print this event's cards, i.e. WEDDING (default all events)")
+	outputFile := flags.String("out", "", "html file to write the cards to (default stdout)")
+	flags.Parse(args)
+
+	assignments, invitedFamilies, writer, closeWriter, err := seatingOutput(*eventName, *outputFile)
+	if err != nil {
+		return err
+	}
+	defer closeWriter()
+	return writePlaceCards(writer, placeCards(assignments, invitedFamilies))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestProposeSeating(t *testing.T) {
+	tables := []SeatingTable{
+		{Event: Wedding, Name: "1", Seats: 6, NearStage: true},
+		{Event: Wedding, Name: "2", Seats: 7},
+		{Event: Wedding, Name: "3", Seats: 6},
+		{Event: Wedding, Name: "4", Seats: 4},
+		{Event: Garba, Name: "1", Seats: 100},
+	}
+	coming := func(inviteCode int, guests int) InvitedFamily {
+		return InvitedFamily{InviteCode: inviteCode, VidhiRsvpd: NULL_INVITEES, GarbaRsvpd: NULL_INVITEES, WeddingRsvpd: guests}
+	}
+	invitedFamilies := []InvitedFamily{coming(1, 2), coming(2, 3), coming(3, 3), coming(4, 4), coming(5, 2), coming(6, 7), coming(7, 1)}
+	rules := []SeatingRule{
+		{Kind: SEATING_NEAR_STAGE, InviteCodes: []int{1}},
+		{EventName: "WEDDING", Kind: SEATING_TOGETHER, InviteCodes: []int{2, 3}},
+		{Kind: SEATING_APART, InviteCodes: []int{5, 7}},
+		{EventName: "GARBA", Kind: SEATING_TOGETHER, InviteCodes: []int{4, 5}},
+	}
+	// The hosts already sat family 7 at table 4
+	existing := []SeatAssignment{{Event: Wedding, Table: "4", InviteCode: 7, Seats: 1}}
+	attendees := map[int]map[string][]string{6: {"WEDDING": {"Asha", "Ravi"}}}
+
+	proposals, problems := proposeSeating(Wedding, tables, rules, existing, invitedFamilies, attendees)
+	tablesOf := make(map[int][]string)
+	for _, proposal := range proposals {
+		tablesOf[proposal.InviteCode] = append(tablesOf[proposal.InviteCode], proposal.Table)
+		if proposal.InviteCode == 6 && strings.Join(proposal.Names, ",") != "Asha,Ravi" {
+			t.Errorf("Expected family 6's names, got: +%v", proposal)
+		}
+	}
+	if strings.Join(tablesOf[1], ",") != "1" {
+		t.Errorf("Expected family 1 near the stage, got: +%v", tablesOf[1])
+	}
+	if len(tablesOf[2]) != 1 || strings.Join(tablesOf[2], ",") != strings.Join(tablesOf[3], ",") {
+		t.Errorf("Expected families 2 & 3 together, got: +%v +%v", tablesOf[2], tablesOf[3])
+	}
+	if strings.Join(tablesOf[6], ",") != "2" || strings.Join(tablesOf[4], ",") != "1" {
+		t.Errorf("Expected the tables with the fewest empty seats, got: +%v +%v", tablesOf[6], tablesOf[4])
+	}
+	if len(tablesOf[7]) != 0 {
+		t.Errorf("Expected family 7 to keep their table, got: +%v", tablesOf[7])
+	}
+	// The only seats left are at family 7's table
+	if len(tablesOf[5]) != 0 || len(problems) != 1 || !strings.Contains(problems[0], "2 guests of invite code 5") {
+		t.Errorf("Expected family 5 not to sit with family 7, got: +%v +%v", tablesOf[5], problems)
+	}
+
+	var buffer bytes.Buffer
+	sortSeatAssignments(proposals)
+	if err := writeSeatingChart(&buffer, proposals[:1], invitedFamilies, REPORT_CSV); err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if expected := "Event,Table,Invite Code,Invite Name,Seats,Names\nWEDDING,1,1,,2,\n"; buffer.String() != expected {
+		t.Errorf("Unexpected csv: %s", buffer.String())
+	}
+}
+
+func TestPlaceCards(t *testing.T) {
+	assignments := []SeatAssignment{{Event: Wedding, Table: "Table 2", InviteCode: 1, Seats: 3, Names: []string{"Asha & Ravi's <kid>"}}}
+	cards := placeCards(assignments, []InvitedFamily{{InviteCode: 1, InviteName: "The Shah Family"}})
+	if len(cards) != 3 || cards[2].Name != "The Shah Family (guest 2)" || cards[0].Table != "Table 2" {
+		t.Errorf("Unexpected place cards: +%v", cards)
+	}
+	var buffer bytes.Buffer
+	if err := writePlaceCards(&buffer, cards); err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if !strings.Contains(buffer.String(), "Asha &amp; Ravi&#39;s &lt;kid&gt;") {
+		t.Errorf("Expected the names to be escaped, got: %s", buffer.String())
+	}
+}
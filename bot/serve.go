@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// handlerLock runs one request (or sync) at a time, like a lambda container
+// does, since the handlers keep the request's details in package variables
+var handlerLock sync.Mutex
+
+// serveCommand runs the bot as an http server, outside of lambda. With
+// GUEST_STORE=bolt it also keeps the spreadsheet in sync, as only the process
+// that has the bolt file open can read or write it.
+func serveCommand(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", ":3000", "address to listen on")
+	syncEvery := flags.Duration("sync-every", 5*time.Minute, "how often to sync the bolt store with the spreadsheet, 0 to not sync (GUEST_STORE=bolt)")
+	flags.Parse(args)
+
+	if store, ok := guestStore.(*boltStore); ok && *syncEvery > 0 {
+		go syncInBackground(store, *syncEvery)
+	}
+	http.HandleFunc("/", serveLambdaRequest)
+	log.Printf("Listening on %s", *addr)
+	return http.ListenAndServe(*addr, nil)
+}
+
+// syncInBackground syncs between requests until the server stops
+func syncInBackground(store *boltStore, every time.Duration) {
+	for {
+		handlerLock.Lock()
+		if err := syncOnce(store, ""); err != nil {
+			log.Printf("Sync failed: %v", err)
+		}
+		handlerLock.Unlock()
+		time.Sleep(every)
+	}
+}
+
+// serveLambdaRequest hands the http request to Handler as if it came through API Gateway
+func serveLambdaRequest(writer http.ResponseWriter, httpRequest *http.Request) {
+	body, err := ioutil.ReadAll(httpRequest.Body)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request := events.APIGatewayProxyRequest{
+		HTTPMethod:            httpRequest.Method,
+		Path:                  httpRequest.URL.Path,
+		Headers:               make(map[string]string),
+		QueryStringParameters: make(map[string]string),
+		Body:                  string(body),
+	}
+	for key := range httpRequest.Header {
+		request.Headers[key] = httpRequest.Header.Get(key)
+	}
+	for key := range httpRequest.URL.Query() {
+		request.QueryStringParameters[key] = httpRequest.URL.Query().Get(key)
+	}
+	request.RequestContext.RequestID = fmt.Sprint(time.Now().UnixNano())
+
+	handlerLock.Lock()
+	response, err := Handler(request)
+	handlerLock.Unlock()
+	if err != nil {
+		log.Printf("Unable to handle %s %s: %v", request.HTTPMethod, request.Path, err)
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	responseBody := []byte(response.Body)
+	if response.IsBase64Encoded {
+		if responseBody, err = base64.StdEncoding.DecodeString(response.Body); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	for key, value := range response.Headers {
+		writer.Header().Set(key, value)
+	}
+	if response.StatusCode == 0 {
+		response.StatusCode = http.StatusOK
+	}
+	writer.WriteHeader(response.StatusCode)
+	writer.Write(responseBody)
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeLambdaRequest(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	serveLambdaRequest(recorder, httptest.NewRequest("GET", "/admin/families?q=patel", nil))
+	if recorder.Code != http.StatusUnauthorized || !strings.Contains(recorder.Body.String(), "bearer token") {
+		t.Errorf("Expected the admin API's 401 without a token, got: %d %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type smsInputKind int
+
+const (
+	SMS_OTHER smsInputKind = iota
+	SMS_YES
+	SMS_NO
+	SMS_NUMBER
+	SMS_RESTART
+	SMS_OVERRIDE_CODE
+	SMS_SHUTTLE
+	SMS_TABLE
+	SMS_SEAT_REQUEST
+)
+
+type smsInput struct {
+	kind   smsInputKind
+	number int
+	code   string
+}
+
+var smsYesWords = map[string]bool{"yes": true, "y": true, "yeah": true, "yep": true, "yup": true, "sure": true, "ok": true, "okay": true, "rsvp": true, "update": true}
+var smsNoWords = map[string]bool{"no": true, "n": true, "nope": true, "not now": true, "later": true, "no thanks": true}
+var smsRestartWords = map[string]bool{"restart": true, "start over": true, "reset": true}
+var smsNumberWords = map[string]int{
+	"none": 0, "zero": 0, "nobody": 0, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+	"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12,
+}
+var smsDigits = regexp.MustCompile(`\d+`)
+var smsOverrideCode = regexp.MustCompile(`(?i)\b` + OVERRIDE_CODE_PREFIX + `[a-z0-9]+\b`)
+var smsShuttleQuestion = regexp.MustCompile(`(?i)\bshuttles?\b`)
+var smsTableQuestion = regexp.MustCompile(`(?i)\b(which|what|my) table\b|\bseated\b`)
+
+// SmsHandler answers Twilio's inbound SMS webhook with TwiML. It runs the same
+// RSVP flow as the Dialogflow agent, but keeps the conversation state itself.
+//
+// https://www.twilio.com/docs/sms/twiml
+func SmsHandler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	form, err := parseTwilioForm(request)
+	if err != nil {
+		log.Printf("Unable to parse the Twilio request body: %v", err)
+		return events.APIGatewayProxyResponse{StatusCode: 400}, nil
+	}
+	if !isValidTwilioRequest(os.Getenv("TWILIO_SMS_WEBHOOK_URL"), request, form) {
+		log.Printf("Invalid Twilio signature for message: %s", form.Get("MessageSid"))
+		return events.APIGatewayProxyResponse{StatusCode: 403}, nil
+	}
+	smsSenderVerified = !skipTwilioValidation()
+
+	phoneNumber := form.Get("From")
+	sessionID = phoneNumber
+	responseID = form.Get("MessageSid")
+	requestStr = fmt.Sprintf("+%v", form)
+
+	conversation, err := findConversation(phoneNumber)
+	if err != nil {
+		log.Fatalf("Unable to retrieve the conversation for %s: %v", phoneNumber, err)
+	}
+	intent = "sms - " + conversation.Step
+	log.Printf("Received sms for step: %s, Processing messageSid: %s from: %s", conversation.Step, responseID, phoneNumber)
+
+	message := smsFulfillment(&conversation, parseSmsMessage(form.Get("Body")), form.Get("Body"))
+	if err := saveConversation(conversation); err != nil {
+		log.Fatalf("Unable to save the conversation for %s: %v", phoneNumber, err)
+	}
+
+	return newTwimlResponse(twimlMessage{Text: message}), nil
+}
+
+// smsFulfillment answers the parsed message. The message's text is only used
+// for the attendees' names.
+func smsFulfillment(conversation *Conversation, input smsInput, text string) string {
+	if id, approve, ok := parseSeatDecision(text); ok && isHostPhoneNumber(conversation.PhoneNumber) {
+		if !smsSenderVerified {
+			log.Printf("Ignoring the decision on seat request %d from %s as the Twilio signature wasn't checked", id, conversation.PhoneNumber)
+			return SEAT_DECISION_UNVERIFIED_MSG
+		}
+		return smsSeatDecisionMsg(id, approve)
+	}
+
+	if input.kind == SMS_RESTART {
+		*conversation = Conversation{PhoneNumber: conversation.PhoneNumber, Rsvps: make(map[Event]int), rowNumber: conversation.rowNumber}
+		return WELCOME_MSG
+	}
+
+	if input.kind == SMS_OVERRIDE_CODE {
+		if conversation.InviteCode == 0 {
+			return WELCOME_MSG
+		}
+		if !isValidOverrideCode(conversation.InviteCode, input.code) {
+			return INVALID_OVERRIDE_CODE_MSG
+		}
+		conversation.OverrideCode = input.code
+		conversation.Rsvps = make(map[Event]int)
+		return OVERRIDE_CODE_ACCEPTED_MSG + " " + nextRsvpPromptMsg(conversation, findInvitedFamily(conversation.InviteCode), Event{})
+	}
+
+	if namesEvent, ok := conversation.namesEvent(); ok {
+		return smsAttendeeNamesFulfillment(conversation, namesEvent, text)
+	}
+
+	if dietaryEvent, ok := conversation.dietaryEvent(); ok {
+		return smsDietaryFulfillment(conversation, dietaryEvent, text)
+	}
+
+	if conversation.Step == STEP_ACCESSIBILITY {
+		return smsAccessibilityFulfillment(conversation, text)
+	}
+
+	if travelQuestion, ok := conversation.travelQuestion(); ok {
+		return smsTravelFulfillment(conversation, travelQuestion, text)
+	}
+
+	if currentEvent, ok := conversation.currentEvent(); ok {
+		invitedFamily := findInvitedFamily(conversation.InviteCode)
+		invited := invitedFamily.invitedTo(currentEvent)
+		if input.kind != SMS_NUMBER {
+			return DIDNT_UNDERSTAND_MSG + " " + rsvpPromptMsg(currentEvent, invitedFamily)
+		}
+		if currentEvent.CountsChildren {
+			// The count is only the adults, the children are asked for next
+			if message, ok := invitedFamily.checkRsvpSplit(currentEvent, input.number, 0); !ok {
+				return message + " " + rsvpPromptMsg(currentEvent, invitedFamily)
+			}
+		} else if input.number > invited {
+			return rsvpCountTooHighMsg(currentEvent, invited) + " " + rsvpCountPromptMsg(currentEvent, invited)
+		}
+
+		if message, ok := checkRsvpDeadline(conversation.InviteCode, currentEvent, conversation.OverrideCode); !ok {
+			conversation.Step = STEP_START
+			return message
+		}
+
+		if !currentEvent.CountsChildren {
+			return smsSaveRsvpMsg(conversation, invitedFamily, currentEvent, input.number, nil)
+		}
+		if _, invitedChildren := invitedFamily.invitedSplit(currentEvent); invitedChildren > 0 {
+			conversation.Rsvps[currentEvent] = input.number // the adults, until we have the children
+			conversation.Step = STEP_CHILDREN + currentEvent.Name
+			return rsvpChildrenPromptMsg(currentEvent, invitedChildren)
+		}
+		return smsSaveRsvpMsg(conversation, invitedFamily, currentEvent, input.number, map[Event]int{currentEvent: 0})
+	}
+
+	if childrenEvent, ok := conversation.childrenEvent(); ok {
+		invitedFamily := findInvitedFamily(conversation.InviteCode)
+		adults := conversation.Rsvps[childrenEvent]
+		_, invitedChildren := invitedFamily.invitedSplit(childrenEvent)
+		if input.kind != SMS_NUMBER {
+			return DIDNT_UNDERSTAND_MSG + " " + rsvpChildrenPromptMsg(childrenEvent, invitedChildren)
+		}
+		if message, ok := invitedFamily.checkRsvpSplit(childrenEvent, adults, input.number); !ok {
+			return message + " " + rsvpChildrenPromptMsg(childrenEvent, invitedChildren)
+		}
+		return smsSaveRsvpMsg(conversation, invitedFamily, childrenEvent, adults+input.number, map[Event]int{childrenEvent: input.number})
+	}
+
+	if input.kind == SMS_SHUTTLE && conversation.InviteCode != 0 {
+		return shuttleAnswerMsg(conversation.InviteCode)
+	}
+	if input.kind == SMS_TABLE && conversation.InviteCode != 0 {
+		return tableAnswerMsg(conversation.InviteCode)
+	}
+	if input.kind == SMS_SEAT_REQUEST && conversation.InviteCode != 0 {
+		return seatRequestMsg(conversation.InviteCode, text, conversation.PhoneNumber)
+	}
+
+	if conversation.Step == STEP_CONFIRM {
+		switch input.kind {
+		case SMS_YES:
+			return nextRsvpPromptMsg(conversation, findInvitedFamily(conversation.InviteCode), Event{})
+		case SMS_NO:
+			conversation.Step = STEP_START
+			return NOT_NOW_MSG
+		default:
+			return DIDNT_UNDERSTAND_MSG + " " + rsvpNowPromptMsg()
+		}
+	}
+
+	switch {
+	case input.kind == SMS_NUMBER:
+		if _, found := lookupInvitedFamily(input.number); !found {
+			return INVITE_CODE_NOT_FOUND_MSG
+		}
+		conversation.InviteCode = input.number
+		conversation.Rsvps = make(map[Event]int)
+		conversation.OverrideCode = ""
+		conversation.Step = STEP_CONFIRM
+		message, _ := InviteCodeFulfillment(input.number)
+		return message + " (Yes / Not now)"
+	case input.kind == SMS_YES && conversation.InviteCode != 0:
+		// They've already given us their invite code, so start (or update) their RSVPs
+		conversation.Rsvps = make(map[Event]int)
+		return nextRsvpPromptMsg(conversation, findInvitedFamily(conversation.InviteCode), Event{})
+	default:
+		return WELCOME_MSG
+	}
+}
+
+// smsSaveRsvpMsg saves the event's RSVP count (and how many of them are
+// children, when it was split), and asks who's coming when the names are
+// collected
+func smsSaveRsvpMsg(conversation *Conversation, invitedFamily InvitedFamily, event Event, rsvpd int, children map[Event]int) string {
+	saved, waitlisted := saveRsvp(conversation.InviteCode, conversation.PhoneNumber, map[Event]int{event: rsvpd}, children)
+	rsvpd = saved[event]
+	conversation.Rsvps[event] = rsvpd
+	message := ""
+	if len(waitlisted) > 0 {
+		message = waitlistedMsg(event, rsvpd, waitlisted[0]) + " "
+	}
+	if rsvpd > 0 && collectAttendeeNames() {
+		conversation.Step = STEP_NAMES + event.Name
+		return message + attendeeNamesPromptMsg(event, rsvpd, familyMembers(conversation.InviteCode))
+	}
+	return message + dietaryOrNextPromptMsg(conversation, invitedFamily, event)
+}
+
+// smsAttendeeNamesFulfillment saves who's coming to the event, updating the
+// RSVP count to match, and asks about their dietary needs or the next event's RSVP
+func smsAttendeeNamesFulfillment(conversation *Conversation, event Event, text string) string {
+	invitedFamily := findInvitedFamily(conversation.InviteCode)
+	if isSkipAttendeeNames(text) {
+		return dietaryOrNextPromptMsg(conversation, invitedFamily, event)
+	}
+
+	members := familyMembers(conversation.InviteCode)
+	names, err := parseAttendeeNames(text, members)
+	switch {
+	case err != nil:
+		return DIDNT_UNDERSTAND_MSG + " " + attendeeNamesPromptMsg(event, conversation.Rsvps[event], members)
+	case len(names) > invitedFamily.invitedTo(event):
+		return rsvpCountTooHighMsg(event, invitedFamily.invitedTo(event)) + " " + attendeeNamesPromptMsg(event, conversation.Rsvps[event], members)
+	}
+
+	message := ""
+	if len(names) != conversation.Rsvps[event] {
+		if message, ok := checkRsvpRecountDeadline(conversation.InviteCode, event, conversation.OverrideCode); !ok {
+			conversation.Step = STEP_START
+			return message
+		}
+		saved, waitlisted := saveRsvp(conversation.InviteCode, conversation.PhoneNumber, map[Event]int{event: len(names)}, invitedFamily.recountedChildren(event, len(names)))
+		names = names[:saved[event]] // the rest are on the waitlist
+		conversation.Rsvps[event] = len(names)
+		if len(waitlisted) > 0 {
+			message = waitlistedMsg(event, len(names), waitlisted[0]) + " "
+		}
+	}
+	if err := saveAttendees(conversation.InviteCode, event, names); err != nil {
+		log.Fatalf("Unable to save the attendees of invite code %d: %v", conversation.InviteCode, err)
+	}
+	return message + dietaryOrNextPromptMsg(conversation, invitedFamily, event)
+}
+
+// smsDietaryFulfillment saves the dietary needs of who's coming to the event
+// and asks for the next event's RSVP
+func smsDietaryFulfillment(conversation *Conversation, event Event, text string) string {
+	invitedFamily := findInvitedFamily(conversation.InviteCode)
+	options := event.mealOptions()
+	attendees := dietaryAttendees(conversation.InviteCode, event)
+	var needs []DietaryNeed
+	if !isNoDietaryNeeds(text) {
+		var err error
+		needs, err = parseDietaryNeeds(text, options, attendees)
+		switch {
+		case err != nil:
+			return DIDNT_UNDERSTAND_MSG + " " + dietaryPromptMsg(event, options, attendees)
+		case dietaryNeedsTotal(needs) > conversation.Rsvps[event]:
+			return dietaryTooManyMsg(event, conversation.Rsvps[event]) + " " + dietaryPromptMsg(event, options, attendees)
+		}
+	}
+
+	if err := saveDietaryNeeds(conversation.InviteCode, event, needs); err != nil {
+		log.Fatalf("Unable to save the dietary needs of invite code %d: %v", conversation.InviteCode, err)
+	}
+	return nextRsvpPromptMsg(conversation, invitedFamily, event)
+}
+
+// dietaryOrNextPromptMsg asks about the dietary needs of the event's attendees
+// when the event has meal options, and for the next event's RSVP otherwise
+func dietaryOrNextPromptMsg(conversation *Conversation, invitedFamily InvitedFamily, event Event) string {
+	options := event.mealOptions()
+	if conversation.Rsvps[event] <= 0 || len(options) == 0 {
+		return nextRsvpPromptMsg(conversation, invitedFamily, event)
+	}
+	conversation.Step = STEP_DIETARY + event.Name
+	return dietaryPromptMsg(event, options, dietaryAttendees(conversation.InviteCode, event))
+}
+
+// smsAccessibilityFulfillment saves the family's accessibility needs, lets the
+// hosts know and carries on with the closing questions
+func smsAccessibilityFulfillment(conversation *Conversation, text string) string {
+	var needs AccessibilityNeeds
+	if !isNoAccessibilityNeeds(text) {
+		var err error
+		if needs, err = parseAccessibilityNeeds(text, accessibilityOptions()); err != nil {
+			return DIDNT_UNDERSTAND_MSG + " " + accessibilityPromptMsg(accessibilityOptions())
+		}
+	}
+	invitedFamily := findInvitedFamily(conversation.InviteCode)
+	recordAccessibilityNeeds(invitedFamily, needs)
+	return closingPromptMsg(conversation, invitedFamily, STEP_ACCESSIBILITY)
+}
+
+// closingPromptMsg asks the next closing question after the given one (see
+// nextClosingStep), or returns the RSVP summary
+func closingPromptMsg(conversation *Conversation, invitedFamily InvitedFamily, after string) string {
+	step := nextClosingStep(invitedFamily, conversation.Rsvps, after)
+	conversation.Step = step
+	switch {
+	case step == STEP_ACCESSIBILITY:
+		return accessibilityPromptMsg(accessibilityOptions())
+	case strings.HasPrefix(step, STEP_TRAVEL):
+		return travelPromptMsg(strings.TrimPrefix(step, STEP_TRAVEL))
+	}
+	message, _ := getFollowupEventAction(invitedFamily, Event{}, conversation.Rsvps)
+	return message
+}
+
+// nextRsvpPromptMsg asks for the next event's RSVP count, or the closing
+// questions when they've RSVP'd to every event they're invited to
+func nextRsvpPromptMsg(conversation *Conversation, invitedFamily InvitedFamily, currentEvent Event) string {
+	_, followupAction := getFollowupEventAction(invitedFamily, currentEvent, conversation.Rsvps)
+	nextEvent, ok := eventForDialogflowAction(followupAction)
+	if !ok {
+		return closingPromptMsg(conversation, invitedFamily, STEP_START)
+	}
+	conversation.Step = STEP_RSVP + nextEvent.Name
+	return rsvpPromptMsg(nextEvent, invitedFamily)
+}
+
+// parseSmsMessage figures out whether the guest said yes, no or gave us a
+// number (an invite code or a head count, depending on the step)
+func parseSmsMessage(body string) smsInput {
+	if code := smsOverrideCode.FindString(body); code != "" {
+		return smsInput{kind: SMS_OVERRIDE_CODE, code: normalizeOverrideCode(code)}
+	}
+
+	text := strings.ToLower(strings.TrimSpace(body))
+	text = strings.Trim(text, ".!? ")
+
+	switch {
+	case smsRestartWords[text]:
+		return smsInput{kind: SMS_RESTART}
+	case smsYesWords[text]:
+		return smsInput{kind: SMS_YES}
+	case smsNoWords[text]:
+		return smsInput{kind: SMS_NO}
+	case smsSeatRequest.MatchString(text):
+		return smsInput{kind: SMS_SEAT_REQUEST}
+	case smsShuttleQuestion.MatchString(text):
+		return smsInput{kind: SMS_SHUTTLE}
+	case smsTableQuestion.MatchString(text):
+		return smsInput{kind: SMS_TABLE}
+	}
+
+	if digits := smsDigits.FindString(text); digits != "" {
+		number, err := strconv.Atoi(digits)
+		if err == nil {
+			return smsInput{kind: SMS_NUMBER, number: number}
+		}
+	}
+	for _, word := range strings.Fields(text) {
+		if number, ok := smsNumberWords[word]; ok {
+			return smsInput{kind: SMS_NUMBER, number: number}
+		}
+	}
+
+	words := strings.Fields(text)
+	if len(words) > 0 && smsYesWords[words[0]] {
+		return smsInput{kind: SMS_YES}
+	}
+	if len(words) > 0 && smsNoWords[words[0]] {
+		return smsInput{kind: SMS_NO}
+	}
+	return smsInput{kind: SMS_OTHER}
+}
+
+func parseTwilioForm(request events.APIGatewayProxyRequest) (url.Values, error) {
+	body := request.Body
+	if request.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(body)
+		if err != nil {
+			return nil, err
+		}
+		body = string(decoded)
+	}
+	return url.ParseQuery(body)
+}
+
+// isValidTwilioRequest checks the X-Twilio-Signature header. Requests are
+// refused without TWILIO_AUTH_TOKEN, unless TWILIO_SKIP_VALIDATION=true is set
+// to post form data locally.
+//
+// https://www.twilio.com/docs/usage/security#validating-requests
+func isValidTwilioRequest(webhookURL string, request events.APIGatewayProxyRequest, form url.Values) bool {
+	if skipTwilioValidation() {
+		return true
+	}
+	authToken := os.Getenv("TWILIO_AUTH_TOKEN")
+	if authToken == "" {
+		log.Printf("TWILIO_AUTH_TOKEN isn't set, so the Twilio signature can't be checked")
+		return false
+	}
+
+	var keys []string
+	for key := range form {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	signed := webhookURL
+	for _, key := range keys {
+		// Every value of a repeated parameter is signed, in order like Twilio's helper libraries
+		values := append([]string(nil), form[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			signed += key + value
+		}
+	}
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(signed))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(getHeader(request, "X-Twilio-Signature")))
+}
+
+func skipTwilioValidation() bool {
+	return strings.EqualFold(os.Getenv("TWILIO_SKIP_VALIDATION"), "true")
+}
+
+func getHeader(request events.APIGatewayProxyRequest, name string) string {
+	for key, value := range request.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
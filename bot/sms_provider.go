@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// SmsProvider sends text messages we start (as opposed to replies to the
+// guests' texts, which are sent as TwiML)
+type SmsProvider interface {
+	// SendSms returns the provider's id for the sent message
+	SendSms(to string, body string) (string, error)
+}
+
+// newSmsProvider returns the provider with the given name: twilio, stdout or
+// file (which appends the messages to outputFile)
+func newSmsProvider(name string, outputFile string) (SmsProvider, error) {
+	switch name {
+	case "twilio":
+		return NewTwilioSmsProvider()
+	case "stdout":
+		return &WriterSmsProvider{Writer: os.Stdout}, nil
+	case "file":
+		if outputFile == "" {
+			return nil, fmt.Errorf("the file sms provider needs a file to write the texts to")
+		}
+		return &FileSmsProvider{Path: outputFile}, nil
+	default:
+		return nil, fmt.Errorf("unknown sms provider %q, expected twilio, stdout or file", name)
+	}
+}
+
+// smsProviderFromEnv is the SMS_PROVIDER (twilio by default) the lambda
+// functions send texts with, writing to SMS_PROVIDER_FILE for file
+func smsProviderFromEnv() (SmsProvider, error) {
+	name := os.Getenv("SMS_PROVIDER")
+	if name == "" {
+		name = "twilio"
+	}
+	return newSmsProvider(name, os.Getenv("SMS_PROVIDER_FILE"))
+}
+
+// TwilioSmsProvider sends text messages through Twilio's REST API
+//
+// https://www.twilio.com/docs/sms/api/message-resource#create-a-message-resource
+type TwilioSmsProvider struct {
+	AccountSid  string
+	AuthToken   string
+	PhoneNumber string
+	client      *http.Client
+}
+
+type twilioMessageResponse struct {
+	Sid     string `json:"sid"`
+	Status  string `json:"status"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewTwilioSmsProvider uses the TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and
+// TWILIO_PHONE_NUMBER (the number texts are sent from) environment variables
+func NewTwilioSmsProvider() (*TwilioSmsProvider, error) {
+	provider := &TwilioSmsProvider{
+		AccountSid:  os.Getenv("TWILIO_ACCOUNT_SID"),
+		AuthToken:   os.Getenv("TWILIO_AUTH_TOKEN"),
+		PhoneNumber: os.Getenv("TWILIO_PHONE_NUMBER"),
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+	if provider.AccountSid == "" || provider.AuthToken == "" || provider.PhoneNumber == "" {
+		return nil, fmt.Errorf("TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_PHONE_NUMBER have to be set to send texts through twilio")
+	}
+	return provider, nil
+}
+
+func (provider *TwilioSmsProvider) SendSms(to string, body string) (string, error) {
+	endpoint := "https://api.twilio.com/2010-04-01/Accounts/" + provider.AccountSid + "/Messages.json"
+	form := url.Values{"To": {to}, "From": {provider.PhoneNumber}, "Body": {body}}
+
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(provider.AccountSid, provider.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := provider.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var message twilioMessageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+		return "", fmt.Errorf("unable to parse twilio response (status %d): %v", resp.StatusCode, err)
+	}
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("twilio error %d: %s", message.Code, message.Message)
+	}
+	return message.Sid, nil
+}
+
+// WriterSmsProvider writes the text messages out instead of sending them, i.e.
+// to stdout or a file when testing locally
+type WriterSmsProvider struct {
+	Writer io.Writer
+	sent   int
+}
+
+func (provider *WriterSmsProvider) SendSms(to string, body string) (string, error) {
+	provider.sent++
+	id := fmt.Sprintf("local-%d", provider.sent)
+	return id, writeSms(provider.Writer, id, to, body)
+}
+
+// FileSmsProvider appends the text messages to a file, opening & closing it
+// for each one so nothing is left unwritten when the process stops
+type FileSmsProvider struct {
+	Path string
+	sent int
+}
+
+func (provider *FileSmsProvider) SendSms(to string, body string) (string, error) {
+	f, err := os.OpenFile(provider.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	provider.sent++
+	id := fmt.Sprintf("local-%d", provider.sent)
+	err = writeSms(f, id, to, body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return id, err
+}
+
+func writeSms(writer io.Writer, id string, to string, body string) error {
+	_, err := fmt.Fprintf(writer, "----- %s | to: %s\n%s\n", id, to, body)
+	return err
+}
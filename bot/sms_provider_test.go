@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSmsProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rsvper")
+	if err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	provider, err := newSmsProvider("file", filepath.Join(dir, "sms.txt"))
+	if err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	for _, body := range []string{"first", "second"} {
+		if _, err := provider.SendSms("+15555550100", body); err != nil {
+			t.Fatalf("Error: +%v", err)
+		}
+	}
+	written, err := ioutil.ReadFile(filepath.Join(dir, "sms.txt"))
+	if err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if !strings.Contains(string(written), "local-1 | to: +15555550100\nfirst\n") || !strings.Contains(string(written), "local-2 | to: +15555550100\nsecond\n") {
+		t.Errorf("Expected both texts in the file, got: %s", written)
+	}
+}
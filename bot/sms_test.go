@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var mockTwilioSmsRequest = events.APIGatewayProxyRequest{
+	Path:    "/sms",
+	Headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+	Body:    "ToCountry=US&SmsMessageSid=SM1f0e8ae6ade43cb3c0ce4525424e404f&Body=300&From=%2B15555550100&To=%2B15555550199&MessageSid=SM1f0e8ae6ade43cb3c0ce4525424e404f&NumMedia=0",
+}
+
+func TestParseSmsMessage(t *testing.T) {
+	tests := map[string]smsInput{
+		"Yes!":                            {kind: SMS_YES},
+		"yes please":                      {kind: SMS_YES},
+		"Not now":                         {kind: SMS_NO},
+		"300":                             {kind: SMS_NUMBER, number: 300},
+		"we'll be 4":                      {kind: SMS_NUMBER, number: 4},
+		"Four people":                     {kind: SMS_NUMBER, number: 4},
+		"none of us":                      {kind: SMS_NUMBER, number: 0},
+		"start over":                      {kind: SMS_RESTART},
+		"late-k7q2":                       {kind: SMS_OVERRIDE_CODE, code: "LATE-K7Q2"},
+		"what is this?":                   {kind: SMS_OTHER},
+		"When is my shuttle on the 14th?": {kind: SMS_SHUTTLE},
+		"Which table am I at?":            {kind: SMS_TABLE},
+		"Can I bring a plus one?":         {kind: SMS_SEAT_REQUEST},
+		"2 extra seats for the wedding":   {kind: SMS_SEAT_REQUEST},
+	}
+	for body, expected := range tests {
+		if input := parseSmsMessage(body); input != expected {
+			t.Errorf("Expected %q to parse as +%v, got +%v", body, expected, input)
+		}
+	}
+}
+
+func TestParseTwilioForm(t *testing.T) {
+	form, err := parseTwilioForm(mockTwilioSmsRequest)
+	if err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if form.Get("From") != "+15555550100" || form.Get("Body") != "300" {
+		t.Errorf("Unexpected form values: +%v", form)
+	}
+}
+
+func TestIsValidTwilioRequest(t *testing.T) {
+	// Example from https://www.twilio.com/docs/usage/security#validating-requests
+	form := url.Values{"CallSid": {"CA1234567890ABCDE"}, "Caller": {"+12349013030"}, "Digits": {"1234"}, "From": {"+12349013030"}, "To": {"+18005551212"}}
+	request := events.APIGatewayProxyRequest{Headers: map[string]string{"X-Twilio-Signature": "0/KCTR6DLpKmkAf8muzZqo1nDgQ="}}
+
+	os.Setenv("TWILIO_AUTH_TOKEN", "12345")
+	defer os.Unsetenv("TWILIO_AUTH_TOKEN")
+	if !isValidTwilioRequest("https://mycompany.com/myapp.php?foo=1&bar=2", request, form) {
+		t.Error("Expected the signature to be valid")
+	}
+	form.Add("Digits", "5678")
+	if isValidTwilioRequest("https://mycompany.com/myapp.php?foo=1&bar=2", request, form) {
+		t.Error("Expected every value of a repeated parameter to be signed")
+	}
+	repeated := url.Values{"To": {"+18005551212"}, "MediaUrl": {"b", "a"}}
+	repeatedRequest := events.APIGatewayProxyRequest{Headers: map[string]string{"X-Twilio-Signature": "LekJF3VEMPwHmW1wE3lznB6wgHE="}}
+	if !isValidTwilioRequest("https://example.com/sms", repeatedRequest, repeated) {
+		t.Error("Expected the signature of a repeated parameter to be valid")
+	}
+	form.Set("Digits", "4321")
+	if isValidTwilioRequest("https://mycompany.com/myapp.php?foo=1&bar=2", request, form) {
+		t.Error("Expected the signature to be invalid")
+	}
+
+	os.Unsetenv("TWILIO_AUTH_TOKEN")
+	if isValidTwilioRequest("https://mycompany.com/myapp.php?foo=1&bar=2", request, form) {
+		t.Error("Expected requests to be refused without TWILIO_AUTH_TOKEN")
+	}
+	os.Setenv("TWILIO_SKIP_VALIDATION", "true")
+	defer os.Unsetenv("TWILIO_SKIP_VALIDATION")
+	if !isValidTwilioRequest("https://mycompany.com/myapp.php?foo=1&bar=2", request, form) {
+		t.Error("Expected the signature check to be skipped with TWILIO_SKIP_VALIDATION")
+	}
+}
+
+func TestConversationRsvps(t *testing.T) {
+	rsvps := map[Event]int{Wedding: 4, Vidhi: 0}
+	cell := formatConversationRsvps(rsvps)
+	if cell != "VIDHI=0,WEDDING=4" {
+		t.Errorf("Unexpected rsvps cell: %s", cell)
+	}
+	parsed := parseConversationRsvps(cell)
+	if len(parsed) != 2 || parsed[Wedding] != 4 || parsed[Vidhi] != 0 {
+		t.Errorf("Unexpected parsed rsvps: +%v", parsed)
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+// GuestStore is where the invited families & their RSVPs are kept. The bot,
+// the commands and the admin API all go through it.
+type GuestStore interface {
+	AllFamilies() ([]InvitedFamily, error)
+	FindFamily(inviteCode int) (InvitedFamily, bool, error)
+	AddFamily(invitedFamily InvitedFamily) error
+	// UpdateFamily overwrites the family with the same invite code, including its RSVP counts
+	UpdateFamily(invitedFamily InvitedFamily) error
+	DeleteFamily(inviteCode int) error
+	// SaveRsvps logs the RSVPs in the family's history and updates their RSVP
+	// counts. children has how many of the RSVP'd are children, for the RSVPs
+	// that were split; it's unknown (NULL_INVITEES) for the others.
+	SaveRsvps(inviteCode int, phoneNumber string, rsvps map[Event]int, children map[Event]int) error
+	RsvpHistory(inviteCode int) ([]RsvpUpdate, error)
+}
+
+// RsvpUpdate is one RSVP change from the UPDATE_EVENT sheet
+type RsvpUpdate struct {
+	InviteCode   int    `json:"inviteCode"`
+	PhoneNumber  string `json:"phoneNumber"`
+	Event        string `json:"event"`
+	Attendees    int    `json:"attendees"`
+	Children     int    `json:"children"` // how many of the attendees are children (NULL_INVITEES when the RSVP wasn't split)
+	Timestamp    string `json:"timestamp"`
+	SessionID    string `json:"sessionId"`
+	OverrideCode string `json:"overrideCode,omitempty"`
+}
+
+var guestStore GuestStore = &sheetsStore{}
+
+// newGuestStore picks the store with GUEST_STORE, sheets (the default), bolt or dynamodb
+func newGuestStore() (GuestStore, error) {
+	switch os.Getenv("GUEST_STORE") {
+	case "", "sheets":
+		return &sheetsStore{}, nil
+	case "bolt":
+		return openBoltStore(envOrDefault("BOLT_DB_PATH", DEFAULT_BOLT_DB_PATH))
+	case "dynamodb":
+		return newDynamoStore()
+	}
+	return nil, fmt.Errorf("unknown GUEST_STORE %q, use sheets, bolt or dynamodb", os.Getenv("GUEST_STORE"))
+}
+
+func envOrDefault(key string, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// sheetsStore keeps the families in INVITED_FAMILY and their RSVP history in UPDATE_EVENT
+type sheetsStore struct{}
+
+func (store *sheetsStore) AllFamilies() ([]InvitedFamily, error) {
+	return getAllInvitedFamilies()
+}
+
+func (store *sheetsStore) FindFamily(inviteCode int) (InvitedFamily, bool, error) {
+	wrappedInvitedFamily, rowNumber, columns, err := SearchForInvitedFamily(inviteCode)
+	if err != nil || rowNumber == 0 {
+		return InvitedFamily{}, false, err
+	}
+	invitedFamily, err := toInvitedFamily(wrappedInvitedFamily, columns)
+	if err != nil {
+		// Treat it like any other bad row, and let lint point it out
+		log.Printf("Skipping invited family with invite code %d as %v", inviteCode, err)
+		return InvitedFamily{}, false, nil
+	}
+	return invitedFamily, true, nil
+}
+
+func (store *sheetsStore) AddFamily(invitedFamily InvitedFamily) error {
+	return store.AddFamilies([]InvitedFamily{invitedFamily})
+}
+
+// AddFamilies reads INVITED_FAMILY once to check the invite codes are free,
+// appends the families in one go and indexes the new rows
+func (store *sheetsStore) AddFamilies(invitedFamilies []InvitedFamily) error {
+	if len(invitedFamilies) == 0 {
+		return nil
+	}
+	columns, existing, err := readInvitedFamilySheet()
+	if err != nil {
+		return err
+	}
+	used := make(map[string]bool)
+	for _, row := range existing {
+		used[fmt.Sprint(columns.cell(row, "Invite Code"))] = true
+	}
+
+	var rows [][]interface{}
+	for _, invitedFamily := range invitedFamilies {
+		inviteCode := strconv.Itoa(invitedFamily.InviteCode)
+		if used[inviteCode] {
+			return fmt.Errorf("invite code %d is already used", invitedFamily.InviteCode)
+		}
+		used[inviteCode] = true
+		// Cells of columns the bot doesn't know about are left empty
+		row := make([]interface{}, columns.width())
+		cells := invitedFamilyRow(invitedFamily)
+		for i, column := range guestListColumns() {
+			row[columns[column]] = cells[i]
+		}
+		rows = append(rows, row)
+	}
+	resp, err := appendGoogleSheetsData(INVITED_FAMILY, rows)
+	if err != nil {
+		return err
+	}
+	log.Printf("Http status code for adding %d invited families: +%v", len(rows), resp.HTTPStatusCode)
+
+	// So the new families are found without reading the whole sheet
+	if resp.Updates == nil {
+		return nil
+	}
+	firstRow := rowNumberOfRange(resp.Updates.UpdatedRange)
+	if err := indexInvitedFamilyRows(invitedFamilies, firstRow); err != nil {
+		log.Printf("Unable to index the %d new invited families: %v", len(rows), err)
+	}
+	return nil
+}
+
+func (store *sheetsStore) UpdateFamily(invitedFamily InvitedFamily) error {
+	_, rowNumber, columns, err := SearchForInvitedFamily(invitedFamily.InviteCode)
+	if err != nil {
+		return err
+	}
+	if rowNumber == 0 {
+		return fmt.Errorf("no invited family with invite code %d", invitedFamily.InviteCode)
+	}
+	// Each cell is written on its own, so columns the bot doesn't know about are left alone
+	var batchValues []*sheets.ValueRange
+	cells := invitedFamilyRow(invitedFamily)
+	for i, column := range guestListColumns() {
+		writeRange := INVITED_FAMILY + "!" + columns.letter(column) + strconv.Itoa(rowNumber)
+		batchValues = append(batchValues, &sheets.ValueRange{Values: [][]interface{}{{cells[i]}}, Range: writeRange})
+	}
+	resp, err := setGoogleSheetsData(batchValues)
+	if err == nil {
+		log.Printf("Http status code for updating invited family %d: +%v", invitedFamily.InviteCode, resp.HTTPStatusCode)
+	}
+	return err
+}
+
+func (store *sheetsStore) DeleteFamily(inviteCode int) error {
+	_, rowNumber, _, err := SearchForInvitedFamily(inviteCode)
+	if err != nil {
+		return err
+	}
+	if rowNumber == 0 {
+		return fmt.Errorf("no invited family with invite code %d", inviteCode)
+	}
+	return deleteGoogleSheetsRow(INVITED_FAMILY, rowNumber)
+}
+
+func (store *sheetsStore) SaveRsvps(inviteCode int, phoneNumber string, rsvps map[Event]int, children map[Event]int) error {
+	resp, err := createUpdateEvents(strconv.Itoa(inviteCode), phoneNumber, rsvps, children)
+	if err != nil {
+		return err
+	}
+	log.Printf("Http status code for appending an update event: +%v", resp.HTTPStatusCode)
+
+	batchResp, err := updateInvitedFamilyRsvp(inviteCode, rsvps, children)
+	if err != nil {
+		return err
+	}
+	log.Printf("Http status code for updating invited family RSVP: +%v", batchResp.HTTPStatusCode)
+	return nil
+}
+
+func (store *sheetsStore) RsvpHistory(inviteCode int) ([]RsvpUpdate, error) {
+	updates, err := store.AllRsvpUpdates()
+	if err != nil {
+		return nil, err
+	}
+	var history []RsvpUpdate
+	for _, update := range updates {
+		if update.InviteCode == inviteCode {
+			history = append(history, update)
+		}
+	}
+	return history, nil
+}
+
+// AllRsvpUpdates is every RSVP in UPDATE_EVENT, oldest first
+func (store *sheetsStore) AllRsvpUpdates() ([]RsvpUpdate, error) {
+	rows, err := getGoogleSheetsData(UPDATE_EVENT, "A2:J")
+	if err != nil {
+		return nil, err
+	}
+	var updates []RsvpUpdate
+	for _, row := range rows {
+		if len(row) < 5 {
+			continue
+		}
+		inviteCode, err := strconv.Atoi(fmt.Sprint(row[0]))
+		if err != nil {
+			continue
+		}
+		attendees, _ := strconv.Atoi(fmt.Sprint(row[3]))
+		update := RsvpUpdate{
+			InviteCode:  inviteCode,
+			PhoneNumber: fmt.Sprint(row[1]),
+			Event:       fmt.Sprint(row[2]),
+			Attendees:   attendees,
+			Children:    NULL_INVITEES,
+			Timestamp:   fmt.Sprint(row[4]),
+		}
+		if len(row) > 5 {
+			update.SessionID = fmt.Sprint(row[5])
+		}
+		if len(row) > 8 {
+			update.OverrideCode = fmt.Sprint(row[8])
+		}
+		if len(row) > 9 {
+			update.Children = parseChildrenCell(row[9])
+		}
+		updates = append(updates, update)
+	}
+	return updates, nil
+}
+
+// AppendRsvpUpdates adds RSVPs made elsewhere (i.e. the bolt store) to
+// UPDATE_EVENT, without changing the RSVP counts in INVITED_FAMILY
+func (store *sheetsStore) AppendRsvpUpdates(updates []RsvpUpdate) error {
+	var rows [][]interface{}
+	for _, update := range updates {
+		var children interface{} = ""
+		if update.Children != NULL_INVITEES {
+			children = update.Children
+		}
+		rows = append(rows, []interface{}{update.InviteCode, update.PhoneNumber, update.Event, update.Attendees, update.Timestamp, update.SessionID, "", "", update.OverrideCode, children})
+	}
+	resp, err := appendGoogleSheetsData(UPDATE_EVENT, rows)
+	if err == nil {
+		log.Printf("Http status code for appending %d update events: +%v", len(rows), resp.HTTPStatusCode)
+	}
+	return err
+}
+
+// invitedFamilyRow is the family's INVITED_FAMILY cells, in the order of
+// guestListColumns, with ALL & NULL written back the way they're read by toInvitedFamily
+func invitedFamilyRow(invitedFamily InvitedFamily) []interface{} {
+	row := []interface{}{invitedFamily.Origin, invitedFamily.Name, invitedFamily.InviteName, invitedFamily.InviteCode}
+	for _, event := range AllEvents {
+		row = append(row, formatInvitedCell(invitedFamily.invitedTo(event)), formatRsvpCell(invitedFamily.rsvpdTo(event)))
+	}
+	for _, event := range AllEvents {
+		if event.CountsChildren {
+			row = append(row, formatInvitedCell(invitedFamily.childrenInvitedTo(event)), formatRsvpCell(invitedFamily.childrenRsvpdTo(event)))
+		}
+	}
+	return row
+}
+
+func formatInvitedCell(invited int) interface{} {
+	switch invited {
+	case MAX_INVITEES:
+		return "ALL"
+	case 0:
+		return "NULL"
+	}
+	return invited
+}
+
+func formatRsvpCell(rsvpd int) interface{} {
+	if rsvpd == NULL_INVITEES {
+		return "NULL"
+	}
+	return rsvpd
+}
+
+// deleteGoogleSheetsRow removes the row, moving the rows below it up. Any
+// developer metadata on the row (i.e. its invite code index entry) goes with it.
+func deleteGoogleSheetsRow(sheetName string, rowNumber int) error {
+	return deleteGoogleSheetsRows(sheetName, []int{rowNumber})
+}
+
+// replaceFamilyEventRows replaces the family's rows for the event in a sheet
+// that starts with the invite code & event columns (i.e. ATTENDEES)
+func replaceFamilyEventRows(sheetName string, inviteCode int, event Event, newRows [][]interface{}) error {
+	return replaceMatchingRows(sheetName, newRows, func(row []interface{}) bool {
+		return len(row) >= 2 && fmt.Sprint(row[0]) == strconv.Itoa(inviteCode) && strings.EqualFold(fmt.Sprint(row[1]), event.Name)
+	})
+}
+
+// replaceFamilyRows replaces the family's rows in a sheet that starts with the
+// invite code column (i.e. ACCESSIBILITY)
+func replaceFamilyRows(sheetName string, inviteCode int, newRows [][]interface{}) error {
+	return replaceMatchingRows(sheetName, newRows, func(row []interface{}) bool {
+		return len(row) >= 1 && fmt.Sprint(row[0]) == strconv.Itoa(inviteCode)
+	})
+}
+
+// replaceMatchingRows deletes the rows that match (going by cols A & B) and
+// appends the new rows
+func replaceMatchingRows(sheetName string, newRows [][]interface{}, matches func(row []interface{}) bool) error {
+	rows, err := getGoogleSheetsData(sheetName, "A2:B")
+	if err != nil {
+		return err
+	}
+	var rowNumbers []int
+	for i, row := range rows {
+		if matches(row) {
+			rowNumbers = append(rowNumbers, i+2) // 1 for header & 1 to convert from 0-based to 1-based
+		}
+	}
+	if len(rowNumbers) > 0 {
+		if err := deleteGoogleSheetsRows(sheetName, rowNumbers); err != nil {
+			return err
+		}
+	}
+	if len(newRows) == 0 {
+		return nil
+	}
+	resp, err := appendGoogleSheetsData(sheetName, newRows)
+	if err == nil {
+		log.Printf("Http status code for saving %d %s rows: +%v", len(newRows), sheetName, resp.HTTPStatusCode)
+	}
+	return err
+}
+
+// deleteGoogleSheetsRows removes the rows in one batch
+func deleteGoogleSheetsRows(sheetName string, rowNumbers []int) error {
+	sheetID, err := getSheetID(sheetName)
+	if err != nil {
+		return err
+	}
+	// From the bottom up, so the rows still to be deleted don't move
+	sorted := append([]int{}, rowNumbers...)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	var requests []*sheets.Request
+	for _, rowNumber := range sorted {
+		requests = append(requests, &sheets.Request{DeleteDimension: &sheets.DeleteDimensionRequest{Range: &sheets.DimensionRange{
+			SheetId:    sheetID,
+			Dimension:  "ROWS",
+			StartIndex: int64(rowNumber - 1), // 0-based & end exclusive
+			EndIndex:   int64(rowNumber),
+		}}})
+	}
+	_, err = getGoogleSheetsClient().Spreadsheets.BatchUpdate(spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}).Do()
+	return err
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	SYNC_STATUS_KEY     = "status"
+	SYNC_LOG_PUSHED_KEY = "log_pushed" // sequence of the last update log entry appended to the sheet
+
+	PREFER_LOCAL = "local"
+	PREFER_SHEET = "sheet"
+)
+
+// syncTarget is what the bolt store is synced with, the spreadsheet
+type syncTarget interface {
+	AllFamilies() ([]InvitedFamily, error)
+	AddFamily(invitedFamily InvitedFamily) error
+	UpdateFamily(invitedFamily InvitedFamily) error
+	DeleteFamily(inviteCode int) error
+	AllRsvpUpdates() ([]RsvpUpdate, error)
+	AppendRsvpUpdates(updates []RsvpUpdate) error
+}
+
+// SyncConflict is a family that was changed both here & in the sheet since
+// the last sync. It's left alone until it's resolved with -prefer.
+type SyncConflict struct {
+	InviteCode int      `json:"inviteCode"`
+	Reason     string   `json:"reason"`
+	Local      []string `json:"local,omitempty"` // INVITED_FAMILY cells, empty when deleted
+	Sheet      []string `json:"sheet,omitempty"`
+}
+
+// SyncStatus is the outcome of the last sync
+type SyncStatus struct {
+	StartedAt   time.Time      `json:"startedAt"`
+	FinishedAt  time.Time      `json:"finishedAt"`
+	Pushed      int            `json:"pushed"`      // families added, changed or deleted in the sheet
+	Pulled      int            `json:"pulled"`      // families added, changed or deleted here
+	PushedRsvps int            `json:"pushedRsvps"` // update log entries appended to UPDATE_EVENT
+	Conflicts   []SyncConflict `json:"conflicts"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// sync pushes the changes made here to the sheet & pulls the host's edits
+// back. Families changed on both sides are conflicts, resolved in favour of
+// prefer (PREFER_LOCAL or PREFER_SHEET) or else left for the host.
+func (store *boltStore) sync(target syncTarget, prefer string) (SyncStatus, error) {
+	status := SyncStatus{StartedAt: time.Now(), Conflicts: []SyncConflict{}}
+	err := store.syncFamilies(target, prefer, &status)
+	if err == nil {
+		err = store.syncUpdateLog(target, &status)
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	status.FinishedAt = time.Now()
+	if saveErr := store.saveSyncStatus(status); err == nil {
+		err = saveErr
+	}
+	return status, err
+}
+
+func (store *boltStore) syncFamilies(target syncTarget, prefer string, status *SyncStatus) error {
+	sheetFamilies, err := target.AllFamilies()
+	if err != nil {
+		return err
+	}
+	inSheet := make(map[int]InvitedFamily)
+	for _, invitedFamily := range sheetFamilies {
+		inSheet[invitedFamily.InviteCode] = invitedFamily
+	}
+	local := make(map[int]storedFamily)
+	err = store.db.View(func(tx *bolt.Tx) error {
+		return forEachStoredFamily(tx, func(family storedFamily) error {
+			local[family.InviteCode] = family
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	var inviteCodes []int
+	for inviteCode := range local {
+		inviteCodes = append(inviteCodes, inviteCode)
+	}
+	for inviteCode := range inSheet {
+		if _, ok := local[inviteCode]; !ok {
+			inviteCodes = append(inviteCodes, inviteCode)
+		}
+	}
+	sort.Ints(inviteCodes)
+
+	for _, inviteCode := range inviteCodes {
+		family, isLocal := local[inviteCode]
+		sheetFamily, isInSheet := inSheet[inviteCode]
+		if err := store.syncFamily(target, family, isLocal, sheetFamily, isInSheet, prefer, status); err != nil {
+			return fmt.Errorf("unable to sync invite code %d: %v", inviteCode, err)
+		}
+	}
+	return nil
+}
+
+func (store *boltStore) syncFamily(target syncTarget, family storedFamily, isLocal bool, sheetFamily InvitedFamily, isInSheet bool, prefer string, status *SyncStatus) error {
+	var localRecord, sheetRecord []string
+	if isLocal && !family.Deleted {
+		localRecord = guestListRecord(family.invitedFamily())
+	}
+	if isInSheet {
+		sheetRecord = guestListRecord(sheetFamily)
+	}
+	wasSynced := family.SyncedRecord != nil
+	localChanged := family.Version != family.SyncedVersion
+	sheetChanged := !sameRecord(sheetRecord, family.SyncedRecord)
+
+	push := func() error {
+		var err error
+		switch {
+		case family.Deleted:
+			err = target.DeleteFamily(family.InviteCode)
+		case isInSheet:
+			err = target.UpdateFamily(family.invitedFamily())
+		default:
+			err = target.AddFamily(family.invitedFamily())
+		}
+		if err != nil {
+			return err
+		}
+		status.Pushed++
+		return store.markSynced(family, localRecord)
+	}
+	pull := func() error {
+		status.Pulled++
+		return store.pullFamily(family, sheetFamily, isInSheet, sheetRecord)
+	}
+	conflict := func(reason string) error {
+		switch prefer {
+		case PREFER_LOCAL:
+			return push()
+		case PREFER_SHEET:
+			return pull()
+		}
+		status.Conflicts = append(status.Conflicts, SyncConflict{InviteCode: family.InviteCode, Reason: reason, Local: localRecord, Sheet: sheetRecord})
+		return nil
+	}
+	if !isLocal {
+		family.InviteCode = sheetFamily.InviteCode
+	}
+
+	switch {
+	case !isLocal:
+		return pull()
+	case sameRecord(localRecord, sheetRecord):
+		// Both sides ended up the same
+		if localChanged || sheetChanged {
+			return store.markSynced(family, localRecord)
+		}
+		return nil
+	case !wasSynced && !isInSheet:
+		return push()
+	case !wasSynced:
+		return conflict("added here & in the sheet")
+	case !isInSheet && !localChanged:
+		// Could be a row the sheets store can't read, so it's up to the host
+		return conflict("not in the sheet anymore (deleted, or a row lint can't read)")
+	case !isInSheet:
+		return conflict("changed here but not in the sheet anymore")
+	case localChanged && sheetChanged && family.Deleted:
+		return conflict("deleted here but changed in the sheet")
+	case localChanged && sheetChanged:
+		return conflict("changed here & in the sheet")
+	case localChanged:
+		return push()
+	case sheetChanged:
+		return pull()
+	}
+	return nil
+}
+
+// markSynced records the family's version & cells as being in the sheet. If
+// the family was changed again during the sync, it's pushed next time.
+func (store *boltStore) markSynced(synced storedFamily, record []string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		family, ok, err := getStoredFamily(tx, synced.InviteCode)
+		if err != nil || !ok {
+			return err
+		}
+		if family.Deleted && family.Version == synced.Version {
+			return tx.Bucket([]byte(FAMILIES_BUCKET)).Delete(familyKey(family.InviteCode))
+		}
+		family.SyncedVersion = synced.Version
+		family.SyncedRecord = record
+		return putStoredFamily(tx, family)
+	})
+}
+
+// pullFamily copies the sheet's family here, unless it was changed here during
+// the sync (then it's a conflict next time)
+func (store *boltStore) pullFamily(pulled storedFamily, sheetFamily InvitedFamily, isInSheet bool, record []string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		family, ok, err := getStoredFamily(tx, pulled.InviteCode)
+		if err != nil || family.Version != pulled.Version {
+			return err
+		}
+		if !isInSheet {
+			if !ok {
+				return nil
+			}
+			return tx.Bucket([]byte(FAMILIES_BUCKET)).Delete(familyKey(family.InviteCode))
+		}
+		family.setInvitedFamily(sheetFamily)
+		family.Deleted = false
+		family.SyncedVersion = family.Version
+		family.SyncedRecord = record
+		return putStoredFamily(tx, family)
+	})
+}
+
+func sameRecord(a []string, b []string) bool {
+	return strings.Join(a, "\x00") == strings.Join(b, "\x00") && (a == nil) == (b == nil)
+}
+
+// syncUpdateLog appends the RSVPs logged since the last sync to UPDATE_EVENT.
+// The first sync into an empty log copies the sheet's RSVP history instead.
+func (store *boltStore) syncUpdateLog(target syncTarget, status *SyncStatus) error {
+	if _, err := store.lastSyncStatus(); err == errNeverSynced && store.updateLogIsEmpty() {
+		updates, err := target.AllRsvpUpdates()
+		if err != nil {
+			return err
+		}
+		return store.db.Update(func(tx *bolt.Tx) error {
+			for _, update := range updates {
+				if err := appendStoredUpdate(tx, update); err != nil {
+					return err
+				}
+			}
+			return setLogPushed(tx, tx.Bucket([]byte(UPDATE_LOG_BUCKET)).Sequence())
+		})
+	}
+
+	var updates []RsvpUpdate
+	var last uint64
+	err := store.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket([]byte(UPDATE_LOG_BUCKET)).Cursor()
+		start := make([]byte, 8)
+		binary.BigEndian.PutUint64(start, logPushed(tx)+1)
+		for key, value := cursor.Seek(start); key != nil; key, value = cursor.Next() {
+			var update RsvpUpdate
+			if err := json.Unmarshal(value, &update); err != nil {
+				return err
+			}
+			updates = append(updates, update)
+			last = binary.BigEndian.Uint64(key)
+		}
+		return nil
+	})
+	if err != nil || len(updates) == 0 {
+		return err
+	}
+	if err := target.AppendRsvpUpdates(updates); err != nil {
+		return err
+	}
+	status.PushedRsvps = len(updates)
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return setLogPushed(tx, last)
+	})
+}
+
+func (store *boltStore) updateLogIsEmpty() bool {
+	var empty bool
+	store.db.View(func(tx *bolt.Tx) error {
+		empty = tx.Bucket([]byte(UPDATE_LOG_BUCKET)).Sequence() == 0
+		return nil
+	})
+	return empty
+}
+
+func logPushed(tx *bolt.Tx) uint64 {
+	value := tx.Bucket([]byte(SYNC_BUCKET)).Get([]byte(SYNC_LOG_PUSHED_KEY))
+	if len(value) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(value)
+}
+
+func setLogPushed(tx *bolt.Tx, sequence uint64) error {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, sequence)
+	return tx.Bucket([]byte(SYNC_BUCKET)).Put([]byte(SYNC_LOG_PUSHED_KEY), value)
+}
+
+var errNeverSynced = fmt.Errorf("never synced")
+
+func (store *boltStore) lastSyncStatus() (SyncStatus, error) {
+	var status SyncStatus
+	err := store.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket([]byte(SYNC_BUCKET)).Get([]byte(SYNC_STATUS_KEY))
+		if value == nil {
+			return errNeverSynced
+		}
+		return json.Unmarshal(value, &status)
+	})
+	return status, err
+}
+
+func (store *boltStore) saveSyncStatus(status SyncStatus) error {
+	value, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(SYNC_BUCKET)).Put([]byte(SYNC_STATUS_KEY), value)
+	})
+}
+
+// pendingChanges counts the families & RSVPs changed here that aren't in the sheet yet
+func (store *boltStore) pendingChanges() (int, int, error) {
+	var families, rsvps int
+	err := store.db.View(func(tx *bolt.Tx) error {
+		rsvps = int(tx.Bucket([]byte(UPDATE_LOG_BUCKET)).Sequence() - logPushed(tx))
+		return forEachStoredFamily(tx, func(family storedFamily) error {
+			if family.Version != family.SyncedVersion {
+				families++
+			}
+			return nil
+		})
+	})
+	return families, rsvps, err
+}
+
+func writeSyncStatus(writer io.Writer, status SyncStatus, pendingFamilies int, pendingRsvps int) {
+	fmt.Fprintf(writer, "Last sync: %s (took %s)\n", status.StartedAt.Format(time.RFC1123), status.FinishedAt.Sub(status.StartedAt).Round(time.Millisecond))
+	if status.Error != "" {
+		fmt.Fprintf(writer, "Failed: %s\n", status.Error)
+	}
+	fmt.Fprintf(writer, "Pushed %d families & %d RSVPs to the sheet, pulled %d families\n", status.Pushed, status.PushedRsvps, status.Pulled)
+	fmt.Fprintf(writer, "Waiting to be pushed: %d families & %d RSVPs\n", pendingFamilies, pendingRsvps)
+	fmt.Fprintf(writer, "%d conflicts\n", len(status.Conflicts))
+	for _, conflict := range status.Conflicts {
+		fmt.Fprintf(writer, "! %d %s\n", conflict.InviteCode, conflict.Reason)
+		fmt.Fprintf(writer, "    here:  %s\n", describeRecord(conflict.Local))
+		fmt.Fprintf(writer, "    sheet: %s\n", describeRecord(conflict.Sheet))
+	}
+}
+
+func describeRecord(record []string) string {
+	if record == nil {
+		return "(deleted)"
+	}
+	var cells []string
+	for i, column := range guestListColumns() {
+		cells = append(cells, column+"="+record[i])
+	}
+	return strings.Join(cells, ", ")
+}
+
+func openSyncedBoltStore() (*boltStore, error) {
+	store, ok := guestStore.(*boltStore)
+	if !ok {
+		return nil, fmt.Errorf("only the bolt store is synced, set GUEST_STORE=bolt")
+	}
+	return store, nil
+}
+
+func syncCommand(args []string) error {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	every := flags.Duration("every", 0, "keep syncing, i.e. every 5m (default sync once)")
+	prefer := flags.String("prefer", "", "resolve conflicts with the family as it is here (local) or in the sheet (sheet)")
+	flags.Parse(args)
+
+	if *prefer != "" && *prefer != PREFER_LOCAL && *prefer != PREFER_SHEET {
+		return fmt.Errorf("-prefer has to be %s or %s", PREFER_LOCAL, PREFER_SHEET)
+	}
+	store, err := openSyncedBoltStore()
+	if err != nil {
+		return err
+	}
+
+	for {
+		err := syncOnce(store, *prefer)
+		if *every == 0 {
+			return err
+		}
+		if err != nil {
+			log.Printf("Sync failed: %v", err)
+		}
+		time.Sleep(*every)
+	}
+}
+
+// syncOnce syncs the bolt store with the spreadsheet & logs what changed
+func syncOnce(store *boltStore, prefer string) error {
+	status, err := store.sync(&sheetsStore{}, prefer)
+	if err != nil {
+		return err
+	}
+	log.Printf("Synced, pushed %d families & %d RSVPs, pulled %d families, %d conflicts", status.Pushed, status.PushedRsvps, status.Pulled, len(status.Conflicts))
+	return nil
+}
+
+func syncStatusCommand(args []string) error {
+	flags := flag.NewFlagSet("sync-status", flag.ExitOnError)
+	flags.Parse(args)
+
+	store, err := openSyncedBoltStore()
+	if err != nil {
+		return err
+	}
+	status, err := store.lastSyncStatus()
+	if err == errNeverSynced {
+		fmt.Println("Never synced, run sync to copy the sheet into the bolt store")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	pendingFamilies, pendingRsvps, err := store.pendingChanges()
+	if err != nil {
+		return err
+	}
+	writeSyncStatus(os.Stdout, status, pendingFamilies, pendingRsvps)
+	return nil
+}
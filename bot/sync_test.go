@@ -0,0 +1,151 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openTestBoltStore(t *testing.T) (*boltStore, func()) {
+	dir, err := ioutil.TempDir("", "rsvper")
+	if err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	store, err := openBoltStore(filepath.Join(dir, "rsvper.db"))
+	if err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	return store, func() {
+		store.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func syncedFamily(inviteCode int, vidhiInvited int) InvitedFamily {
+	return InvitedFamily{
+		Origin: "Nairobi", Name: "Rajesh", InviteName: "The Patel Family", InviteCode: inviteCode,
+		VidhiInvited: vidhiInvited, VidhiRsvpd: NULL_INVITEES, GarbaRsvpd: NULL_INVITEES, WeddingRsvpd: NULL_INVITEES,
+	}
+}
+
+func TestBoltStoreSaveRsvps(t *testing.T) {
+	store, cleanup := openTestBoltStore(t)
+	defer cleanup()
+
+	if err := store.AddFamily(syncedFamily(7, 4)); err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if err := store.AddFamily(syncedFamily(7, 4)); err == nil {
+		t.Errorf("Expected adding invite code 7 twice to fail")
+	}
+	if err := store.SaveRsvps(7, "+15555550100", map[Event]int{Vidhi: 3}, nil); err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if err := store.SaveRsvps(8, "+15555550100", map[Event]int{Vidhi: 3}, nil); err == nil {
+		t.Errorf("Expected an RSVP for a missing family to fail")
+	}
+
+	invitedFamily, found, err := store.FindFamily(7)
+	if err != nil || !found {
+		t.Fatalf("Expected invite code 7 to be found, got: +%v", err)
+	}
+	if invitedFamily.VidhiRsvpd != 3 || invitedFamily.GarbaRsvpd != NULL_INVITEES {
+		t.Errorf("Unexpected RSVPs: +%v", invitedFamily)
+	}
+	history, err := store.RsvpHistory(7)
+	if err != nil || len(history) != 1 || history[0].Attendees != 3 || history[0].Event != Vidhi.Name {
+		t.Errorf("Unexpected history: +%v +%v", history, err)
+	}
+}
+
+func TestSyncPullsThenPushes(t *testing.T) {
+	store, cleanup := openTestBoltStore(t)
+	defer cleanup()
+	sheet := &memoryStore{
+		families: []InvitedFamily{syncedFamily(1, 2), syncedFamily(2, 5)},
+		history:  []RsvpUpdate{{InviteCode: 1, Event: Vidhi.Name, Attendees: 0}},
+	}
+
+	status, err := store.sync(sheet, "")
+	if err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if status.Pulled != 2 || status.Pushed != 0 || len(status.Conflicts) != 0 {
+		t.Errorf("Expected the first sync to pull both families, got: +%v", status)
+	}
+	if history, _ := store.RsvpHistory(1); len(history) != 1 {
+		t.Errorf("Expected the sheet's RSVP history to be copied, got: +%v", history)
+	}
+
+	store.SaveRsvps(1, "+15555550100", map[Event]int{Vidhi: 2}, nil)
+	store.AddFamily(syncedFamily(3, 1))
+	store.DeleteFamily(2)
+	if families, rsvps, _ := store.pendingChanges(); families != 3 || rsvps != 1 {
+		t.Errorf("Expected 3 families & 1 RSVP to be pending, got: %d & %d", families, rsvps)
+	}
+
+	status, err = store.sync(sheet, "")
+	if err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if status.Pushed != 3 || status.PushedRsvps != 1 || len(status.Conflicts) != 0 {
+		t.Errorf("Expected the changes to be pushed, got: +%v", status)
+	}
+	if len(sheet.families) != 2 || sheet.families[0].VidhiRsvpd != 2 || sheet.families[1].InviteCode != 3 {
+		t.Errorf("Unexpected families in the sheet: +%v", sheet.families)
+	}
+	if len(sheet.history) != 2 {
+		t.Errorf("Expected the RSVP to be appended to the sheet, got: +%v", sheet.history)
+	}
+	if families, rsvps, _ := store.pendingChanges(); families != 0 || rsvps != 0 {
+		t.Errorf("Expected nothing to be pending, got: %d & %d", families, rsvps)
+	}
+
+	// A host's edit comes back
+	sheet.families[1].Origin = "London"
+	status, _ = store.sync(sheet, "")
+	if invitedFamily, _, _ := store.FindFamily(3); status.Pulled != 1 || invitedFamily.Origin != "London" {
+		t.Errorf("Expected the host's edit to be pulled, got: +%v +%v", status, invitedFamily)
+	}
+}
+
+func TestSyncDetectsConflicts(t *testing.T) {
+	store, cleanup := openTestBoltStore(t)
+	defer cleanup()
+	sheet := &memoryStore{families: []InvitedFamily{syncedFamily(1, 2), syncedFamily(2, 5)}}
+	store.sync(sheet, "")
+
+	changed := syncedFamily(1, 3)
+	store.UpdateFamily(changed)
+	sheet.families[0].VidhiInvited = 4
+	sheet.DeleteFamily(2)
+
+	status, err := store.sync(sheet, "")
+	if err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if len(status.Conflicts) != 2 || status.Pushed != 0 || status.Pulled != 0 {
+		t.Fatalf("Expected 2 conflicts & nothing synced, got: +%v", status)
+	}
+	if status.Conflicts[0].InviteCode != 1 || status.Conflicts[1].InviteCode != 2 || status.Conflicts[1].Sheet != nil {
+		t.Errorf("Unexpected conflicts: +%v", status.Conflicts)
+	}
+	if lastStatus, err := store.lastSyncStatus(); err != nil || len(lastStatus.Conflicts) != 2 {
+		t.Errorf("Expected the conflicts to be in the sync status, got: +%v +%v", lastStatus, err)
+	}
+
+	status, err = store.sync(sheet, PREFER_SHEET)
+	if err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if len(status.Conflicts) != 0 || status.Pulled != 2 {
+		t.Errorf("Expected the conflicts to be resolved with the sheet, got: +%v", status)
+	}
+	if invitedFamily, _, _ := store.FindFamily(1); invitedFamily.VidhiInvited != 4 {
+		t.Errorf("Expected the sheet's Vidhi-Invite, got: +%v", invitedFamily)
+	}
+	if _, found, _ := store.FindFamily(2); found {
+		t.Errorf("Expected invite code 2 to be deleted")
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	dialogflow "google.golang.org/genproto/googleapis/cloud/dialogflow/v2"
+)
+
+const (
+	SHUTTLE_RUN = "SHUTTLE_RUN"
+	CARPOOL     = "CARPOOL"
+)
+
+// ShuttleRun is one trip of a shuttle from a hotel to an event
+type ShuttleRun struct {
+	Event   Event
+	Hotel   string
+	Departs time.Time
+	Seats   int
+}
+
+// ShuttlePassenger is a family's guests on a run (a family that doesn't fit
+// on one run is split over several)
+type ShuttlePassenger struct {
+	InviteCode int
+	InviteName string
+	Guests     int
+}
+
+// ShuttleManifest is who's on a run
+type ShuttleManifest struct {
+	Run        ShuttleRun
+	Passengers []ShuttlePassenger
+	SeatsTaken int
+}
+
+// staysAt is true when the family's room at the hotel covers the day
+func staysAt(assignments []RoomAssignment, inviteCode int, hotel string, day time.Time) bool {
+	for _, assignment := range assignments {
+		if assignment.InviteCode == inviteCode && strings.EqualFold(assignment.Hotel, hotel) && !day.Before(assignment.CheckIn) && !day.After(assignment.CheckOut) {
+			return true
+		}
+	}
+	return false
+}
+
+// planShuttles seats the guests staying at each hotel on the runs from that
+// hotel to the events they RSVP'd to, biggest families first. A family goes
+// on the earliest run they all fit on, or is split over the runs with seats
+// left when none has room for all of them. The guests left over (the runs need
+// more seats) are returned by run description, i.e. "WEDDING from Hyatt".
+func planShuttles(runs []ShuttleRun, assignments []RoomAssignment, invitedFamilies []InvitedFamily) ([]ShuttleManifest, map[string][]ShuttlePassenger) {
+	manifests := make([]ShuttleManifest, len(runs))
+	for i, run := range runs {
+		manifests[i].Run = run
+	}
+	sort.SliceStable(manifests, func(i, j int) bool { return manifests[i].Run.Departs.Before(manifests[j].Run.Departs) })
+
+	// The runs of each event from each hotel on each day are filled together
+	groups := make(map[string][]int)
+	var groupKeys []string
+	for i, manifest := range manifests {
+		key := manifest.Run.Event.Name + " from " + manifest.Run.Hotel + " on " + manifest.Run.Departs.Format(DATE_FORMAT)
+		if groups[key] == nil {
+			groupKeys = append(groupKeys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	families := append([]InvitedFamily{}, invitedFamilies...)
+	unseated := make(map[string][]ShuttlePassenger)
+	for _, key := range groupKeys {
+		first := manifests[groups[key][0]].Run
+		sort.SliceStable(families, func(i, j int) bool {
+			if guestsI, guestsJ := families[i].rsvpdTo(first.Event), families[j].rsvpdTo(first.Event); guestsI != guestsJ {
+				return guestsI > guestsJ
+			}
+			return families[i].InviteCode < families[j].InviteCode
+		})
+		for _, invitedFamily := range families {
+			guests := invitedFamily.rsvpdTo(first.Event)
+			if guests <= 0 || !staysAt(assignments, invitedFamily.InviteCode, first.Hotel, dateOnly(first.Departs)) {
+				continue
+			}
+			seat := func(i int, count int) {
+				manifests[i].Passengers = append(manifests[i].Passengers, ShuttlePassenger{InviteCode: invitedFamily.InviteCode, InviteName: invitedFamily.InviteName, Guests: count})
+				manifests[i].SeatsTaken += count
+				guests -= count
+			}
+			for _, i := range groups[key] {
+				if manifests[i].Run.Seats-manifests[i].SeatsTaken >= guests {
+					seat(i, guests)
+					break
+				}
+			}
+			for _, i := range groups[key] {
+				if left := manifests[i].Run.Seats - manifests[i].SeatsTaken; guests > 0 && left > 0 {
+					if left > guests {
+						left = guests
+					}
+					seat(i, left)
+				}
+			}
+			if guests > 0 {
+				description := first.Event.Name + " from " + first.Hotel
+				unseated[description] = append(unseated[description], ShuttlePassenger{InviteCode: invitedFamily.InviteCode, InviteName: invitedFamily.InviteName, Guests: guests})
+			}
+		}
+	}
+	return manifests, unseated
+}
+
+// familyShuttles are the runs the family is on, with how many of their seats
+// are on each
+func familyShuttles(manifests []ShuttleManifest, inviteCode int) ([]ShuttleRun, []int) {
+	var runs []ShuttleRun
+	var seats []int
+	for _, manifest := range manifests {
+		for _, passenger := range manifest.Passengers {
+			if passenger.InviteCode == inviteCode {
+				runs = append(runs, manifest.Run)
+				seats = append(seats, passenger.Guests)
+			}
+		}
+	}
+	return runs, seats
+}
+
+func readShuttleRuns() ([]ShuttleRun, error) {
+	rows, err := getGoogleSheetsData(SHUTTLE_RUN, "A2:D")
+	if err != nil {
+		return nil, err
+	}
+	var runs []ShuttleRun
+	for i, row := range rows {
+		if len(row) < 4 {
+			continue
+		}
+		event, ok := eventByName(fmt.Sprint(row[0]))
+		departs, departsErr := time.ParseInLocation(TRAVEL_TIME_FORMAT, strings.TrimSpace(fmt.Sprint(row[2])), time.Local)
+		seats, seatsErr := strconv.Atoi(fmt.Sprint(row[3]))
+		if !ok || departsErr != nil || seatsErr != nil {
+			log.Printf("Skipping shuttle run (%d) as its event isn't known, its departure isn't like 2019-03-16 16:00 or its seats aren't a number: %v", i+2, row)
+			continue
+		}
+		runs = append(runs, ShuttleRun{Event: event, Hotel: fmt.Sprint(row[1]), Departs: departs, Seats: seats})
+	}
+	return runs, nil
+}
+
+// currentShuttlePlan plans the shuttles from the sheets as they are now, so
+// the guests are always told the same runs as the hosts' manifest
+func currentShuttlePlan() ([]ShuttleManifest, map[string][]ShuttlePassenger, error) {
+	runs, err := readShuttleRuns()
+	if err != nil {
+		return nil, nil, err
+	}
+	assignments, err := readRoomAssignments()
+	if err != nil {
+		return nil, nil, err
+	}
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		return nil, nil, err
+	}
+	manifests, unseated := planShuttles(runs, assignments, invitedFamilies)
+	return manifests, unseated, nil
+}
+
+// shuttleAnswerMsg answers "when is my shuttle" for the family
+func shuttleAnswerMsg(inviteCode int) string {
+	manifests, _, err := currentShuttlePlan()
+	if err != nil {
+		log.Printf("Unable to plan the shuttles for invite code %d: %v", inviteCode, err)
+		return SHUTTLE_UNAVAILABLE_MSG
+	}
+	runs, seats := familyShuttles(manifests, inviteCode)
+	return shuttleScheduleMsg(runs, seats)
+}
+
+// ShuttleFulfillment answers the Dialogflow guest's "when is my shuttle"
+func ShuttleFulfillment(response *DialogflowResponse, contexts []*dialogflow.Context) {
+	inviteCode := getInviteCodeFromContext(contexts)
+	log.Printf("\nIntent: %s - Starting fulfillment for invite code: %d", intent, inviteCode)
+	if inviteCode == -1 {
+		response.Text(SHUTTLE_INVITE_CODE_MSG)
+		return
+	}
+	response.Text(shuttleAnswerMsg(inviteCode))
+}
+
+func writeShuttleManifests(writer io.Writer, manifests []ShuttleManifest, attendees map[int]map[string][]string, format string) error {
+	header := []string{"Event", "Hotel", "Departs", "Seats", "Seats Taken", "Invite Code", "Invite Name", "Guests", "Names"}
+	var records [][]string
+	for _, manifest := range manifests {
+		run := []string{manifest.Run.Event.Name, manifest.Run.Hotel, manifest.Run.Departs.Format(TRAVEL_TIME_FORMAT), strconv.Itoa(manifest.Run.Seats), strconv.Itoa(manifest.SeatsTaken)}
+		if len(manifest.Passengers) == 0 {
+			records = append(records, append(run, "", "", "", ""))
+		}
+		for _, passenger := range manifest.Passengers {
+			names := strings.Join(attendees[passenger.InviteCode][manifest.Run.Event.Name], ", ")
+			records = append(records, append(append([]string{}, run...), strconv.Itoa(passenger.InviteCode), passenger.InviteName, strconv.Itoa(passenger.Guests), names))
+		}
+	}
+	switch format {
+	case REPORT_TABLE:
+		table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, strings.Join(header, "\t"))
+		for _, record := range records {
+			fmt.Fprintln(table, strings.Join(record, "\t"))
+		}
+		return table.Flush()
+	case REPORT_CSV:
+		csvWriter := csv.NewWriter(writer)
+		csvWriter.Write(header)
+		csvWriter.WriteAll(records)
+		return csvWriter.Error()
+	}
+	return fmt.Errorf("unknown format %q, use table or csv", format)
+}
+
+func shuttleManifestCommand(args []string) error {
+	flags := flag.NewFlagSet("shuttle-manifest", flag.ExitOnError)
+	eventName := flags.String("event", "", "only list this event's runs, i.e. WEDDING (default all events)")
+	format := flags.String("format", REPORT_TABLE, "table or csv")
+	flags.Parse(args)
+
+	manifests, unseated, err := currentShuttlePlan()
+	if err != nil {
+		return err
+	}
+	if *eventName != "" {
+		event, ok := eventByName(*eventName)
+		if !ok {
+			return fmt.Errorf("unknown event %q", *eventName)
+		}
+		var eventManifests []ShuttleManifest
+		for _, manifest := range manifests {
+			if manifest.Run.Event == event {
+				eventManifests = append(eventManifests, manifest)
+			}
+		}
+		manifests = eventManifests
+	}
+	attendees, err := readAttendees()
+	if err != nil {
+		log.Printf("Listing the passengers without their names, as ATTENDEES couldn't be read: %v", err)
+	}
+	if err := writeShuttleManifests(os.Stdout, manifests, attendees, *format); err != nil {
+		return err
+	}
+	for description, passengers := range unseated {
+		for _, passenger := range passengers {
+			log.Printf("No seats for %d guests of invite code %d (%s): add a run or seats for the %s", passenger.Guests, passenger.InviteCode, passenger.InviteName, description)
+		}
+	}
+	return nil
+}
+
+// CarpoolEntry is a family that opted in to carpooling to an event (all of
+// them when EventName is empty), offering Seats in their car or needing a
+// ride when it's 0
+type CarpoolEntry struct {
+	InviteCode int
+	EventName  string
+	Seats      int
+}
+
+// CarpoolMatch is a driving family & the families riding with them
+type CarpoolMatch struct {
+	Event     string
+	Origin    string
+	Driver    int
+	Riders    []int
+	SeatsLeft int
+}
+
+func (entry CarpoolEntry) isFor(event Event) bool {
+	return entry.EventName == "" || strings.EqualFold(entry.EventName, event.Name)
+}
+
+// matchCarpools pairs the local families needing a ride to an event with the
+// ones driving to it from the same origin, biggest families first, each with
+// the driver that has the most seats left. Only families RSVP'd to the event
+// are matched, and a family rides all together. The riders left without a
+// driver are returned by event.
+func matchCarpools(entries []CarpoolEntry, invitedFamilies []InvitedFamily) ([]CarpoolMatch, map[string][]int) {
+	familiesByInviteCode := make(map[int]InvitedFamily)
+	for _, invitedFamily := range invitedFamilies {
+		familiesByInviteCode[invitedFamily.InviteCode] = invitedFamily
+	}
+
+	var matches []CarpoolMatch
+	unmatched := make(map[string][]int)
+	for _, event := range AllEvents {
+		drivers := make(map[string][]int) // index in matches by origin
+		var riders []CarpoolEntry
+		for _, entry := range entries {
+			invitedFamily, ok := familiesByInviteCode[entry.InviteCode]
+			if !ok || !entry.isFor(event) || invitedFamily.rsvpdTo(event) <= 0 || isOutOfTown(invitedFamily) {
+				continue
+			}
+			if entry.Seats == 0 {
+				riders = append(riders, entry)
+				continue
+			}
+			origin := strings.ToLower(strings.TrimSpace(invitedFamily.Origin))
+			drivers[origin] = append(drivers[origin], len(matches))
+			matches = append(matches, CarpoolMatch{Event: event.Name, Origin: invitedFamily.Origin, Driver: entry.InviteCode, SeatsLeft: entry.Seats})
+		}
+
+		guests := func(entry CarpoolEntry) int {
+			invitedFamily := familiesByInviteCode[entry.InviteCode]
+			return invitedFamily.rsvpdTo(event)
+		}
+		sort.SliceStable(riders, func(i, j int) bool { return guests(riders[i]) > guests(riders[j]) })
+		for _, rider := range riders {
+			best := -1
+			for _, i := range drivers[strings.ToLower(strings.TrimSpace(familiesByInviteCode[rider.InviteCode].Origin))] {
+				if matches[i].SeatsLeft >= guests(rider) && (best == -1 || matches[i].SeatsLeft > matches[best].SeatsLeft) {
+					best = i
+				}
+			}
+			if best == -1 {
+				unmatched[event.Name] = append(unmatched[event.Name], rider.InviteCode)
+				continue
+			}
+			matches[best].Riders = append(matches[best].Riders, rider.InviteCode)
+			matches[best].SeatsLeft -= guests(rider)
+		}
+	}
+	return matches, unmatched
+}
+
+func readCarpoolEntries() ([]CarpoolEntry, error) {
+	rows, err := getGoogleSheetsData(CARPOOL, "A2:C")
+	if err != nil {
+		return nil, err
+	}
+	var entries []CarpoolEntry
+	for i, row := range rows {
+		if len(row) < 3 {
+			continue
+		}
+		inviteCode, codeErr := strconv.Atoi(fmt.Sprint(row[0]))
+		seats, seatsErr := strconv.Atoi(fmt.Sprint(row[2]))
+		if codeErr != nil || seatsErr != nil {
+			log.Printf("Skipping carpool entry (%d) as its invite code or seats aren't numbers: %v", i+2, row)
+			continue
+		}
+		entries = append(entries, CarpoolEntry{InviteCode: inviteCode, EventName: strings.TrimSpace(fmt.Sprint(row[1])), Seats: seats})
+	}
+	return entries, nil
+}
+
+func carpoolMatchesCommand(args []string) error {
+	flags := flag.NewFlagSet("carpool-matches", flag.ExitOnError)
+	flags.Parse(args)
+
+	entries, err := readCarpoolEntries()
+	if err != nil {
+		return err
+	}
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		return err
+	}
+	inviteNames := make(map[int]string)
+	for _, invitedFamily := range invitedFamilies {
+		inviteNames[invitedFamily.InviteCode] = invitedFamily.InviteName
+	}
+	name := func(inviteCode int) string { return fmt.Sprintf("%s (%d)", inviteNames[inviteCode], inviteCode) }
+
+	matches, unmatched := matchCarpools(entries, invitedFamilies)
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "Event\tOrigin\tDriver\tRiders\tSeats Left")
+	for _, match := range matches {
+		var riders []string
+		for _, rider := range match.Riders {
+			riders = append(riders, name(rider))
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%d\n", match.Event, match.Origin, name(match.Driver), strings.Join(riders, ", "), match.SeatsLeft)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	for _, event := range AllEvents {
+		for _, rider := range unmatched[event.Name] {
+			fmt.Printf("No ride to the %s for %s\n", event.Name, name(rider))
+		}
+	}
+	return nil
+}
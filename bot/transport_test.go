@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPlanShuttles(t *testing.T) {
+	departs := time.Date(2019, 3, 16, 16, 0, 0, 0, time.Local)
+	day := dateOnly(departs)
+	runs := []ShuttleRun{
+		{Event: Wedding, Hotel: "Hyatt", Departs: departs.Add(30 * time.Minute), Seats: 4},
+		{Event: Wedding, Hotel: "Hyatt", Departs: departs, Seats: 6},
+	}
+	invitedFamilies := []InvitedFamily{
+		{InviteCode: 1, VidhiRsvpd: NULL_INVITEES, GarbaRsvpd: NULL_INVITEES, WeddingRsvpd: 2},
+		{InviteCode: 2, VidhiRsvpd: NULL_INVITEES, GarbaRsvpd: NULL_INVITEES, WeddingRsvpd: 5},
+		{InviteCode: 3, VidhiRsvpd: NULL_INVITEES, GarbaRsvpd: NULL_INVITEES, WeddingRsvpd: 4},
+		{InviteCode: 4, VidhiRsvpd: NULL_INVITEES, GarbaRsvpd: NULL_INVITEES, WeddingRsvpd: 3},
+		{InviteCode: 5, VidhiRsvpd: NULL_INVITEES, GarbaRsvpd: NULL_INVITEES, WeddingRsvpd: 0},
+	}
+	assignments := []RoomAssignment{
+		{InviteCode: 1, Hotel: "hyatt", CheckIn: day.AddDate(0, 0, -1), CheckOut: day},
+		{InviteCode: 2, Hotel: "Hyatt", CheckIn: day, CheckOut: day.AddDate(0, 0, 1)},
+		{InviteCode: 3, Hotel: "Hyatt", CheckIn: day, CheckOut: day},
+		{InviteCode: 4, Hotel: "Marriott", CheckIn: day, CheckOut: day},
+		{InviteCode: 5, Hotel: "Hyatt", CheckIn: day, CheckOut: day},
+	}
+
+	manifests, unseated := planShuttles(runs, assignments, invitedFamilies)
+	if len(manifests) != 2 || !manifests[0].Run.Departs.Equal(departs) {
+		t.Fatalf("Expected the runs by departure, got: +%v", manifests)
+	}
+	// 5 fit on the first run, 4 on the second & 2 are split over what's left
+	if manifests[0].SeatsTaken != 6 || manifests[1].SeatsTaken != 4 {
+		t.Errorf("Expected both runs full, got: +%v", manifests)
+	}
+	if runs, seats := familyShuttles(manifests, 1); len(runs) != 1 || seats[0] != 1 {
+		t.Errorf("Expected 1 of family 1 on a run, got: +%v %v", runs, seats)
+	}
+	if runs, _ := familyShuttles(manifests, 3); len(runs) != 1 || !runs[0].Departs.Equal(departs.Add(30*time.Minute)) {
+		t.Errorf("Expected family 3 together on the second run, got: +%v", runs)
+	}
+	if passengers := unseated[Wedding.Name+" from Hyatt"]; len(passengers) != 1 || passengers[0].InviteCode != 1 || passengers[0].Guests != 1 {
+		t.Errorf("Expected 1 of family 1 left over, got: +%v", unseated)
+	}
+	if runs, _ := familyShuttles(manifests, 4); len(runs) != 0 {
+		t.Errorf("Expected no Hyatt shuttle for a family at the Marriott, got: +%v", runs)
+	}
+}
+
+func TestMatchCarpools(t *testing.T) {
+	os.Setenv("HOME_REGION", "Chicago, Naperville")
+	defer os.Unsetenv("HOME_REGION")
+	coming := func(inviteCode int, origin string, guests int) InvitedFamily {
+		return InvitedFamily{InviteCode: inviteCode, Origin: origin, VidhiRsvpd: NULL_INVITEES, GarbaRsvpd: NULL_INVITEES, WeddingRsvpd: guests}
+	}
+	invitedFamilies := []InvitedFamily{
+		coming(1, "Naperville", 2),
+		coming(2, "naperville", 2),
+		coming(3, "Naperville", 3),
+		coming(4, "Chicago", 1),
+		coming(5, "London", 1),
+		coming(6, "Naperville", 0),
+	}
+	entries := []CarpoolEntry{
+		{InviteCode: 1, Seats: 3},
+		{InviteCode: 2, EventName: "wedding", Seats: 0},
+		{InviteCode: 3, Seats: 0},
+		{InviteCode: 4, Seats: 0},
+		{InviteCode: 5, Seats: 0},
+		{InviteCode: 6, Seats: 0},
+	}
+
+	matches, unmatched := matchCarpools(entries, invitedFamilies)
+	if len(matches) != 1 || len(matches[0].Riders) != 1 || matches[0].Riders[0] != 3 || matches[0].SeatsLeft != 0 {
+		t.Errorf("Expected family 3 to ride with family 1, got: +%v", matches)
+	}
+	// 5 is from out of town & 6 isn't coming, so they aren't matched at all
+	if riders := unmatched[Wedding.Name]; len(riders) != 2 || riders[0] != 2 || riders[1] != 4 {
+		t.Errorf("Expected families 2 & 4 without a ride, got: +%v", unmatched)
+	}
+}
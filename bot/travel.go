@@ -0,0 +1,421 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/struct"
+	dialogflow "google.golang.org/genproto/googleapis/cloud/dialogflow/v2"
+)
+
+const (
+	TRAVEL = "TRAVEL"
+
+	TRAVEL_CONTEXT = "rsvpertravel-followup"
+
+	// The travel questions, in the order they're asked
+	TRAVEL_ARRIVAL   = "ARRIVAL"
+	TRAVEL_DEPARTURE = "DEPARTURE"
+	TRAVEL_ROOMS     = "ROOMS"
+
+	// TRAVEL_TIME_FORMAT is how arrivals & departures are written in TRAVEL
+	TRAVEL_TIME_FORMAT = "2006-01-02 15:04"
+)
+
+var travelQuestions = []string{TRAVEL_ARRIVAL, TRAVEL_DEPARTURE, TRAVEL_ROOMS}
+
+// Flight numbers are the airline's 2 letter (or letter & digit) code & up to 4 digits, i.e. AI 127 or 6E2135
+var flightNumber = regexp.MustCompile(`(?i)\b([a-z]{2}|[a-z]\d|\d[a-z])\s?(\d{1,4})\b`)
+
+// Words that look like an airline code in "on 14 March" or "at 3pm"
+var notAirlineCodes = map[string]bool{"on": true, "at": true, "by": true, "in": true, "to": true, "am": true, "pm": true, "st": true, "nd": true, "rd": true, "th": true}
+
+var travelMeridiem = regexp.MustCompile(`\s+(am|pm)\b`)
+var travelFillerWords = regexp.MustCompile(`\b(on|at|arriving|arrive|leaving|leave|flight)\b|[,.]`)
+
+// travelTimeLayouts are the ways guests write when they arrive or leave (the
+// text is lower cased with the am/pm joined to the time, and month names are
+// matched ignoring case). 3/14 is March 14th.
+var travelTimeLayouts = []string{
+	"Jan 2 3:04pm", "Jan 2 3pm", "Jan 2 15:04",
+	"January 2 3:04pm", "January 2 3pm", "January 2 15:04",
+	"2 Jan 3:04pm", "2 Jan 3pm", "2 Jan 15:04",
+	"2 January 3:04pm", "2 January 3pm", "2 January 15:04",
+	"1/2 3:04pm", "1/2 3pm", "1/2 15:04",
+	"2006-01-02 3:04pm", "2006-01-02 3pm", "2006-01-02 15:04",
+}
+
+// TravelDetails are an out-of-town family's travel plans. Arrival & Departure
+// are zero when they skipped the question.
+type TravelDetails struct {
+	Arrival         time.Time `json:"arrival"`
+	ArrivalFlight   string    `json:"arrivalFlight"`
+	Departure       time.Time `json:"departure"`
+	DepartureFlight string    `json:"departureFlight"`
+	Rooms           int       `json:"rooms"`
+}
+
+// homeRegion are the HOME_REGION origins (separated by commas) of the local
+// families, who aren't asked about travel
+func homeRegion() []string {
+	var origins []string
+	for _, origin := range strings.Split(os.Getenv("HOME_REGION"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// isOutOfTown is true for families whose origin isn't in the HOME_REGION.
+// Nobody is asked about travel when HOME_REGION isn't set.
+func isOutOfTown(invitedFamily InvitedFamily) bool {
+	origins := homeRegion()
+	if len(origins) == 0 {
+		return false
+	}
+	_, local := findFold(origins, strings.TrimSpace(invitedFamily.Origin))
+	return !local
+}
+
+// nextTravelQuestion is the question after the given one, or "" after the last
+func nextTravelQuestion(question string) string {
+	for i, travelQuestion := range travelQuestions[:len(travelQuestions)-1] {
+		if travelQuestion == question {
+			return travelQuestions[i+1]
+		}
+	}
+	return ""
+}
+
+// parseTravelLeg reads when the guests arrive or leave & their flight number
+// (i.e. "Mar 14 3:30pm AI 127"). Dates without a year are the next time that
+// date comes round after now.
+func parseTravelLeg(text string, now time.Time) (time.Time, string, error) {
+	var flight string
+	for _, match := range flightNumber.FindAllStringSubmatchIndex(text, -1) {
+		airline := text[match[2]:match[3]]
+		if notAirlineCodes[strings.ToLower(airline)] {
+			continue
+		}
+		flight = strings.ToUpper(airline) + " " + text[match[4]:match[5]]
+		text = text[:match[0]] + text[match[1]:]
+		break
+	}
+
+	text = travelMeridiem.ReplaceAllString(strings.ToLower(text), "$1")
+	text = strings.Join(strings.Fields(travelFillerWords.ReplaceAllString(text, " ")), " ")
+	for _, layout := range travelTimeLayouts {
+		when, err := time.ParseInLocation(layout, text, time.Local)
+		if err != nil {
+			continue
+		}
+		if when.Year() == 0 {
+			when = when.AddDate(now.Year(), 0, 0)
+			if when.Before(now.AddDate(0, 0, -1)) {
+				when = when.AddDate(1, 0, 0)
+			}
+		}
+		return when, flight, nil
+	}
+	return time.Time{}, "", fmt.Errorf("%q isn't a date & time", text)
+}
+
+// parseRoomCount reads how many hotel rooms the family needs
+func parseRoomCount(text string) (int, error) {
+	text = strings.ToLower(strings.Trim(strings.TrimSpace(text), ".!"))
+	if digits := smsDigits.FindString(text); digits != "" {
+		return strconv.Atoi(digits)
+	}
+	for _, word := range strings.Fields(text) {
+		if number, ok := smsNumberWords[word]; ok {
+			return number, nil
+		}
+	}
+	return 0, fmt.Errorf("%q isn't a number of rooms", text)
+}
+
+// answerTravelQuestion updates the travel details with the guest's answer,
+// leaving them as they are when the guest skipped the question
+func answerTravelQuestion(details *TravelDetails, question string, text string, now time.Time) error {
+	if dietaryNoneWords[strings.ToLower(strings.Trim(strings.TrimSpace(text), ".!? "))] {
+		return nil
+	}
+	switch question {
+	case TRAVEL_ARRIVAL:
+		arrival, flight, err := parseTravelLeg(text, now)
+		if err != nil {
+			return err
+		}
+		details.Arrival, details.ArrivalFlight = arrival, flight
+	case TRAVEL_DEPARTURE:
+		departure, flight, err := parseTravelLeg(text, now)
+		if err != nil {
+			return err
+		}
+		if !details.Arrival.IsZero() && departure.Before(details.Arrival) {
+			return fmt.Errorf("leaving (%v) before arriving (%v)", departure, details.Arrival)
+		}
+		details.Departure, details.DepartureFlight = departure, flight
+	case TRAVEL_ROOMS:
+		rooms, err := parseRoomCount(text)
+		if err != nil {
+			return err
+		}
+		details.Rooms = rooms
+	default:
+		return fmt.Errorf("unknown travel question %q", question)
+	}
+	return nil
+}
+
+func formatTravelTime(when time.Time) string {
+	if when.IsZero() {
+		return ""
+	}
+	return when.Format(TRAVEL_TIME_FORMAT)
+}
+
+func parseTravelTime(cell interface{}) time.Time {
+	when, err := time.ParseInLocation(TRAVEL_TIME_FORMAT, fmt.Sprint(cell), time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return when
+}
+
+// saveTravelDetails replaces the family's row in TRAVEL
+func saveTravelDetails(inviteCode int, details TravelDetails) error {
+	row := []interface{}{inviteCode, formatTravelTime(details.Arrival), details.ArrivalFlight, formatTravelTime(details.Departure), details.DepartureFlight, details.Rooms, time.Now(), sessionID}
+	return replaceFamilyRows(TRAVEL, inviteCode, [][]interface{}{row})
+}
+
+// readTravelDetails is the travel details by invite code
+func readTravelDetails() (map[int]TravelDetails, error) {
+	rows, err := getGoogleSheetsData(TRAVEL, "A2:F")
+	if err != nil {
+		return nil, err
+	}
+	travelDetails := make(map[int]TravelDetails)
+	for i, row := range rows {
+		if len(row) == 0 {
+			continue
+		}
+		inviteCode, err := strconv.Atoi(fmt.Sprint(row[0]))
+		if err != nil {
+			log.Printf("Skipping travel entry (%d) as its invite code isn't a number: %v", i+2, row[0])
+			continue
+		}
+		cell := func(i int) interface{} {
+			if i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+		rooms, _ := strconv.Atoi(fmt.Sprint(cell(5)))
+		travelDetails[inviteCode] = TravelDetails{
+			Arrival:         parseTravelTime(cell(1)),
+			ArrivalFlight:   fmt.Sprint(cell(2)),
+			Departure:       parseTravelTime(cell(3)),
+			DepartureFlight: fmt.Sprint(cell(4)),
+			Rooms:           rooms,
+		}
+	}
+	return travelDetails, nil
+}
+
+// travelDetailsOf is the family's travel details so far
+func travelDetailsOf(inviteCode int) TravelDetails {
+	travelDetails, err := readTravelDetails()
+	if err != nil {
+		log.Printf("Unable to read the travel details of invite code %d: %v", inviteCode, err)
+	}
+	return travelDetails[inviteCode]
+}
+
+// saveTravelAnswer saves the answer to one of the travel questions, keeping
+// the family's answers to the others
+func saveTravelAnswer(inviteCode int, question string, text string) error {
+	details := travelDetailsOf(inviteCode)
+	if err := answerTravelQuestion(&details, question, text, time.Now()); err != nil {
+		return err
+	}
+	if err := saveTravelDetails(inviteCode, details); err != nil {
+		log.Fatalf("Unable to save the travel details of invite code %d: %v", inviteCode, err)
+	}
+	return nil
+}
+
+// smsTravelFulfillment saves the answer to the travel question and asks the
+// next one, or carries on with the closing questions after the last
+func smsTravelFulfillment(conversation *Conversation, question string, text string) string {
+	if err := saveTravelAnswer(conversation.InviteCode, question, text); err != nil {
+		log.Printf("Unable to read the %s travel answer of invite code %d: %v", question, conversation.InviteCode, err)
+		return DIDNT_UNDERSTAND_MSG + " " + travelPromptMsg(question)
+	}
+	if next := nextTravelQuestion(question); next != "" {
+		conversation.Step = STEP_TRAVEL + next
+		return travelPromptMsg(next)
+	}
+	return closingPromptMsg(conversation, findInvitedFamily(conversation.InviteCode), STEP_TRAVEL)
+}
+
+// travelResponse asks the Dialogflow guest one of the travel questions,
+// keeping it in a context for TravelFulfillment
+func travelResponse(response *DialogflowResponse, inviteCode int, question string) {
+	travelContext := dialogflow.Context{
+		Name:          sessionID + "/contexts/" + TRAVEL_CONTEXT,
+		LifespanCount: 2,
+		Parameters: &structpb.Struct{Fields: map[string]*structpb.Value{
+			"invite_code":     numberValue(inviteCode),
+			"travel_question": {Kind: &structpb.Value_StringValue{StringValue: question}},
+		}},
+	}
+	response.Text(travelPromptMsg(question)).Contexts(&travelContext)
+}
+
+// TravelFulfillment saves the answer to the travel question and asks the next
+// one, or carries on with the closing questions after the last
+func TravelFulfillment(response *DialogflowResponse, contexts []*dialogflow.Context, text string) {
+	inviteCode := getInviteCodeFromContext(contexts)
+	question := getFromContext(contexts, "travel_question").GetStringValue()
+	if inviteCode == -1 || question == "" {
+		log.Fatalf("%s | %s | Couldn't find the invite code or question for the travel details", sessionID, responseID)
+	}
+	log.Printf("\nIntent: %s - Starting fulfillment for invite code: %d", intent, inviteCode)
+
+	if err := saveTravelAnswer(inviteCode, question, text); err != nil {
+		log.Printf("Unable to read the %s travel answer of invite code %d: %v", question, inviteCode, err)
+		travelResponse(response.Text(DIDNT_UNDERSTAND_MSG), inviteCode, question)
+		return
+	}
+	if next := nextTravelQuestion(question); next != "" {
+		travelResponse(response, inviteCode, next)
+		return
+	}
+	invitedFamily := findInvitedFamily(inviteCode)
+	closingResponse(response, invitedFamily, invitedFamily.rsvps(), STEP_TRAVEL)
+}
+
+// PickupRow is one family to pick up from the airport. Families landing at the
+// same time are one pickup, with PickupGuests all of their guests.
+type PickupRow struct {
+	Arrival      time.Time `json:"arrival"`
+	Flight       string    `json:"flight"`
+	InviteCode   int       `json:"inviteCode"`
+	InviteName   string    `json:"inviteName"`
+	Guests       int       `json:"guests"`
+	PickupGuests int       `json:"pickupGuests"`
+}
+
+var pickupColumns = []string{"Date", "Time", "Flight", "Invite Code", "Invite Name", "Guests", "Pickup Guests"}
+
+// pickupSchedule lists the arrivals of the families that are coming, by
+// arrival date & time. A family's guests are the most they RSVP'd to any event.
+func pickupSchedule(invitedFamilies []InvitedFamily, travelDetails map[int]TravelDetails) []PickupRow {
+	var rows []PickupRow
+	pickupGuests := make(map[time.Time]int)
+	for _, invitedFamily := range invitedFamilies {
+		details, ok := travelDetails[invitedFamily.InviteCode]
+		if !ok || details.Arrival.IsZero() {
+			continue
+		}
+		guests := familyGuests(invitedFamily)
+		if guests == 0 {
+			continue
+		}
+		rows = append(rows, PickupRow{Arrival: details.Arrival, Flight: details.ArrivalFlight, InviteCode: invitedFamily.InviteCode, InviteName: invitedFamily.InviteName, Guests: guests})
+		pickupGuests[details.Arrival] += guests
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].Arrival.Equal(rows[j].Arrival) {
+			return rows[i].Arrival.Before(rows[j].Arrival)
+		}
+		return rows[i].InviteCode < rows[j].InviteCode
+	})
+	for i := range rows {
+		rows[i].PickupGuests = pickupGuests[rows[i].Arrival]
+	}
+	return rows
+}
+
+// writePickupSchedule writes the schedule, with a blank line between the days in the table
+func writePickupSchedule(writer io.Writer, schedule []PickupRow, format string) error {
+	record := func(row PickupRow) []string {
+		return []string{row.Arrival.Format(DATE_FORMAT), row.Arrival.Format("15:04"), row.Flight, strconv.Itoa(row.InviteCode), row.InviteName, strconv.Itoa(row.Guests), strconv.Itoa(row.PickupGuests)}
+	}
+	switch format {
+	case REPORT_TABLE:
+		table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, strings.Join(pickupColumns, "\t"))
+		for i, row := range schedule {
+			if i > 0 && row.Arrival.Format(DATE_FORMAT) != schedule[i-1].Arrival.Format(DATE_FORMAT) {
+				fmt.Fprintln(table)
+			}
+			fmt.Fprintln(table, strings.Join(record(row), "\t"))
+		}
+		return table.Flush()
+	case REPORT_CSV:
+		csvWriter := csv.NewWriter(writer)
+		csvWriter.Write(pickupColumns)
+		for _, row := range schedule {
+			csvWriter.Write(record(row))
+		}
+		csvWriter.Flush()
+		return csvWriter.Error()
+	case REPORT_JSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(schedule)
+	}
+	return fmt.Errorf("unknown report format %q (table, csv or json)", format)
+}
+
+func pickupScheduleCommand(args []string) error {
+	flags := flag.NewFlagSet("pickup-schedule", flag.ExitOnError)
+	date := flags.String("date", "", "only list the arrivals on this date, i.e. 2019-03-14 (default all dates)")
+	format := flags.String("format", REPORT_TABLE, "table, csv or json")
+	outputFile := flags.String("out", "", "file to write the schedule to (default stdout)")
+	flags.Parse(args)
+
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		return err
+	}
+	travelDetails, err := readTravelDetails()
+	if err != nil {
+		return err
+	}
+	schedule := pickupSchedule(invitedFamilies, travelDetails)
+	if *date != "" {
+		var onDate []PickupRow
+		for _, row := range schedule {
+			if row.Arrival.Format(DATE_FORMAT) == *date {
+				onDate = append(onDate, row)
+			}
+		}
+		schedule = onDate
+	}
+
+	var writer io.Writer = os.Stdout
+	if *outputFile != "" {
+		file, err := os.Create(*outputFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+	return writePickupSchedule(writer, schedule, *format)
+}
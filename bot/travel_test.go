@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseTravelLeg(t *testing.T) {
+	now := time.Date(2019, 1, 10, 12, 0, 0, 0, time.Local)
+	tests := map[string]struct {
+		when   string
+		flight string
+	}{
+		"Mar 14 3:30pm AI 127":         {"2019-03-14 15:30", "AI 127"},
+		"arriving on 14 march at 9 am": {"2019-03-14 09:00", ""},
+		"flight 6e2135, 3/15 22:05":    {"2019-03-15 22:05", "6E 2135"},
+		"Jan 2 7am UA48":               {"2020-01-02 07:00", "UA 48"},
+		"2019-03-17 11:45pm on BA 119": {"2019-03-17 23:45", "BA 119"},
+	}
+	for text, expected := range tests {
+		when, flight, err := parseTravelLeg(text, now)
+		if err != nil {
+			t.Errorf("Error parsing %q: +%v", text, err)
+			continue
+		}
+		if formatTravelTime(when) != expected.when || flight != expected.flight {
+			t.Errorf("Expected %q to be %s %s, got: %s %s", text, expected.when, expected.flight, formatTravelTime(when), flight)
+		}
+	}
+
+	if _, _, err := parseTravelLeg("sometime in march", now); err == nil {
+		t.Errorf("Expected a date without a time not to parse")
+	}
+}
+
+func TestAnswerTravelQuestion(t *testing.T) {
+	now := time.Date(2019, 1, 10, 12, 0, 0, 0, time.Local)
+	var details TravelDetails
+	answers := []struct {
+		question, text string
+	}{
+		{TRAVEL_ARRIVAL, "Mar 14 3:30pm AI 127"},
+		{TRAVEL_DEPARTURE, "skip"},
+		{TRAVEL_ROOMS, "two rooms"},
+	}
+	for _, answer := range answers {
+		if err := answerTravelQuestion(&details, answer.question, answer.text, now); err != nil {
+			t.Errorf("Error answering %s with %q: +%v", answer.question, answer.text, err)
+		}
+	}
+	if details.ArrivalFlight != "AI 127" || !details.Departure.IsZero() || details.Rooms != 2 {
+		t.Errorf("Unexpected travel details: +%v", details)
+	}
+	if err := answerTravelQuestion(&details, TRAVEL_DEPARTURE, "Mar 1 9am", now); err == nil {
+		t.Errorf("Expected leaving before arriving not to be allowed")
+	}
+	if nextTravelQuestion(TRAVEL_ARRIVAL) != TRAVEL_DEPARTURE || nextTravelQuestion(TRAVEL_ROOMS) != "" {
+		t.Errorf("Unexpected travel question order")
+	}
+}
+
+func TestNextClosingStep(t *testing.T) {
+	os.Setenv("HOME_REGION", "Chicago, Naperville")
+	defer os.Unsetenv("HOME_REGION")
+	local := InvitedFamily{Origin: "chicago"}
+	overseas := InvitedFamily{Origin: "London"}
+	coming := map[Event]int{Vidhi: 2, Wedding: 0}
+
+	if step := nextClosingStep(local, coming, STEP_START); step != STEP_START {
+		t.Errorf("Expected local families not to be asked about travel, got: %s", step)
+	}
+	if step := nextClosingStep(overseas, coming, STEP_START); step != STEP_TRAVEL+TRAVEL_ARRIVAL {
+		t.Errorf("Expected out-of-town families to be asked about travel, got: %s", step)
+	}
+	if step := nextClosingStep(overseas, map[Event]int{Vidhi: 0}, STEP_START); step != STEP_START {
+		t.Errorf("Expected families that aren't coming not to be asked about travel, got: %s", step)
+	}
+
+	os.Setenv("ASK_ACCESSIBILITY_NEEDS", "true")
+	defer os.Unsetenv("ASK_ACCESSIBILITY_NEEDS")
+	if step := nextClosingStep(overseas, coming, STEP_START); step != STEP_ACCESSIBILITY {
+		t.Errorf("Expected accessibility to be asked first, got: %s", step)
+	}
+	if step := nextClosingStep(overseas, coming, STEP_ACCESSIBILITY); step != STEP_TRAVEL+TRAVEL_ARRIVAL {
+		t.Errorf("Expected travel after accessibility, got: %s", step)
+	}
+	if step := nextClosingStep(overseas, coming, STEP_TRAVEL); step != STEP_START {
+		t.Errorf("Expected nothing after travel, got: %s", step)
+	}
+}
+
+func TestPickupSchedule(t *testing.T) {
+	arrival := time.Date(2019, 3, 14, 15, 30, 0, 0, time.Local)
+	invitedFamilies := []InvitedFamily{
+		{InviteCode: 3, InviteName: "The Modi Family", VidhiRsvpd: 2, GarbaRsvpd: 4, WeddingRsvpd: NULL_INVITEES},
+		{InviteCode: 1, InviteName: "The Shah Family", VidhiRsvpd: 3, GarbaRsvpd: NULL_INVITEES, WeddingRsvpd: NULL_INVITEES},
+		{InviteCode: 2, InviteName: "The Patel Family", VidhiRsvpd: 0, GarbaRsvpd: 0, WeddingRsvpd: 0},
+		{InviteCode: 4, InviteName: "The Joshi Family", VidhiRsvpd: 1, GarbaRsvpd: NULL_INVITEES, WeddingRsvpd: NULL_INVITEES},
+	}
+	travelDetails := map[int]TravelDetails{
+		1: {Arrival: arrival, ArrivalFlight: "AI 127"},
+		2: {Arrival: arrival},
+		3: {Arrival: arrival, ArrivalFlight: "AI 127"},
+		4: {Arrival: arrival.Add(-24 * time.Hour), ArrivalFlight: "UA 48"},
+	}
+
+	schedule := pickupSchedule(invitedFamilies, travelDetails)
+	if len(schedule) != 3 || schedule[0].InviteCode != 4 || schedule[1].InviteCode != 1 || schedule[2].InviteCode != 3 {
+		t.Fatalf("Expected families 4, 1 & 3 by arrival, got: +%v", schedule)
+	}
+	if schedule[2].Guests != 4 || schedule[2].PickupGuests != 7 {
+		t.Errorf("Expected 4 of the 7 guests landing together, got: +%v", schedule[2])
+	}
+
+	var buffer bytes.Buffer
+	if err := writePickupSchedule(&buffer, schedule[:1], REPORT_CSV); err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if expected := "Date,Time,Flight,Invite Code,Invite Name,Guests,Pickup Guests\n2019-03-13,15:30,UA 48,4,The Joshi Family,1,1\n"; buffer.String() != expected {
+		t.Errorf("Unexpected csv: %s", buffer.String())
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/xml"
+	"log"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// TwiML verbs used to answer Twilio's SMS & voice webhooks
+//
+// https://www.twilio.com/docs/voice/twiml
+type twimlResponse struct {
+	XMLName xml.Name `xml:"Response"`
+	Verbs   []interface{}
+}
+
+type twimlMessage struct {
+	XMLName xml.Name `xml:"Message"`
+	Text    string   `xml:",chardata"`
+}
+
+type twimlSay struct {
+	XMLName xml.Name `xml:"Say"`
+	Text    string   `xml:",chardata"`
+}
+
+type twimlGather struct {
+	XMLName     xml.Name `xml:"Gather"`
+	Input       string   `xml:"input,attr"`
+	Action      string   `xml:"action,attr"`
+	Method      string   `xml:"method,attr"`
+	Timeout     int      `xml:"timeout,attr,omitempty"`
+	FinishOnKey string   `xml:"finishOnKey,attr,omitempty"`
+	Say         twimlSay
+}
+
+type twimlRedirect struct {
+	XMLName xml.Name `xml:"Redirect"`
+	Method  string   `xml:"method,attr"`
+	URL     string   `xml:",chardata"`
+}
+
+type twimlHangup struct {
+	XMLName xml.Name `xml:"Hangup"`
+}
+
+func newTwimlResponse(verbs ...interface{}) events.APIGatewayProxyResponse {
+	body, err := xml.Marshal(twimlResponse{Verbs: verbs})
+	if err != nil {
+		log.Fatal("Unable to create the TwiML response - error: ", err)
+	}
+	log.Printf("\nResponse body: %s", body)
+
+	return events.APIGatewayProxyResponse{
+		Body:       xml.Header + string(body),
+		StatusCode: 200,
+		Headers:    map[string]string{"Content-Type": "text/xml"},
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	VOICE_ENTER_CODE_MSG   = "Please enter the invite code printed on your invitation card, followed by the pound key."
+	VOICE_ENTER_COUNT_MSG  = "Please enter the number, followed by the pound key."
+	VOICE_GOODBYE_MSG      = "Thank you for calling. Goodbye!"
+	VOICE_GATHER_TIMEOUT   = 10
+	VOICE_GATHER_FINISH_ON = "#"
+
+	// Steps of the call, passed along in the query string of the Gather action
+	VOICE_STEP_CODE     = "code"
+	VOICE_STEP_RSVP     = "rsvp"
+	VOICE_STEP_CHILDREN = "children"
+)
+
+var allCapsWords = regexp.MustCompile(`\b[A-Z][A-Z-]+\b`)
+
+// VoiceHandler answers Twilio's voice webhook with TwiML. Guests key in their
+// invite code and head counts, and the call's state is passed along in the
+// query string of each Gather action, so there's nothing to store between requests.
+//
+// https://www.twilio.com/docs/voice/twiml/gather
+func VoiceHandler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	form, err := parseTwilioForm(request)
+	if err != nil {
+		log.Printf("Unable to parse the Twilio request body: %v", err)
+		return events.APIGatewayProxyResponse{StatusCode: 400}, nil
+	}
+	query := voiceQuery(request)
+	if !isValidTwilioRequest(voiceWebhookURL(query), request, form) {
+		log.Printf("Invalid Twilio signature for call: %s", form.Get("CallSid"))
+		return events.APIGatewayProxyResponse{StatusCode: 403}, nil
+	}
+
+	phoneNumber := form.Get("From")
+	sessionID = form.Get("CallSid")
+	responseID = form.Get("CallSid")
+	requestStr = fmt.Sprintf("+%v", form)
+	intent = "voice - " + query.Get("step")
+	log.Printf("Received call for step: %s, Processing callSid: %s from: %s", query.Get("step"), sessionID, phoneNumber)
+
+	digits := form.Get("Digits")
+	switch query.Get("step") {
+	case VOICE_STEP_CODE:
+		return voiceInviteCodeFulfillment(digits), nil
+	case VOICE_STEP_RSVP:
+		return voiceRsvpFulfillment(query, phoneNumber, digits), nil
+	case VOICE_STEP_CHILDREN:
+		return voiceChildrenFulfillment(query, phoneNumber, digits), nil
+	default:
+		return newTwimlResponse(
+			twimlSay{Text: "Hi!"},
+			voiceGather(VOICE_ENTER_CODE_MSG, url.Values{"step": {VOICE_STEP_CODE}}),
+			voiceRedirect(url.Values{}),
+		), nil
+	}
+}
+
+func voiceInviteCodeFulfillment(digits string) events.APIGatewayProxyResponse {
+	retry := url.Values{"step": {VOICE_STEP_CODE}}
+	inviteCode, err := strconv.Atoi(digits)
+	if err != nil {
+		return newTwimlResponse(voiceGather(VOICE_ENTER_CODE_MSG, retry), voiceRedirect(retry))
+	}
+	invitedFamily, found := lookupInvitedFamily(inviteCode)
+	if !found {
+		return newTwimlResponse(twimlSay{Text: INVITE_CODE_NOT_FOUND_MSG}, voiceGather(VOICE_ENTER_CODE_MSG, retry), voiceRedirect(retry))
+	}
+
+	log.Printf("\nIntent: %s - Starting fulfillment for invite code: %d", intent, inviteCode)
+	verbs := []interface{}{twimlSay{Text: speechMsg(invitationMsg(invitedFamily))}}
+	return newTwimlResponse(append(verbs, voiceNextRsvpVerbs(invitedFamily, Event{}, make(map[Event]int))...)...)
+}
+
+func voiceRsvpFulfillment(query url.Values, phoneNumber string, digits string) events.APIGatewayProxyResponse {
+	inviteCode, _ := strconv.Atoi(query.Get("code"))
+	currentEvent, ok := eventByName(query.Get("event"))
+	if !ok {
+		log.Fatalf("%s | %s | Couldn't find the event: %s", sessionID, responseID, query.Get("event"))
+	}
+	rsvps := parseConversationRsvps(query.Get("rsvps"))
+	invitedFamily := findInvitedFamily(inviteCode)
+	invited := invitedFamily.invitedTo(currentEvent)
+
+	rsvpCnt, err := strconv.Atoi(digits)
+	if err != nil {
+		return newTwimlResponse(voiceRsvpGather(invitedFamily, currentEvent, rsvps), voiceRedirect(query))
+	}
+	if currentEvent.CountsChildren {
+		// The count is only the adults, the children are asked for next
+		if message, ok := invitedFamily.checkRsvpSplit(currentEvent, rsvpCnt, 0); !ok {
+			return newTwimlResponse(twimlSay{Text: speechMsg(message)}, voiceRsvpGather(invitedFamily, currentEvent, rsvps), voiceRedirect(query))
+		}
+	} else if rsvpCnt > invited {
+		return newTwimlResponse(twimlSay{Text: speechMsg(rsvpCountTooHighMsg(currentEvent, invited))}, voiceRsvpGather(invitedFamily, currentEvent, rsvps), voiceRedirect(query))
+	}
+
+	log.Printf("\nIntent: %s - Starting fulfillment for invite code: %d", intent, inviteCode)
+	if message, ok := checkRsvpDeadline(inviteCode, currentEvent, ""); !ok {
+		return newTwimlResponse(twimlSay{Text: speechMsg(message)}, twimlSay{Text: VOICE_GOODBYE_MSG}, twimlHangup{})
+	}
+
+	if !currentEvent.CountsChildren {
+		return voiceSaveRsvp(invitedFamily, phoneNumber, currentEvent, rsvps, rsvpCnt, nil)
+	}
+	if _, invitedChildren := invitedFamily.invitedSplit(currentEvent); invitedChildren > 0 {
+		childrenQuery := voiceChildrenQuery(invitedFamily, currentEvent, rsvps, rsvpCnt)
+		return newTwimlResponse(voiceGather(speechMsg(rsvpChildrenPromptMsg(currentEvent, invitedChildren))+" "+VOICE_ENTER_COUNT_MSG, childrenQuery), voiceRedirect(childrenQuery))
+	}
+	return voiceSaveRsvp(invitedFamily, phoneNumber, currentEvent, rsvps, rsvpCnt, map[Event]int{currentEvent: 0})
+}
+
+// voiceChildrenFulfillment takes the number of children, after the adults, for
+// the events that count children
+func voiceChildrenFulfillment(query url.Values, phoneNumber string, digits string) events.APIGatewayProxyResponse {
+	inviteCode, _ := strconv.Atoi(query.Get("code"))
+	currentEvent, ok := eventByName(query.Get("event"))
+	if !ok {
+		log.Fatalf("%s | %s | Couldn't find the event: %s", sessionID, responseID, query.Get("event"))
+	}
+	rsvps := parseConversationRsvps(query.Get("rsvps"))
+	adults, _ := strconv.Atoi(query.Get("adults"))
+	invitedFamily := findInvitedFamily(inviteCode)
+	_, invitedChildren := invitedFamily.invitedSplit(currentEvent)
+	gather := voiceGather(speechMsg(rsvpChildrenPromptMsg(currentEvent, invitedChildren))+" "+VOICE_ENTER_COUNT_MSG, query)
+
+	children, err := strconv.Atoi(digits)
+	if err != nil {
+		return newTwimlResponse(gather, voiceRedirect(query))
+	}
+	if message, ok := invitedFamily.checkRsvpSplit(currentEvent, adults, children); !ok {
+		return newTwimlResponse(twimlSay{Text: speechMsg(message)}, gather, voiceRedirect(query))
+	}
+
+	log.Printf("\nIntent: %s - Starting fulfillment for invite code: %d", intent, inviteCode)
+	if message, ok := checkRsvpDeadline(inviteCode, currentEvent, ""); !ok {
+		return newTwimlResponse(twimlSay{Text: speechMsg(message)}, twimlSay{Text: VOICE_GOODBYE_MSG}, twimlHangup{})
+	}
+	return voiceSaveRsvp(invitedFamily, phoneNumber, currentEvent, rsvps, adults+children, map[Event]int{currentEvent: children})
+}
+
+// voiceSaveRsvp saves the event's RSVP and moves on to the next event
+func voiceSaveRsvp(invitedFamily InvitedFamily, phoneNumber string, currentEvent Event, rsvps map[Event]int, rsvpCnt int, children map[Event]int) events.APIGatewayProxyResponse {
+	saved, waitlisted := saveRsvp(invitedFamily.InviteCode, phoneNumber, map[Event]int{currentEvent: rsvpCnt}, children)
+	rsvps[currentEvent] = saved[currentEvent]
+	verbs := voiceNextRsvpVerbs(invitedFamily, currentEvent, rsvps)
+	if len(waitlisted) > 0 {
+		verbs = append([]interface{}{twimlSay{Text: speechMsg(waitlistedMsg(currentEvent, saved[currentEvent], waitlisted[0]))}}, verbs...)
+	}
+	return newTwimlResponse(verbs...)
+}
+
+// voiceNextRsvpVerbs asks for the next event's RSVP count, or reads back the
+// RSVP summary and hangs up when they've RSVP'd to every event they're invited to
+func voiceNextRsvpVerbs(invitedFamily InvitedFamily, currentEvent Event, rsvps map[Event]int) []interface{} {
+	message, followupAction := getFollowupEventAction(invitedFamily, currentEvent, rsvps)
+	nextEvent, ok := eventForDialogflowAction(followupAction)
+	if !ok {
+		return []interface{}{twimlSay{Text: speechMsg(message)}, twimlSay{Text: VOICE_GOODBYE_MSG}, twimlHangup{}}
+	}
+	return []interface{}{voiceRsvpGather(invitedFamily, nextEvent, rsvps), voiceRedirect(voiceRsvpQuery(invitedFamily, nextEvent, rsvps))}
+}
+
+func voiceRsvpGather(invitedFamily InvitedFamily, event Event, rsvps map[Event]int) twimlGather {
+	prompt := speechMsg(rsvpPromptMsg(event, invitedFamily)) + " " + VOICE_ENTER_COUNT_MSG
+	return voiceGather(prompt, voiceRsvpQuery(invitedFamily, event, rsvps))
+}
+
+func voiceRsvpQuery(invitedFamily InvitedFamily, event Event, rsvps map[Event]int) url.Values {
+	return url.Values{
+		"step":  {VOICE_STEP_RSVP},
+		"code":  {strconv.Itoa(invitedFamily.InviteCode)},
+		"event": {event.Name},
+		"rsvps": {formatConversationRsvps(rsvps)},
+	}
+}
+
+// voiceChildrenQuery carries the adults' count over to the children's step
+func voiceChildrenQuery(invitedFamily InvitedFamily, event Event, rsvps map[Event]int, adults int) url.Values {
+	query := voiceRsvpQuery(invitedFamily, event, rsvps)
+	query.Set("step", VOICE_STEP_CHILDREN)
+	query.Set("adults", strconv.Itoa(adults))
+	return query
+}
+
+func voiceGather(prompt string, query url.Values) twimlGather {
+	return twimlGather{
+		Input:       "dtmf",
+		Action:      voiceActionURL(query),
+		Method:      "POST",
+		Timeout:     VOICE_GATHER_TIMEOUT,
+		FinishOnKey: VOICE_GATHER_FINISH_ON,
+		Say:         twimlSay{Text: prompt},
+	}
+}
+
+// voiceRedirect repeats the step when the guest doesn't key anything in before the Gather times out
+func voiceRedirect(query url.Values) twimlRedirect {
+	return twimlRedirect{Method: "POST", URL: voiceActionURL(query)}
+}
+
+// voiceActionURL is relative to the voice webhook url, i.e. voice?step=code
+func voiceActionURL(query url.Values) string {
+	if len(query) == 0 {
+		return "voice"
+	}
+	return "voice?" + query.Encode()
+}
+
+func voiceQuery(request events.APIGatewayProxyRequest) url.Values {
+	query := url.Values{}
+	for key, value := range request.QueryStringParameters {
+		query.Set(key, value)
+	}
+	return query
+}
+
+// voiceWebhookURL is the full url Twilio requested, which is what the request signature is computed from
+func voiceWebhookURL(query url.Values) string {
+	webhookURL := os.Getenv("TWILIO_VOICE_WEBHOOK_URL")
+	if len(query) > 0 {
+		webhookURL += "?" + query.Encode()
+	}
+	return webhookURL
+}
+
+// speechMsg turns a text message into something that reads well out loud, i.e.
+// "GARBA-RECEPTION: 4 \n" becomes "Garba reception: 4."
+func speechMsg(message string) string {
+	message = strings.Replace(message, ":)", "", -1)
+	message = strings.Replace(message, "P.S.", "", -1)
+	message = allCapsWords.ReplaceAllStringFunc(message, func(word string) string {
+		word = strings.ToLower(strings.Replace(word, "-", " ", -1))
+		return strings.ToUpper(word[:1]) + word[1:]
+	})
+
+	var sentences []string
+	for _, line := range strings.Split(message, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasSuffix(line, ".") && !strings.HasSuffix(line, "?") && !strings.HasSuffix(line, "!") && !strings.HasSuffix(line, ":") {
+			line += "."
+		}
+		sentences = append(sentences, line)
+	}
+	return strings.Join(sentences, " ")
+}
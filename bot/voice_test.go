@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSpeechMsg(t *testing.T) {
+	message := invitationMsg(InvitedFamily{InviteName: "The Patel Family", GarbaInvited: 4, WeddingInvited: MAX_INVITEES})
+	expected := "You must be The Patel Family. You're invited to: Garba reception: 4. Wedding: full family."
+	if speech := speechMsg(message); speech != expected {
+		t.Errorf("Expected speech: %q, got: %q", expected, speech)
+	}
+}
+
+func TestVoiceGather(t *testing.T) {
+	rsvps := map[Event]int{Vidhi: 2}
+	gather := voiceRsvpGather(InvitedFamily{InviteCode: 300, GarbaInvited: 4}, Garba, rsvps)
+
+	action, err := url.Parse(gather.Action)
+	if err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	query := action.Query()
+	if action.Path != "voice" || query.Get("step") != VOICE_STEP_RSVP || query.Get("code") != "300" || query.Get("event") != "GARBA" || query.Get("rsvps") != "VIDHI=2" {
+		t.Errorf("Unexpected gather action: %s", gather.Action)
+	}
+
+	body, err := xml.Marshal(twimlResponse{Verbs: []interface{}{gather}})
+	if err != nil {
+		t.Fatalf("Error: +%v", err)
+	}
+	if !strings.Contains(string(body), `<Gather input="dtmf"`) || !strings.Contains(string(body), "<Say>How many people from your family will be attending the Garba reception? You&#39;re invited: 4.") {
+		t.Errorf("Unexpected TwiML: %s", body)
+	}
+}
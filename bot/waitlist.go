@@ -0,0 +1,390 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+const (
+	WAITLIST = "WAITLIST"
+	// WAITLIST_PROMOTED is the phone number logged in UPDATE_EVENT for the
+	// RSVPs of families promoted off the waitlist
+	WAITLIST_PROMOTED = "WAITLIST"
+)
+
+// WaitlistEntry is a family's guests waiting for seats at a full event.
+// Position is their place in the event's queue (from 1), by when they were
+// added.
+type WaitlistEntry struct {
+	InviteCode  int
+	Event       Event
+	Guests      int
+	PhoneNumber string
+	AddedAt     string
+	Position    int
+	rowNumber   int
+}
+
+// WaitlistPromotion is seats given to a waitlisted family
+type WaitlistPromotion struct {
+	Entry WaitlistEntry
+	Seats int
+}
+
+// eventCapacity is the <EVENT>_CAPACITY, the most guests the venue holds (0
+// when there's no limit)
+func eventCapacity(eventName string) int {
+	capacity, err := strconv.Atoi(os.Getenv(eventName + "_CAPACITY"))
+	if err != nil {
+		return 0
+	}
+	return capacity
+}
+
+// eventTotals are the guests RSVP'd to each event, the running totals the
+// capacities are checked against
+func eventTotals(invitedFamilies []InvitedFamily) map[Event]int {
+	totals := make(map[Event]int)
+	for _, invitedFamily := range invitedFamilies {
+		for _, event := range AllEvents {
+			if rsvpd := invitedFamily.rsvpdTo(event); rsvpd > 0 {
+				totals[event] += rsvpd
+			}
+		}
+	}
+	return totals
+}
+
+// capRsvp splits the family's RSVP into the guests that fit within the
+// event's capacity & the ones that go on the waitlist. total is the event's
+// running total, including the family's previous RSVP; a family never loses
+// seats they already had, even when the event is over capacity.
+func capRsvp(event Event, total int, previous int, rsvpd int) (int, int) {
+	if event.Capacity <= 0 {
+		return rsvpd, 0
+	}
+	if previous < 0 {
+		previous = 0
+	}
+	if rsvpd <= previous {
+		// Fewer guests always fit, even when the event is over capacity
+		return rsvpd, 0
+	}
+	available := event.Capacity - (total - previous)
+	if rsvpd <= available {
+		return rsvpd, 0
+	}
+	confirmed := available
+	if previous > confirmed {
+		confirmed = previous
+	}
+	if confirmed < 0 {
+		confirmed = 0
+	}
+	waiting := rsvpd - confirmed
+	if waiting < 0 {
+		waiting = 0
+	}
+	return confirmed, waiting
+}
+
+func hasCapacity(rsvps map[Event]int) bool {
+	for event := range rsvps {
+		if event.Capacity > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// waitlistPromotions are the seats freed up at the event given to the
+// waitlisted families in order. The first family in the queue gets as many of
+// the seats as there are, and keeps their place for the rest.
+func waitlistPromotions(event Event, total int, waitlist []WaitlistEntry) []WaitlistPromotion {
+	free := event.Capacity - total
+	var promotions []WaitlistPromotion
+	for _, entry := range waitlist {
+		if free <= 0 {
+			break
+		}
+		if entry.Event != event {
+			continue
+		}
+		seats := entry.Guests
+		if seats > free {
+			seats = free
+		}
+		promotions = append(promotions, WaitlistPromotion{Entry: entry, Seats: seats})
+		free -= seats
+	}
+	return promotions
+}
+
+// saveRsvpWithinCapacity is saveRsvp for events with a capacity: the guests
+// that don't fit go on the waitlist, and the families waiting are promoted
+// when the family frees up seats.
+//
+// The event totals are summed from every family on each RSVP to an event with
+// a capacity, and they aren't locked between the read & the write, so two
+// families RSVPing at the same moment can both take the last seats. Capacities
+// are meant for the venue's limit with some slack, and the hosts see the
+// totals with the waitlist command.
+func saveRsvpWithinCapacity(inviteCode int, phoneNumber string, rsvps map[Event]int, children map[Event]int) (map[Event]int, []WaitlistEntry, error) {
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read the families for the event totals: %v", err)
+	}
+	totals := eventTotals(invitedFamilies)
+	var invitedFamily InvitedFamily
+	for _, family := range invitedFamilies {
+		if family.InviteCode == inviteCode {
+			invitedFamily = family
+		}
+	}
+
+	saved := make(map[Event]int)
+	savedChildren := make(map[Event]int)
+	for event, childrenRsvpd := range children {
+		savedChildren[event] = childrenRsvpd
+	}
+	waitlisted := make(map[Event]int)
+	var freed []Event
+	for event, rsvpd := range rsvps {
+		previous := invitedFamily.rsvpdTo(event)
+		confirmed, waiting := capRsvp(event, totals[event], previous, rsvpd)
+		saved[event] = confirmed
+		waitlisted[event] = waiting
+		if childrenRsvpd, ok := savedChildren[event]; ok && childrenRsvpd > confirmed {
+			savedChildren[event] = confirmed
+		}
+		if confirmed < previous {
+			freed = append(freed, event)
+		}
+	}
+	if err := guestStore.SaveRsvps(inviteCode, phoneNumber, saved, savedChildren); err != nil {
+		return nil, nil, err
+	}
+
+	var entries []WaitlistEntry
+	for event := range rsvps {
+		// Read for every event, as taking the family off a waitlist moves the rows below
+		waitlist, err := readWaitlist()
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to read the waitlist for invite code %d: %v", inviteCode, err)
+		}
+		entry, err := setWaitlistEntry(waitlist, inviteCode, event, waitlisted[event], phoneNumber)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to update the waitlist for invite code %d: %v", inviteCode, err)
+		}
+		if entry.Guests > 0 {
+			entries = append(entries, entry)
+		}
+	}
+	if len(freed) > 0 {
+		if err := promoteWaitlist(freed); err != nil {
+			log.Printf("Unable to promote the waitlist after invite code %d freed up seats: %v", inviteCode, err)
+		}
+	}
+	return saved, entries, nil
+}
+
+// waitlistedResponse tells the Dialogflow guest about their place on the
+// waitlist. A followup event would replace the text, so the guest carries on
+// with their other events by chatting again.
+func waitlistedResponse(response *DialogflowResponse, event Event, confirmed int, entry WaitlistEntry) {
+	response.Text(waitlistedMsg(event, confirmed, entry) + " " + WAITLIST_CONTINUE_MSG)
+}
+
+func readWaitlist() ([]WaitlistEntry, error) {
+	rows, err := getGoogleSheetsData(WAITLIST, "A2:E")
+	if err != nil {
+		return nil, err
+	}
+	var waitlist []WaitlistEntry
+	positions := make(map[Event]int)
+	for i, row := range rows {
+		if len(row) < 3 {
+			continue
+		}
+		inviteCode, codeErr := strconv.Atoi(fmt.Sprint(row[0]))
+		event, ok := eventByName(fmt.Sprint(row[1]))
+		guests, guestsErr := strconv.Atoi(fmt.Sprint(row[2]))
+		if codeErr != nil || !ok || guestsErr != nil {
+			log.Printf("Skipping waitlist entry (%d) as its event isn't known or its invite code & guests aren't numbers: %v", i+2, row)
+			continue
+		}
+		positions[event]++
+		entry := WaitlistEntry{InviteCode: inviteCode, Event: event, Guests: guests, Position: positions[event], rowNumber: i + 2}
+		if len(row) > 3 {
+			entry.PhoneNumber = fmt.Sprint(row[3])
+		}
+		if len(row) > 4 {
+			entry.AddedAt = fmt.Sprint(row[4])
+		}
+		waitlist = append(waitlist, entry)
+	}
+	return waitlist, nil
+}
+
+// setWaitlistEntry puts the family's guests on the event's waitlist, keeping
+// their place when they're already on it, or takes them off it when there
+// are none
+func setWaitlistEntry(waitlist []WaitlistEntry, inviteCode int, event Event, guests int, phoneNumber string) (WaitlistEntry, error) {
+	position := 1
+	for _, entry := range waitlist {
+		if entry.Event != event {
+			continue
+		}
+		if entry.InviteCode != inviteCode {
+			position++
+			continue
+		}
+		if guests <= 0 {
+			return WaitlistEntry{}, deleteGoogleSheetsRows(WAITLIST, []int{entry.rowNumber})
+		}
+		entry.Guests = guests
+		_, err := setGoogleSheetsData([]*sheets.ValueRange{{Range: WAITLIST + "!C" + strconv.Itoa(entry.rowNumber), Values: [][]interface{}{{guests}}}})
+		return entry, err
+	}
+	if guests <= 0 {
+		return WaitlistEntry{}, nil
+	}
+	entry := WaitlistEntry{InviteCode: inviteCode, Event: event, Guests: guests, PhoneNumber: phoneNumber, Position: position}
+	_, err := appendGoogleSheetsData(WAITLIST, [][]interface{}{{inviteCode, event.Name, guests, phoneNumber, time.Now()}})
+	return entry, err
+}
+
+// promoteWaitlist gives the free seats at the events to the waitlisted
+// families, and texts them the good news
+func promoteWaitlist(events []Event) error {
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		return err
+	}
+	waitlist, err := readWaitlist()
+	if err != nil {
+		return err
+	}
+	totals := eventTotals(invitedFamilies)
+	var promotions []WaitlistPromotion
+	for _, event := range events {
+		promotions = append(promotions, waitlistPromotions(event, totals[event], waitlist)...)
+	}
+	if len(promotions) == 0 {
+		return nil
+	}
+	familiesByInviteCode := make(map[int]InvitedFamily)
+	for _, invitedFamily := range invitedFamilies {
+		familiesByInviteCode[invitedFamily.InviteCode] = invitedFamily
+	}
+	directory, err := getPhoneDirectory()
+	if err != nil {
+		log.Printf("Texting the promoted families only at the numbers they RSVP'd from, as PHONE_DIRECTORY couldn't be read: %v", err)
+	}
+	provider, err := smsProviderFromEnv()
+	if err != nil {
+		log.Printf("Promoting the waitlist without texting the families: %v", err)
+	}
+
+	var updates []*sheets.ValueRange
+	var promotedRows []int
+	for _, promotion := range promotions {
+		entry := promotion.Entry
+		invitedFamily := familiesByInviteCode[entry.InviteCode]
+		rsvpd := invitedFamily.rsvpdTo(entry.Event)
+		if rsvpd < 0 {
+			rsvpd = 0
+		}
+		rsvpd += promotion.Seats
+		if err := guestStore.SaveRsvps(entry.InviteCode, WAITLIST_PROMOTED, map[Event]int{entry.Event: rsvpd}, invitedFamily.recountedChildren(entry.Event, rsvpd)); err != nil {
+			return err
+		}
+		stillWaiting := entry.Guests - promotion.Seats
+		if stillWaiting > 0 {
+			updates = append(updates, &sheets.ValueRange{Range: WAITLIST + "!C" + strconv.Itoa(entry.rowNumber), Values: [][]interface{}{{stillWaiting}}})
+		} else {
+			promotedRows = append(promotedRows, entry.rowNumber)
+		}
+		log.Printf("Promoted %d guests of invite code %d off the %s waitlist", promotion.Seats, entry.InviteCode, entry.Event.Name)
+
+		if provider == nil {
+			continue
+		}
+		phoneNumber := entry.PhoneNumber
+		for _, directoryEntry := range directory {
+			if phoneNumber == "" && directoryEntry.InviteCode == entry.InviteCode {
+				phoneNumber = directoryEntry.PhoneNumber
+			}
+		}
+		if phoneNumber == "" || phoneNumber == HOST_ENTERED {
+			log.Printf("No phone number to tell invite code %d about their %s seats", entry.InviteCode, entry.Event.Name)
+			continue
+		}
+		if _, err := provider.SendSms(phoneNumber, waitlistPromotedMsg(invitedFamily, entry.Event, rsvpd, stillWaiting)); err != nil {
+			log.Printf("Unable to tell invite code %d about their %s seats: %v", entry.InviteCode, entry.Event.Name, err)
+		}
+	}
+	if len(updates) > 0 {
+		if _, err := setGoogleSheetsData(updates); err != nil {
+			return err
+		}
+	}
+	if len(promotedRows) > 0 {
+		return deleteGoogleSheetsRows(WAITLIST, promotedRows)
+	}
+	return nil
+}
+
+func waitlistCommand(args []string) error {
+	flags := flag.NewFlagSet("waitlist", flag.ExitOnError)
+	eventName := flags.String("event", "", "only list this event's waitlist, i.e. WEDDING (default all events)")
+	flags.Parse(args)
+
+	invitedFamilies, err := guestStore.AllFamilies()
+	if err != nil {
+		return err
+	}
+	waitlist, err := readWaitlist()
+	if err != nil {
+		return err
+	}
+	inviteNames := make(map[int]string)
+	for _, invitedFamily := range invitedFamilies {
+		inviteNames[invitedFamily.InviteCode] = invitedFamily.InviteName
+	}
+	totals := eventTotals(invitedFamilies)
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, event := range AllEvents {
+		if *eventName != "" && !strings.EqualFold(*eventName, event.Name) {
+			continue
+		}
+		capacity := "no limit"
+		if event.Capacity > 0 {
+			capacity = strconv.Itoa(event.Capacity)
+		}
+		fmt.Fprintf(table, "%s\tRSVP'd: %d\tCapacity: %s\t\n", event.Name, totals[event], capacity)
+		for _, entry := range waitlist {
+			if entry.Event == event {
+				fmt.Fprintf(table, "  #%d\t%d (%s)\t%d guests\t%s\n", entry.Position, entry.InviteCode, inviteNames[entry.InviteCode], entry.Guests, entry.AddedAt)
+			}
+		}
+	}
+	return table.Flush()
+}
+
+// promoteWaitlistCommand gives the waitlisted families the seats that are
+// free, i.e. after raising an event's capacity
+func promoteWaitlistCommand(args []string) error {
+	flags := flag.NewFlagSet("promote-waitlist", flag.ExitOnError)
+	flags.Parse(args)
+	return promoteWaitlist(AllEvents)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCapRsvp(t *testing.T) {
+	wedding := Wedding
+	wedding.Capacity = 10
+	tests := []struct {
+		total, previous, rsvpd int
+		confirmed, waitlisted  int
+	}{
+		{total: 6, previous: NULL_INVITEES, rsvpd: 4, confirmed: 4, waitlisted: 0},
+		{total: 8, previous: NULL_INVITEES, rsvpd: 4, confirmed: 2, waitlisted: 2},
+		{total: 10, previous: 2, rsvpd: 5, confirmed: 2, waitlisted: 3},
+		{total: 10, previous: 0, rsvpd: 3, confirmed: 0, waitlisted: 3},
+		{total: 12, previous: 4, rsvpd: 4, confirmed: 4, waitlisted: 0}, // the hosts went over capacity
+		{total: 12, previous: 4, rsvpd: 6, confirmed: 4, waitlisted: 2},
+		{total: 10, previous: 4, rsvpd: 1, confirmed: 1, waitlisted: 0},
+		{total: 14, previous: 4, rsvpd: 2, confirmed: 2, waitlisted: 0}, // lowering while over capacity
+		{total: 14, previous: 4, rsvpd: 0, confirmed: 0, waitlisted: 0},
+		{total: 14, previous: 4, rsvpd: 4, confirmed: 4, waitlisted: 0},
+	}
+	for _, test := range tests {
+		if confirmed, waitlisted := capRsvp(wedding, test.total, test.previous, test.rsvpd); confirmed != test.confirmed || waitlisted != test.waitlisted {
+			t.Errorf("Expected +%v to be %d confirmed & %d waitlisted, got: %d %d", test, test.confirmed, test.waitlisted, confirmed, waitlisted)
+		}
+	}
+	vidhi := Vidhi
+	vidhi.Capacity = 0
+	if confirmed, waitlisted := capRsvp(vidhi, 500, 0, 4); confirmed != 4 || waitlisted != 0 {
+		t.Errorf("Expected no limit without a capacity, got: %d %d", confirmed, waitlisted)
+	}
+}
+
+func TestWaitlistPromotions(t *testing.T) {
+	wedding := Wedding
+	wedding.Capacity = 10
+	waitlist := []WaitlistEntry{
+		{InviteCode: 1, Event: wedding, Guests: 2, Position: 1},
+		{InviteCode: 2, Event: Vidhi, Guests: 5, Position: 1},
+		{InviteCode: 3, Event: wedding, Guests: 4, Position: 2},
+		{InviteCode: 4, Event: wedding, Guests: 1, Position: 3},
+	}
+
+	promotions := waitlistPromotions(wedding, 5, waitlist)
+	if len(promotions) != 2 || promotions[0].Entry.InviteCode != 1 || promotions[0].Seats != 2 || promotions[1].Entry.InviteCode != 3 || promotions[1].Seats != 3 {
+		t.Errorf("Expected family 1 promoted & 3 of family 3, got: +%v", promotions)
+	}
+	if promotions := waitlistPromotions(wedding, 10, waitlist); len(promotions) != 0 {
+		t.Errorf("Expected nobody promoted when the event is full, got: +%v", promotions)
+	}
+
+	totals := eventTotals([]InvitedFamily{
+		{WeddingRsvpd: 4, VidhiRsvpd: NULL_INVITEES, GarbaRsvpd: 0},
+		{WeddingRsvpd: 2, VidhiRsvpd: 3, GarbaRsvpd: NULL_INVITEES},
+	})
+	if totals[Wedding] != 6 || totals[Vidhi] != 3 || totals[Garba] != 0 {
+		t.Errorf("Unexpected event totals: +%v", totals)
+	}
+}